@@ -77,7 +77,7 @@ func analysisService() {
 }
 
 func handleAnalysisRequest() {
-	execution := <-analysisChannel
+	execution := analysisQueue.pop()
 	defer func() {
 		if err := recover(); err != nil {
 			fmt.Printf("Error in analysis execution: %+v\n", execution)
@@ -86,5 +86,7 @@ func handleAnalysisRequest() {
 		}
 	}()
 	fmt.Printf("Executing analysis: %+v\n", execution)
-	execution.AnalysisChan <- analyse(execution)
+	fileWarnings := analyse(execution)
+	execution.report(ProgressEvent{Type: EventAnalysis, Warnings: fileWarnings})
+	execution.AnalysisChan <- fileWarnings
 }
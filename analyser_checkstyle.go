@@ -2,15 +2,12 @@ package main
 
 import (
 	"bytes"
-	"context"
 	"encoding/xml"
 	"fmt"
 	"io/ioutil"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
-	"syscall"
 	"time"
 )
 
@@ -50,22 +47,17 @@ func checkstyleAnalysis(pmdFile string, timeout int, runid string, absRunDir str
 }
 
 func runCheckstyle(checkstyleFile string, timeout int, runid string, absRunDir string, maxMem int, runDir string) (err error) {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeout)*time.Second)
-	defer func() {
-		exec.Command("docker", "stop", runid).Run()
-		cancel()
-	}()
-	arguments := make([]string, 0)
-	// Docker command
-	arguments = append(arguments, "docker", "run", "--name", runid, "-i", "--rm", "-v", absRunDir+":/code", "-m", fmt.Sprintf("%dM", maxMem))
-
-	arguments = append(arguments, "-v", checkstyleFile+":/checkstyle/checkstyle.xml")
-
-	arguments = append(arguments, *docker_image_checkstyle, "-c", "/checkstyle/checkstyle.xml", "-f", "xml", "/code")
-
-	cmd := exec.CommandContext(ctx, "docker")
-	cmd.Dir = runDir
-	cmd.Args = arguments
+	mounts := []Mount{{Source: absRunDir, Target: "/code"}}
+	mounts = append(mounts, Mount{Source: checkstyleFile, Target: "/checkstyle/checkstyle.xml"})
+	sandboxCmd := SandboxCommand{
+		Name:    runid,
+		Image:   *docker_image_checkstyle,
+		Command: []string{"-c", "/checkstyle/checkstyle.xml", "-f", "xml", "/code"},
+		Mounts:  mounts,
+		Stdin:   strings.NewReader(""),
+		MaxMem:  maxMem,
+		Timeout: time.Duration(timeout) * time.Second,
+	}
 
 	outFilePath := filepath.Join(runDir, "analysis_checkstyle.xml")
 	outFileHandle, err := os.Create(outFilePath)
@@ -81,18 +73,20 @@ func runCheckstyle(checkstyleFile string, timeout int, runid string, absRunDir s
 			return
 		}
 	}()
-	cmd.Stdout = LimitWriter(outFileHandle, maxFileSize)
+	sandboxCmd.Stdout = outFileHandle
+	sandboxCmd.StdoutLimit = maxFileSize
 	errBuffer := new(bytes.Buffer)
-	cmd.Stderr = errBuffer
-
-	//execute docker
-	if err = cmd.Run(); err != nil {
-		if exiterr, ok := err.(*exec.ExitError); ok {
-			if status, ok := exiterr.Sys().(syscall.WaitStatus); ok {
-				if status.ExitStatus() == -1 { // killed
-					err = fmt.Errorf("timeout")
-				}
-			}
+	sandboxCmd.Stderr = errBuffer
+
+	//execute in sandbox
+	res, err := sandbox.Run(sandboxCmd)
+	if err != nil {
+		return
+	}
+	if res.TimedOut || res.ExitCode != 0 {
+		err = fmt.Errorf("exit status %d", res.ExitCode)
+		if res.TimedOut {
+			err = fmt.Errorf("timeout")
 		}
 		if errBuffer.Len() > 0 {
 			err = fmt.Errorf(errBuffer.String())
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+)
+
+// apiErrorVersion is the version of the error schema, it is increased on incompatible changes
+const apiErrorVersion = 1
+
+// ApiErrorCode is the machine-readable code of an error
+type ApiErrorCode string
+
+const (
+	ErrMethodNotAllowed  ApiErrorCode = "method_not_allowed"
+	ErrUnauthorized      ApiErrorCode = "unauthorized"
+	ErrMissingParameter  ApiErrorCode = "missing_parameter"
+	ErrInvalidParameter  ApiErrorCode = "invalid_parameter"
+	ErrNotFound          ApiErrorCode = "not_found"
+	ErrTestNotFound      ApiErrorCode = "test_not_found"
+	ErrInvalidTestConfig ApiErrorCode = "invalid_test_config"
+	ErrMissingFiles      ApiErrorCode = "missing_files"
+	ErrIllegalFiles      ApiErrorCode = "illegal_files"
+	ErrUploadFailed      ApiErrorCode = "upload_failed"
+	ErrInvalidArchive    ApiErrorCode = "invalid_archive"
+	ErrUploadTooLarge    ApiErrorCode = "upload_too_large"
+	ErrTooManyFiles      ApiErrorCode = "too_many_files"
+	ErrGitFailed         ApiErrorCode = "git_fetch_failed"
+	ErrRateLimited       ApiErrorCode = "rate_limited"
+	ErrTooManyRuns       ApiErrorCode = "too_many_runs"
+	ErrQueueFull         ApiErrorCode = "queue_full"
+	ErrStorage           ApiErrorCode = "storage_error"
+	ErrInternal          ApiErrorCode = "internal_error"
+	ErrCompileError      ApiErrorCode = "compile_error"
+	ErrCompileTimeout    ApiErrorCode = "compile_timeout"
+	ErrTestCompileError  ApiErrorCode = "test_compile_error"
+)
+
+// phases in which an error can occur
+const (
+	PhaseRequest = "request"
+	PhaseAuth    = "authentication"
+	PhaseUpload  = "upload"
+	PhaseConfig  = "config"
+	PhaseQueue   = "queue"
+	PhaseCompile = "compile"
+	PhaseTest    = "test"
+	PhaseListing = "listing"
+)
+
+// ApiError describes why a request or a test run failed
+type ApiError struct {
+	Code    ApiErrorCode `json:"code"`
+	Message string       `json:"message"`
+	// Details depend on the code, e.g. the missing files for missing_files
+	Details interface{} `json:"details,omitempty"`
+	Phase   string      `json:"phase"`
+}
+
+// ErrorResponse is the body of every response with a 4xx or 5xx status
+type ErrorResponse struct {
+	Version int      `json:"version"`
+	Error   ApiError `json:"error"`
+}
+
+// writeError writes the error as JSON response with the given status
+func writeError(w http.ResponseWriter, status int, apiErr ApiError) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	enc := json.NewEncoder(w)
+	enc.Encode(ErrorResponse{Version: apiErrorVersion, Error: apiErr})
+}
+
+// rejectMethod answers requests with a method the endpoint does not support
+func rejectMethod(w http.ResponseWriter, r *http.Request, allowed ...string) {
+	w.Header().Set("Allow", strings.Join(allowed, ", "))
+	writeError(w, http.StatusMethodNotAllowed, ApiError{
+		Code:    ErrMethodNotAllowed,
+		Message: "Method " + r.Method + " is not allowed, use " + strings.Join(allowed, " or "),
+		Phase:   PhaseRequest,
+	})
+}
+
+// notFound answers requests for tests, runs or submissions which do not exist or are not accessible to the caller
+func notFound(w http.ResponseWriter, message string) {
+	writeError(w, http.StatusNotFound, ApiError{Code: ErrNotFound, Message: message, Phase: PhaseRequest})
+}
+
+// compileApiError returns the error of a failed compilation of the submission
+func compileApiError(err error) *ApiError {
+	if isCompileTimeout(err) {
+		return &ApiError{Code: ErrCompileTimeout, Message: err.Error(), Phase: PhaseCompile}
+	}
+	return &ApiError{Code: ErrCompileError, Message: err.Error(), Phase: PhaseCompile}
+}
+
+// testCompileApiError returns the error of a failed compilation of the submission together with the test cases
+func testCompileApiError(err error) *ApiError {
+	if isCompileTimeout(err) {
+		return &ApiError{Code: ErrCompileTimeout, Message: err.Error(), Phase: PhaseTest}
+	}
+	return &ApiError{Code: ErrTestCompileError, Message: err.Error(), Phase: PhaseTest}
+}
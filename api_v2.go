@@ -0,0 +1,190 @@
+package main
+
+import (
+	"encoding/json"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// apiVersionPrefix is the prefix of all endpoints of the versioned API, the endpoints without prefix are kept for older clients
+const apiVersionPrefix = "/v2"
+
+// apiPath returns the path of the request without the context path and the version prefix
+func apiPath(r *http.Request) string {
+	path := strings.TrimPrefix(r.URL.Path, *contextPath)
+	if isV2Request(r) {
+		path = strings.TrimPrefix(path, apiVersionPrefix)
+	}
+	return path
+}
+
+// isV2Request tells if the request was sent to an endpoint of the /v2 API
+func isV2Request(r *http.Request) bool {
+	path := strings.TrimPrefix(r.URL.Path, *contextPath)
+	return path == apiVersionPrefix || strings.HasPrefix(path, apiVersionPrefix+"/")
+}
+
+// TestList is the list of tests returned by GET /v2/tests
+type TestList struct {
+	Tests []string `json:"tests"`
+}
+
+func handleV2Tests(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != "GET" {
+		rejectMethod(w, r, "GET")
+		LogError("listing", "Rejected %s request to tests from %s", r.Method, r.RemoteAddr)
+		return
+	}
+
+	caller, ok := authenticate(w, r, "listing")
+	if !ok {
+		return
+	}
+
+	tests, err := listTests(caller)
+	if err != nil {
+		handleError(w, err)
+		LogError("listing", "Could not list tests: %s", err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.Encode(TestList{Tests: tests})
+}
+
+// parseSubmissionRequest reads a submission from a JSON or multipart body.
+// Multipart bodies contain the fields test, priority and user, the files as parts named files and optionally an archive
+// or a Git repository (git_url and git_ref or git_bundle).
+// If the body is invalid, the response is written and false is returned.
+func parseSubmissionRequest(w http.ResponseWriter, r *http.Request) (SubmissionRequest, bool) {
+	var request SubmissionRequest
+	limitRequestBody(w, r)
+	mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	switch mediaType {
+	case "application/json":
+		dec := json.NewDecoder(r.Body)
+		dec.DisallowUnknownFields()
+		if err := dec.Decode(&request); err != nil {
+			if isRequestTooLarge(err) {
+				writeRequestTooLarge(w)
+				return request, false
+			}
+			writeError(w, http.StatusBadRequest, ApiError{Code: ErrInvalidParameter, Message: "Invalid submission: " + err.Error(), Phase: PhaseRequest})
+			LogError("upload", "Invalid submission: %s", err)
+			return request, false
+		}
+	case "multipart/form-data":
+		if err := r.ParseMultipartForm(maxMemory); err != nil {
+			if isRequestTooLarge(err) {
+				writeRequestTooLarge(w)
+				return request, false
+			}
+			writeError(w, http.StatusBadRequest, ApiError{Code: ErrUploadFailed, Message: err.Error(), Phase: PhaseUpload})
+			LogError("upload", "Could not parse multipart body: %s", err)
+			return request, false
+		}
+		request.Test = r.FormValue("test")
+		request.Priority = r.FormValue("priority")
+		request.User = r.FormValue("user")
+		for _, header := range r.MultipartForm.File["files"] {
+			file, err := readFormFile(header)
+			if err != nil {
+				writeError(w, http.StatusBadRequest, ApiError{Code: ErrUploadFailed, Message: err.Error(), Phase: PhaseUpload})
+				LogError("upload", "Error reading file from request: %s", err)
+				return request, false
+			}
+			request.Files = append(request.Files, file)
+		}
+		if err := readFormSources(r, &request); err != nil {
+			writeError(w, http.StatusBadRequest, ApiError{Code: ErrUploadFailed, Message: err.Error(), Phase: PhaseUpload})
+			LogError("upload", "Error reading archive from request: %s", err)
+			return request, false
+		}
+	default:
+		writeError(w, http.StatusUnsupportedMediaType, ApiError{
+			Code:    ErrInvalidParameter,
+			Message: "The body must be application/json or multipart/form-data",
+			Details: map[string]string{"content_type": mediaType},
+			Phase:   PhaseRequest,
+		})
+		return request, false
+	}
+	if len(request.Files) == 0 && request.Archive == nil && request.Git == nil {
+		writeError(w, http.StatusBadRequest, ApiError{
+			Code:    ErrMissingParameter,
+			Message: "The submission contains no files",
+			Details: map[string]string{"parameter": "files"},
+			Phase:   PhaseRequest,
+		})
+		return request, false
+	}
+	return request, true
+}
+
+// handleV2Submissions starts a submission. With the query parameter wait=true the response is sent when the result is available.
+func handleV2Submissions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != "POST" {
+		rejectMethod(w, r, "POST")
+		LogError("upload", "Rejected %s request to submissions from %s", r.Method, r.RemoteAddr)
+		return
+	}
+
+	caller, ok := authenticate(w, r, "upload")
+	if !ok {
+		return
+	}
+
+	request, ok := parseSubmissionRequest(w, r)
+	if !ok {
+		return
+	}
+	execution, ok := prepareExecution(w, r, caller, request)
+	if !ok {
+		return
+	}
+
+	submission, ok := startSubmission(execution, newRunRecord(execution))
+	if !ok {
+		rejectOverloaded(w, execution)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", r.URL.Path+"/"+submission.ID)
+	if r.URL.Query().Get("wait") != "true" {
+		w.WriteHeader(http.StatusAccepted)
+		enc := json.NewEncoder(w)
+		enc.Encode(submission)
+		return
+	}
+	if !submission.progress.wait(r.Context().Done()) {
+		// the client is gone, the submission is finished in the background
+		return
+	}
+	submission, _ = submissions.get(submission.ID)
+	enc := json.NewEncoder(w)
+	enc.Encode(submission)
+}
+
+func handleOpenApi(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	if r.Method != "GET" {
+		rejectMethod(w, r, "GET")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(openApiDocument())
+}
@@ -0,0 +1,172 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"path"
+	"strings"
+)
+
+// ArchiveError is returned if an uploaded archive cannot be extracted
+type ArchiveError struct {
+	// Entry is the name of the entry in the archive which was rejected, empty if the archive itself is invalid
+	Entry  string `json:"entry,omitempty"`
+	Reason string `json:"reason"`
+}
+
+func (e ArchiveError) Error() string {
+	if e.Entry == "" {
+		return "Invalid archive: " + e.Reason
+	}
+	return fmt.Sprintf("Invalid archive entry %s: %s", e.Entry, e.Reason)
+}
+
+// archiveLimits restrict the content of an uploaded archive after extraction
+type archiveLimits struct {
+	maxBytes   int64 // sum of the sizes of all files
+	maxEntries int
+}
+
+func defaultArchiveLimits() archiveLimits {
+	return archiveLimits{maxBytes: *archiveMaxBytes, maxEntries: *archiveMaxEntries}
+}
+
+// archivePath checks the name of an entry and returns it as relative slash-separated path.
+// Absolute paths and paths leaving the upload folder are rejected.
+func archivePath(name string) (string, error) {
+	p, reason := uploadPath(name)
+	if reason != "" {
+		return "", ArchiveError{Entry: name, Reason: reason}
+	}
+	return p, nil
+}
+
+// checkArchiveDir checks the name of a folder entry, the folder of the archive itself (e.g. "./") is allowed
+func checkArchiveDir(name string) error {
+	if path.Clean(strings.ReplaceAll(name, "\\", "/")) == "." {
+		return nil
+	}
+	_, err := archivePath(name)
+	return err
+}
+
+// archiveExtractor collects the files of an archive and enforces the limits
+type archiveExtractor struct {
+	limits  archiveLimits
+	entries int
+	size    int64
+	files   []SubmittedFile
+}
+
+// add reads a regular file of the archive, at most up to the remaining size limit
+func (x *archiveExtractor) add(name string, r io.Reader) error {
+	p, err := archivePath(name)
+	if err != nil {
+		return err
+	}
+	x.entries++
+	if x.limits.maxEntries > 0 && x.entries > x.limits.maxEntries {
+		return ArchiveError{Reason: fmt.Sprintf("more than %d files", x.limits.maxEntries)}
+	}
+	if x.limits.maxBytes > 0 {
+		// read one byte more than allowed to notice files which are too large, even if the header lies about the size
+		r = io.LimitReader(r, x.limits.maxBytes-x.size+1)
+	}
+	content, err := ioutil.ReadAll(r)
+	if err != nil {
+		return ArchiveError{Entry: name, Reason: err.Error()}
+	}
+	x.size += int64(len(content))
+	if x.limits.maxBytes > 0 && x.size > x.limits.maxBytes {
+		return ArchiveError{Reason: fmt.Sprintf("content larger than %d bytes", x.limits.maxBytes)}
+	}
+	x.files = append(x.files, SubmittedFile{Name: p, Content: string(content)})
+	return nil
+}
+
+func (x *archiveExtractor) extractZip(data []byte) error {
+	reader, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		return ArchiveError{Reason: err.Error()}
+	}
+	for _, entry := range reader.File {
+		mode := entry.Mode()
+		if mode.IsDir() {
+			if err := checkArchiveDir(entry.Name); err != nil {
+				return err
+			}
+			continue
+		}
+		if !mode.IsRegular() {
+			return ArchiveError{Entry: entry.Name, Reason: "not a regular file (symbolic links are not allowed)"}
+		}
+		f, err := entry.Open()
+		if err != nil {
+			return ArchiveError{Entry: entry.Name, Reason: err.Error()}
+		}
+		err = x.add(entry.Name, f)
+		f.Close()
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (x *archiveExtractor) extractTarGz(data []byte) error {
+	gz, err := gzip.NewReader(bytes.NewReader(data))
+	if err != nil {
+		return ArchiveError{Reason: err.Error()}
+	}
+	defer gz.Close()
+	reader := tar.NewReader(gz)
+	for {
+		header, err := reader.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return ArchiveError{Reason: err.Error()}
+		}
+		switch header.Typeflag {
+		case tar.TypeDir:
+			if err := checkArchiveDir(header.Name); err != nil {
+				return err
+			}
+		case tar.TypeReg, tar.TypeRegA:
+			if err := x.add(header.Name, reader); err != nil {
+				return err
+			}
+		case tar.TypeXGlobalHeader:
+			// pax headers added by git archive
+		default:
+			return ArchiveError{Entry: header.Name, Reason: "not a regular file (symbolic links are not allowed)"}
+		}
+	}
+}
+
+// extractArchive returns the files of a zip or tar.gz archive. The format is taken from the content, not the name.
+func extractArchive(archive SubmittedFile, limits archiveLimits) ([]SubmittedFile, error) {
+	data, err := archive.bytes()
+	if err != nil {
+		return nil, ArchiveError{Reason: err.Error()}
+	}
+	x := archiveExtractor{limits: limits}
+	switch {
+	case bytes.HasPrefix(data, []byte("PK\x03\x04")) || bytes.HasPrefix(data, []byte("PK\x05\x06")):
+		err = x.extractZip(data)
+	case bytes.HasPrefix(data, []byte{0x1f, 0x8b}):
+		err = x.extractTarGz(data)
+	default:
+		err = ArchiveError{Reason: fmt.Sprintf("%s is neither a zip nor a tar.gz archive", archive.Name)}
+	}
+	if err != nil {
+		return nil, err
+	}
+	return x.files, nil
+}
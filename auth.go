@@ -0,0 +1,187 @@
+package main
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"sync"
+	"syscall"
+)
+
+// ApiKey is an entry of the keys file
+type ApiKey struct {
+	// Name identifies the key in logs and metrics
+	Name string
+	Key  string
+	// Scopes are the test folders (relative to the testdata folder) the key has access to, including their subfolders
+	Scopes []string `json:",omitempty"`
+	// Admin keys have access to all tests and to the administrative endpoints
+	Admin bool `json:",omitempty"`
+	// HighPriority keys may send submissions with the priority high, like admin keys
+	HighPriority bool `json:",omitempty"`
+}
+
+// Caller is the authenticated client of a request
+type Caller struct {
+	Name   string
+	Scopes []string
+	Admin  bool
+	// HighPriority is set if the caller may send submissions with the priority high
+	HighPriority bool
+	// Anonymous is set if no keys are configured and requests are not authenticated
+	Anonymous bool
+	// User is the user authenticated by an LTI token
+	User string
+	// Instructor is set for LTI users with an instructor or administrator role, who see the runs of all users
+	Instructor bool
+	lti        *ltiLaunch
+}
+
+// canAccess checks if the test is inside of the scopes of the caller
+func (c Caller) canAccess(testref string) bool {
+	if c.Admin {
+		return true
+	}
+	testref = filepath.ToSlash(filepath.Clean(testref))
+	for _, scope := range c.Scopes {
+		scope = strings.Trim(filepath.ToSlash(filepath.Clean(scope)), "/")
+		if testref == scope || strings.HasPrefix(testref, scope+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// canSeeRun checks if the caller may see a run of the test started by runCaller and runUser.
+// LTI users who are not instructors only see their own runs.
+func (c Caller) canSeeRun(test string, runCaller string, runUser string) bool {
+	if !c.canAccess(test) {
+		return false
+	}
+	if c.User == "" || c.Instructor {
+		return true
+	}
+	return runCaller == c.Name && runUser == c.User
+}
+
+// priority returns the priority of a submission of the caller.
+// Only admins and keys with HighPriority get the priority high, the submissions of other callers get normal priority.
+func (c Caller) priority(requested Priority) Priority {
+	if requested == PriorityHigh && !c.Admin && !c.HighPriority {
+		return PriorityNormal
+	}
+	return requested
+}
+
+// keyring holds the API keys accepted by the server
+type keyring struct {
+	sync.RWMutex
+	keys []ApiKey
+	// adminKey is taken from the RTE_API_KEY environment variable
+	adminKey string
+}
+
+var apiKeys keyring
+
+func loadApiKeys(file string) ([]ApiKey, error) {
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	var keys []ApiKey
+	if err := json.NewDecoder(f).Decode(&keys); err != nil {
+		return nil, fmt.Errorf("Could not read keys %s: %s", file, err)
+	}
+	names := make(map[string]bool)
+	for i, key := range keys {
+		if key.Name == "" || key.Key == "" {
+			return nil, fmt.Errorf("Key %d in %s needs a name and a key", i, file)
+		}
+		if names[key.Name] {
+			return nil, fmt.Errorf("Duplicate key name %s in %s", key.Name, file)
+		}
+		names[key.Name] = true
+	}
+	return keys, nil
+}
+
+func (k *keyring) setKeys(keys []ApiKey) {
+	k.Lock()
+	defer k.Unlock()
+	k.keys = keys
+}
+
+// reloadApiKeysOnSignal reloads the keys file whenever RTE receives SIGHUP
+func reloadApiKeysOnSignal(file string) {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGHUP)
+	for range signals {
+		keys, err := loadApiKeys(file)
+		if err != nil {
+			LogError("startup", "Could not reload keys, keeping the old keys: %s", err)
+			continue
+		}
+		apiKeys.setKeys(keys)
+		Info.Printf("Reloaded %d keys from %s\n", len(keys), file)
+	}
+}
+
+func keyEquals(a string, b string) bool {
+	return subtle.ConstantTimeCompare([]byte(a), []byte(b)) == 1
+}
+
+// caller returns the caller with the given key, false if the key is not valid
+func (k *keyring) caller(key string) (Caller, bool) {
+	k.RLock()
+	defer k.RUnlock()
+	if k.adminKey == "" && len(k.keys) == 0 {
+		return Caller{Name: "anonymous", Admin: true, Anonymous: true}, true
+	}
+	if key == "" {
+		return Caller{}, false
+	}
+	if k.adminKey != "" && keyEquals(key, k.adminKey) {
+		return Caller{Name: "admin", Admin: true}, true
+	}
+	for _, apiKey := range k.keys {
+		if keyEquals(key, apiKey.Key) {
+			return Caller{Name: apiKey.Name, Scopes: apiKey.Scopes, Admin: apiKey.Admin, HighPriority: apiKey.HighPriority}, true
+		}
+	}
+	return Caller{}, false
+}
+
+// authenticate checks the ApiKey header or the LTI token in the Authorization header of the request.
+// If the credentials are missing or invalid, the response is written and false is returned.
+func authenticate(w http.ResponseWriter, r *http.Request, phase string) (Caller, bool) {
+	if token := bearerToken(r); token != "" && ltiConfig != nil {
+		caller, err := ltiCaller(token)
+		if err != nil {
+			writeError(w, http.StatusForbidden, ApiError{Code: ErrUnauthorized, Message: "Invalid LTI token", Phase: PhaseAuth})
+			LogError(phase, "Invalid LTI token: %s", err)
+			return Caller{}, false
+		}
+		// a token can start one run (in the upload phase), reading the results is allowed until it expires
+		if phase == "upload" && !caller.lti.useNonce() {
+			writeError(w, http.StatusForbidden, ApiError{Code: ErrUnauthorized, Message: "LTI token was already used to start a run", Phase: PhaseAuth})
+			LogError(phase, "LTI token of %s was already used to start a run", caller.User)
+			return Caller{}, false
+		}
+		accessCounter.WithLabelValues(caller.Name, phase).Inc()
+		return caller, true
+	}
+	caller, ok := apiKeys.caller(r.Header.Get("ApiKey"))
+	if !ok {
+		writeError(w, http.StatusForbidden, ApiError{Code: ErrUnauthorized, Message: "Invalid or missing ApiKey", Phase: PhaseAuth})
+		LogError(phase, "Invalid or missing ApiKey")
+		return Caller{}, false
+	}
+	accessCounter.WithLabelValues(caller.Name, phase).Inc()
+	return caller, true
+}
@@ -0,0 +1,46 @@
+package main
+
+import "testing"
+
+func TestCallerPriority(t *testing.T) {
+	var keys keyring
+	keys.setKeys([]ApiKey{
+		{Name: "student", Key: "s", Scopes: []string{"gdp21"}},
+		{Name: "tutor", Key: "t", Scopes: []string{"gdp21"}, HighPriority: true},
+		{Name: "ops", Key: "o", Admin: true},
+	})
+	lti := Caller{Name: "moodle", User: "student-1", Scopes: []string{"gdp21"}}
+
+	cases := []struct {
+		caller    string
+		requested Priority
+		want      Priority
+	}{
+		{"student", PriorityHigh, PriorityNormal},
+		{"student", PriorityNormal, PriorityNormal},
+		{"student", PriorityLow, PriorityLow},
+		{"tutor", PriorityHigh, PriorityHigh},
+		{"ops", PriorityHigh, PriorityHigh},
+		{"lti", PriorityHigh, PriorityNormal},
+		{"lti", PriorityLow, PriorityLow},
+	}
+	for _, c := range cases {
+		caller := lti
+		if c.caller != "lti" {
+			var ok bool
+			caller, ok = keys.caller(c.caller[:1])
+			if !ok || caller.Name != c.caller {
+				t.Fatalf("key of %s not accepted", c.caller)
+			}
+		}
+		if got := caller.priority(c.requested); got != c.want {
+			t.Errorf("%s requesting %s gets %s, want %s", c.caller, c.requested, got, c.want)
+		}
+	}
+
+	// without keys, the server is not protected and all callers are admins
+	anonymous, _ := (&keyring{}).caller("")
+	if got := anonymous.priority(PriorityHigh); got != PriorityHigh {
+		t.Errorf("anonymous caller gets %s, want high", got)
+	}
+}
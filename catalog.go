@@ -0,0 +1,415 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+	"github.com/mattn/go-zglob"
+)
+
+// severities of the problems of a test configuration
+const (
+	// SeverityError is a problem which prevents executing the test
+	SeverityError = "error"
+	// SeverityWarning is a problem the test can be executed with, e.g. an unknown field which is ignored
+	SeverityWarning = "warning"
+)
+
+// ConfigProblem is a mistake in the config.json of a test
+type ConfigProblem struct {
+	// Field is the field of TestConfig with the mistake, empty if the whole file is affected
+	Field    string `json:"field,omitempty"`
+	Message  string `json:"message"`
+	Severity string `json:"severity"`
+}
+
+// TestConfigError is returned for tests whose config.json has errors, these tests cannot be executed
+type TestConfigError struct {
+	Test     string
+	Problems []ConfigProblem
+}
+
+func (e TestConfigError) Error() string {
+	return fmt.Sprintf("Invalid configuration of test %s: %s", e.Test, joinProblems(e.Problems))
+}
+
+func joinProblems(problems []ConfigProblem) string {
+	messages := make([]string, len(problems))
+	for i, problem := range problems {
+		messages[i] = problem.Message
+	}
+	return strings.Join(messages, "; ")
+}
+
+// catalogTest is a test with its parsed configuration
+type catalogTest struct {
+	Ref      string
+	Dir      string
+	Config   TestConfig
+	Problems []ConfigProblem
+	// allowedFiles are the compiled patterns of Config.AllowedFiles
+	allowedFiles []*regexp.Regexp
+}
+
+// valid tells if the test can be executed, i.e. its configuration has no errors
+func (t *catalogTest) valid() bool {
+	for _, problem := range t.Problems {
+		if problem.Severity == SeverityError {
+			return false
+		}
+	}
+	return true
+}
+
+// decodeTestConfig decodes a config.json. Invalid JSON and enum values are returned as error.
+// All unknown fields are reported, as error with strict (like DisallowUnknownFields) and otherwise as warning.
+func decodeTestConfig(data []byte, strict bool) (TestConfig, []ConfigProblem, error) {
+	var config TestConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return config, nil, err
+	}
+	var problems []ConfigProblem
+	for _, field := range unknownJSONFields(data, reflect.TypeOf(config), "") {
+		problem := ConfigProblem{Field: field, Message: fmt.Sprintf("Unknown field %s is ignored", field), Severity: SeverityWarning}
+		if strict {
+			problem = ConfigProblem{Field: field, Message: fmt.Sprintf("Unknown field %s", field), Severity: SeverityError}
+		}
+		problems = append(problems, problem)
+	}
+	return config, problems, nil
+}
+
+// unknownJSONFields returns the fields of the JSON objects in data which are not decoded into the type t,
+// with the names of the enclosing fields separated by dots. Like encoding/json, the names are compared case-insensitively.
+func unknownJSONFields(data []byte, t reflect.Type, prefix string) []string {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	var unknown []string
+	switch t.Kind() {
+	case reflect.Struct:
+		var object map[string]json.RawMessage
+		if json.Unmarshal(data, &object) != nil {
+			return nil
+		}
+		names := make([]string, 0, len(object))
+		for name := range object {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			field, found := jsonFieldByName(t, name)
+			if !found {
+				unknown = append(unknown, prefix+name)
+				continue
+			}
+			unknown = append(unknown, unknownJSONFields(object[name], field.Type, prefix+name+".")...)
+		}
+	case reflect.Slice, reflect.Array:
+		var elements []json.RawMessage
+		if json.Unmarshal(data, &elements) != nil {
+			return nil
+		}
+		for i, element := range elements {
+			unknown = append(unknown, unknownJSONFields(element, t.Elem(), fmt.Sprintf("%s%d.", prefix, i))...)
+		}
+	}
+	return unknown
+}
+
+// jsonFieldByName finds the field of the struct type decoded from the JSON name
+func jsonFieldByName(t reflect.Type, name string) (reflect.StructField, bool) {
+	for i := 0; i < t.NumField(); i++ {
+		if fieldName, _ := jsonField(t.Field(i)); fieldName != "" && strings.EqualFold(fieldName, name) {
+			return t.Field(i), true
+		}
+	}
+	return reflect.StructField{}, false
+}
+
+// checkTestConfig returns the problems of a decoded configuration
+func checkTestConfig(config TestConfig) []ConfigProblem {
+	var problems []ConfigProblem
+	if config.Compiler == JavaCompiler && config.TestType == IOTest && config.MainIs == "" {
+		problems = append(problems, ConfigProblem{Field: "MainIs", Message: "MainIs is required for Java IOTests", Severity: SeverityError})
+	}
+	if _, err := compileAllowedFiles(config); err != nil {
+		problems = append(problems, ConfigProblem{Field: "AllowedFiles", Message: err.Error(), Severity: SeverityError})
+	}
+	if config.Parallelism < 0 {
+		problems = append(problems, ConfigProblem{Field: "Parallelism", Message: "Parallelism must not be negative", Severity: SeverityError})
+	}
+	if config.CompareTool != "" && config.CompareMode != ExactMatch {
+		problems = append(problems, ConfigProblem{Field: "CompareMode", Message: "CompareMode cannot be combined with a CompareTool", Severity: SeverityError})
+	}
+	tolerances := []struct {
+		field string
+		value float64
+	}{{"CompareAbsTolerance", config.CompareAbsTolerance}, {"CompareRelTolerance", config.CompareRelTolerance}}
+	for _, tolerance := range tolerances {
+		field := tolerance.field
+		if tolerance.value < 0 {
+			problems = append(problems, ConfigProblem{Field: field, Message: field + " must not be negative", Severity: SeverityError})
+		} else if tolerance.value != 0 && config.CompareMode != FloatTolerance {
+			problems = append(problems, ConfigProblem{Field: field, Message: field + " is only used with the CompareMode FloatTolerance", Severity: SeverityWarning})
+		}
+	}
+	if config.MaxUploadBytes > 0 && *maxRequestBytes > 0 && config.MaxUploadBytes > *maxRequestBytes {
+		problems = append(problems, ConfigProblem{Field: "MaxUploadBytes", Message: fmt.Sprintf("MaxUploadBytes is larger than -max_request_bytes %d, larger requests are rejected", *maxRequestBytes), Severity: SeverityWarning})
+	}
+	for _, pattern := range config.HiddenTemplateFiles {
+		if _, err := regexp.Compile(pattern); err != nil {
+			problems = append(problems, ConfigProblem{Field: "HiddenTemplateFiles", Message: HiddenFilesError{Pattern: pattern, Err: err}.Error(), Severity: SeverityError})
+		}
+	}
+	return problems
+}
+
+// loadCatalogTest reads and checks the config.json of the test in dir, with strict unknown fields and missing files are errors
+func loadCatalogTest(ref string, dir string, strict bool) (*catalogTest, error) {
+	data, err := ioutil.ReadFile(filepath.Join(dir, "config.json"))
+	if err != nil {
+		return nil, err
+	}
+	test := &catalogTest{Ref: ref, Dir: dir}
+	config, problems, err := decodeTestConfig(data, strict)
+	if err != nil {
+		test.Problems = []ConfigProblem{{Message: err.Error(), Severity: SeverityError}}
+		return test, nil
+	}
+	test.Config = config
+	test.Problems = append(problems, checkTestConfig(config)...)
+	test.Problems = append(test.Problems, checkTestFiles(dir, config, strict)...)
+	if test.valid() {
+		test.allowedFiles, _ = compileAllowedFiles(config)
+	}
+	return test, nil
+}
+
+// testCatalog caches the configurations of all tests in the testdata folder.
+// With watch it reloads them when files in the folder change.
+type testCatalog struct {
+	sync.RWMutex
+	dir    string
+	tests  map[string]*catalogTest
+	loaded time.Time
+}
+
+var catalog = &testCatalog{tests: make(map[string]*catalogTest)}
+
+// findTests reads and checks the configurations of all tests in dir, sorted by name
+func findTests(dir string, strict bool) ([]*catalogTest, error) {
+	configFiles, err := zglob.GlobFollowSymlinks(dir + "/**/config.json") // using this instead of the builtin Glob which does not support '**'
+	if err != nil {
+		return nil, err
+	}
+	tests := make([]*catalogTest, 0, len(configFiles))
+	for _, file := range configFiles {
+		testdir := filepath.Dir(file)
+		ref, err := filepath.Rel(dir, testdir)
+		if err != nil {
+			return nil, fmt.Errorf("Could not create relative path for config file %s: %s", file, err)
+		}
+		test, err := loadCatalogTest(ref, testdir, strict)
+		if err != nil {
+			test = &catalogTest{Ref: ref, Dir: testdir, Problems: []ConfigProblem{{Message: err.Error(), Severity: SeverityError}}}
+		}
+		tests = append(tests, test)
+	}
+	sort.Slice(tests, func(i, j int) bool { return tests[i].Ref < tests[j].Ref })
+	return tests, nil
+}
+
+// load reads the configurations of all tests and replaces the cached ones
+func (c *testCatalog) load() error {
+	found, err := findTests(c.dir, false)
+	if err != nil {
+		return err
+	}
+	tests := make(map[string]*catalogTest, len(found))
+	invalid := 0
+	for _, test := range found {
+		if !test.valid() {
+			invalid++
+			LogError("catalog", "%s", TestConfigError{Test: test.Ref, Problems: test.Problems})
+		} else if len(test.Problems) > 0 {
+			Info.Printf("Warnings for the configuration of test %s: %s\n", test.Ref, joinProblems(test.Problems))
+		}
+		tests[test.Ref] = test
+	}
+
+	c.Lock()
+	c.tests = tests
+	c.loaded = time.Now()
+	c.Unlock()
+
+	catalogTestsGauge.WithLabelValues("valid").Set(float64(len(tests) - invalid))
+	catalogTestsGauge.WithLabelValues("invalid").Set(float64(invalid))
+	catalogReloadCounter.Inc()
+	Info.Printf("Loaded %d tests, %d with invalid configuration\n", len(tests), invalid)
+	return nil
+}
+
+// get returns the test. Tests added since the last reload are read from disk.
+func (c *testCatalog) get(testref string) (*catalogTest, bool) {
+	testref = filepath.Clean(testref)
+	if testref == "." || testref == ".." || strings.HasPrefix(testref, ".."+string(filepath.Separator)) || filepath.IsAbs(testref) {
+		return nil, false
+	}
+	c.RLock()
+	test, ok := c.tests[testref]
+	c.RUnlock()
+	if ok {
+		return test, true
+	}
+
+	test, err := loadCatalogTest(testref, filepath.Join(c.dir, testref), false)
+	if err != nil {
+		return nil, false
+	}
+	c.Lock()
+	c.tests[testref] = test
+	c.Unlock()
+	return test, true
+}
+
+// list returns all tests sorted by name
+func (c *testCatalog) list() []*catalogTest {
+	c.RLock()
+	defer c.RUnlock()
+	tests := make([]*catalogTest, 0, len(c.tests))
+	for _, test := range c.tests {
+		tests = append(tests, test)
+	}
+	sort.Slice(tests, func(i, j int) bool { return tests[i].Ref < tests[j].Ref })
+	return tests
+}
+
+// watch reloads the catalog when files in the testdata folder are created, changed or removed.
+// Changes are collected for the delay, so copying a whole test causes only one reload.
+func (c *testCatalog) watch(delay time.Duration) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return err
+	}
+	if err := c.watchFolders(watcher, c.dir); err != nil {
+		watcher.Close()
+		return err
+	}
+	go func() {
+		defer watcher.Close()
+		var reload <-chan time.Time
+		for {
+			select {
+			case event, ok := <-watcher.Events:
+				if !ok {
+					return
+				}
+				if event.Op&fsnotify.Create != 0 {
+					// fsnotify does not watch subfolders, new ones are added
+					if stat, err := os.Stat(event.Name); err == nil && stat.IsDir() {
+						if err := c.watchFolders(watcher, event.Name); err != nil {
+							LogError("catalog", "Could not watch %s: %s", event.Name, err)
+						}
+					}
+				}
+				if reload == nil {
+					reload = time.After(delay)
+				}
+			case err, ok := <-watcher.Errors:
+				if !ok {
+					return
+				}
+				LogError("catalog", "Error watching tests: %s", err)
+			case <-reload:
+				reload = nil
+				if err := c.load(); err != nil {
+					LogError("catalog", "Could not reload tests: %s", err)
+				}
+			}
+		}
+	}()
+	return nil
+}
+
+// watchFolders adds dir and its subfolders to the watcher, following symbolic links to folders
+func (c *testCatalog) watchFolders(watcher *fsnotify.Watcher, dir string) error {
+	if err := watcher.Add(dir); err != nil {
+		return err
+	}
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		path := filepath.Join(dir, entry.Name())
+		if stat, err := os.Stat(path); err == nil && stat.IsDir() {
+			if err := c.watchFolders(watcher, path); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// writeInvalidTestConfig sends the problems of a test which cannot be executed
+func writeInvalidTestConfig(w http.ResponseWriter, test *catalogTest) {
+	writeError(w, http.StatusInternalServerError, ApiError{
+		Code:    ErrInvalidTestConfig,
+		Message: TestConfigError{Test: test.Ref, Problems: test.Problems}.Error(),
+		Details: map[string]interface{}{"test": filepath.ToSlash(test.Ref), "problems": test.Problems},
+		Phase:   PhaseConfig,
+	})
+}
+
+// CatalogEntry is the state of a test returned by /v2/admin/tests
+type CatalogEntry struct {
+	Test     string          `json:"test"`
+	Valid    bool            `json:"valid"`
+	Problems []ConfigProblem `json:"problems,omitempty"`
+}
+
+// CatalogStatus lists all tests of the catalog with their problems
+type CatalogStatus struct {
+	Loaded time.Time      `json:"loaded"`
+	Tests  []CatalogEntry `json:"tests"`
+}
+
+// handleAdminTests returns all tests including the ones with invalid configuration, only for admins
+func handleAdminTests(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		rejectMethod(w, r, "GET")
+		return
+	}
+	caller, ok := authenticate(w, r, "listing")
+	if !ok {
+		return
+	}
+	if !caller.Admin {
+		writeError(w, http.StatusForbidden, ApiError{Code: ErrUnauthorized, Message: "Only admins can access the test catalog", Phase: PhaseAuth})
+		LogError("listing", "Rejected access to the test catalog by %s", caller.Name)
+		return
+	}
+
+	status := CatalogStatus{Tests: []CatalogEntry{}}
+	catalog.RLock()
+	status.Loaded = catalog.loaded
+	catalog.RUnlock()
+	for _, test := range catalog.list() {
+		status.Tests = append(status.Tests, CatalogEntry{Test: filepath.ToSlash(test.Ref), Valid: test.valid(), Problems: test.Problems})
+	}
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.Encode(status)
+}
@@ -0,0 +1,92 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// problemList formats the problems as "severity field: message" separated by semicolons
+func problemList(problems []ConfigProblem) string {
+	formatted := make([]string, len(problems))
+	for i, problem := range problems {
+		formatted[i] = fmt.Sprintf("%s %s: %s", problem.Severity, problem.Field, problem.Message)
+	}
+	return strings.Join(formatted, "; ")
+}
+
+func TestDecodeTestConfig(t *testing.T) {
+	cases := []struct {
+		name   string
+		config string
+		strict bool
+		want   string // the problems or the error
+	}{
+		{"valid", `{"Compiler":"PythonCompiler","TestType":"IOTest","Timeout":5}`, true, ""},
+		{"case-insensitive", `{"compiler":"PythonCompiler","testType":"IOTest","TIMEOUT":5}`, true, ""},
+		{"all unknown fields", `{"Compiler":"PythonCompiler","Timout":5,"MaxMemory":64,"Test":"IOTest"}`, false,
+			"warning MaxMemory: Unknown field MaxMemory is ignored; warning Test: Unknown field Test is ignored; warning Timout: Unknown field Timout is ignored"},
+		{"strict", `{"Compiler":"PythonCompiler","Timout":5,"MaxMemory":64}`, true,
+			"error MaxMemory: Unknown field MaxMemory; error Timout: Unknown field Timout"},
+		{"nested", `{"Compiler":"PythonCompiler","Security":{"Network":false,"Netwrok":true,"Tmpfs":["/tmp"]}}`, false,
+			"warning Security.Netwrok: Unknown field Security.Netwrok is ignored"},
+		{"invalid JSON", `{"Compiler":"PythonCompiler",}`, false, "invalid character '}' looking for beginning of object key string"},
+		{"invalid enum", `{"Compiler":"RustCompiler"}`, false, "invalid Compiler \"RustCompiler\""},
+	}
+	for _, c := range cases {
+		var got string
+		_, problems, err := decodeTestConfig([]byte(c.config), c.strict)
+		if err != nil {
+			got = err.Error()
+		} else {
+			got = problemList(problems)
+		}
+		if !strings.HasPrefix(got, c.want) || (c.want == "" && got != "") {
+			t.Errorf("%s: got %q, want %q", c.name, got, c.want)
+		}
+	}
+}
+
+func TestFindTestsStrict(t *testing.T) {
+	test := pythonIOTest("py/io")
+	test["py/io/config.json"] = `{"Compiler":"PythonCompiler","TestType":"IOTest","Timout":5}`
+	useCatalog(t, test)
+
+	// the server executes the test and ignores the field, the validate command rejects it
+	for _, strict := range []bool{false, true} {
+		tests, err := findTests(testdataDir, strict)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(tests) != 1 || tests[0].valid() == strict {
+			t.Errorf("strict %v: tests %+v, want one test which is valid: %v", strict, tests, !strict)
+		}
+	}
+}
+
+func TestFindTestsFileProblems(t *testing.T) {
+	useCatalog(t, map[string]string{
+		"py/empty/config.json":  `{"Compiler":"PythonCompiler","TestType":"IOTest"}`,
+		"py/tool/config.json":   `{"Compiler":"PythonCompiler","TestType":"IOTest","CompareTool":"missing"}`,
+		"py/tool/1.out.txt":     "hello\n",
+		"py/unused/config.json": `{"Compiler":"PythonCompiler","TestType":"IOTest"}`,
+		"py/unused/1.out.txt":   "hello\n",
+		"py/unused/2.in.txt":    "hello\n",
+	})
+
+	// the server reports missing and unused files as warnings, the validate command as errors
+	for _, strict := range []bool{false, true} {
+		tests, err := findTests(testdataDir, strict)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(tests) != 3 {
+			t.Fatalf("strict %v: got %d tests, want 3", strict, len(tests))
+		}
+		for _, test := range tests {
+			if test.valid() == strict || len(test.Problems) != 1 {
+				t.Errorf("strict %v: %s has problems %s, want one problem and valid: %v", strict, test.Ref, problemList(test.Problems), !strict)
+			}
+		}
+	}
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+//go:generate jsonenums -type=CompareMode
+
+// CompareMode selects how the output of an IOTest is compared with the expected output, if it has no CompareTool
+type CompareMode int
+
+const (
+	// ExactMatch compares byte by byte, ignoring additional new-line characters at the end
+	ExactMatch CompareMode = iota
+	// IgnoreTrailingWhitespace ignores spaces, tabs and carriage returns at the end of the lines
+	IgnoreTrailingWhitespace
+	// IgnoreWhitespace ignores all whitespace, including line breaks
+	IgnoreWhitespace
+	// IgnoreCase compares like ExactMatch, but case-insensitive
+	IgnoreCase
+	// FloatTolerance compares the words of the output, numbers may differ by CompareAbsTolerance or CompareRelTolerance
+	FloatTolerance
+	// LineRegex matches each line of the output with the regular expression in the same line of the expected output.
+	// Every expected line is a regular expression, literal characters like . or ( must be escaped.
+	LineRegex
+	// UnorderedLines compares the lines in any order
+	UnorderedLines
+	// TokenMatch compares the words of the output, separated by any whitespace
+	TokenMatch
+)
+
+// comparator tells if the output matches the expected output
+type comparator func(expected, output []byte, config TestConfig) (bool, error)
+
+var comparators = map[CompareMode]comparator{
+	ExactMatch:               compareExact,
+	IgnoreTrailingWhitespace: compareTrailingWhitespace,
+	IgnoreWhitespace:         compareWhitespace,
+	IgnoreCase:               compareCase,
+	FloatTolerance:           compareFloats,
+	LineRegex:                compareLineRegex,
+	UnorderedLines:           compareUnorderedLines,
+	TokenMatch:               compareTokens,
+}
+
+// compareFileContentMode compares the files with the CompareMode of the test.
+// Like compareFileContentExactMatch, it returns the expected output and the diff if the files differ.
+func compareFileContentMode(expectedFile, outFile string, config TestConfig) (expectedResult string, testOk bool, diff *OutputDiff, err error) {
+	compare, ok := comparators[config.CompareMode]
+	if !ok {
+		return "", false, nil, fmt.Errorf("unknown CompareMode %d", config.CompareMode)
+	}
+	expected, err := readFile(expectedFile)
+	if err != nil {
+		return "", false, nil, err
+	}
+	output, err := readFile(outFile)
+	if err != nil {
+		return "", false, nil, err
+	}
+
+	ok, err = compare(expected, output, config)
+	if err != nil {
+		return "", false, nil, err
+	}
+	if !ok {
+		return string(expected), false, diffOutput(expected, output, config), nil
+	}
+	return "", true, nil, nil
+}
+
+// exactMatch compares byte by byte, additional new-line characters at the end of one of the contents are ignored
+func exactMatch(expected, output []byte) bool {
+	outputLen := len(output)
+	expectedLen := len(expected)
+	if outputLen != expectedLen {
+		if outputLen > expectedLen && allEndLines(output[expectedLen:]) {
+			outputLen = expectedLen
+		} else if expectedLen > outputLen && allEndLines(expected[outputLen:]) {
+			// all right, shorter len already
+		} else {
+			return false
+		}
+	}
+
+	for i := 0; i < outputLen; i++ {
+		if output[i] != expected[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// contentLines splits the content into lines, without the new-line characters at the end of the content.
+// Lines may end with \n or \r\n.
+func contentLines(content []byte) []string {
+	content = bytes.TrimRight(content, "\r\n")
+	if len(content) == 0 {
+		return []string{}
+	}
+	lines := strings.Split(string(content), "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimSuffix(line, "\r")
+	}
+	return lines
+}
+
+func compareExact(expected, output []byte, config TestConfig) (bool, error) {
+	return exactMatch(expected, output), nil
+}
+
+func compareTrailingWhitespace(expected, output []byte, config TestConfig) (bool, error) {
+	expectedLines, outputLines := contentLines(expected), contentLines(output)
+	if len(expectedLines) != len(outputLines) {
+		return false, nil
+	}
+	for i := range expectedLines {
+		if strings.TrimRight(expectedLines[i], " \t\r") != strings.TrimRight(outputLines[i], " \t\r") {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func compareWhitespace(expected, output []byte, config TestConfig) (bool, error) {
+	return strings.Join(strings.Fields(string(expected)), "") == strings.Join(strings.Fields(string(output)), ""), nil
+}
+
+func compareCase(expected, output []byte, config TestConfig) (bool, error) {
+	return exactMatch(bytes.ToLower(expected), bytes.ToLower(output)), nil
+}
+
+func compareTokens(expected, output []byte, config TestConfig) (bool, error) {
+	expectedTokens, outputTokens := strings.Fields(string(expected)), strings.Fields(string(output))
+	if len(expectedTokens) != len(outputTokens) {
+		return false, nil
+	}
+	for i := range expectedTokens {
+		if expectedTokens[i] != outputTokens[i] {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func compareFloats(expected, output []byte, config TestConfig) (bool, error) {
+	expectedTokens, outputTokens := strings.Fields(string(expected)), strings.Fields(string(output))
+	if len(expectedTokens) != len(outputTokens) {
+		return false, nil
+	}
+	for i := range expectedTokens {
+		if !numbersClose(expectedTokens[i], outputTokens[i], config.CompareAbsTolerance, config.CompareRelTolerance) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+// numbersClose tells if the words are equal or are numbers which differ at most by the absolute or relative tolerance
+func numbersClose(expected, actual string, abs, rel float64) bool {
+	if expected == actual {
+		return true
+	}
+	e, err := strconv.ParseFloat(expected, 64)
+	if err != nil {
+		return false
+	}
+	a, err := strconv.ParseFloat(actual, 64)
+	if err != nil {
+		return false
+	}
+	if math.IsInf(e, 0) || math.IsInf(a, 0) || math.IsNaN(e) || math.IsNaN(a) {
+		// no tolerance for infinite numbers, NaN is only equal to the same word
+		return e == a
+	}
+	diff := math.Abs(e - a)
+	return diff <= abs || diff <= rel*math.Abs(e)
+}
+
+func compareLineRegex(expected, output []byte, config TestConfig) (bool, error) {
+	expectedLines, outputLines := contentLines(expected), contentLines(output)
+	// invalid expressions are reported for any output
+	patterns := make([]*regexp.Regexp, len(expectedLines))
+	for i, line := range expectedLines {
+		// the line is checked on its own, so that it cannot close the group around it, like a)|(b
+		if _, err := regexp.Compile(line); err != nil {
+			return false, fmt.Errorf("line %d of the expected output is no valid regular expression: %s", i+1, err)
+		}
+		patterns[i] = regexp.MustCompile("^(?:" + line + ")$")
+	}
+	if len(expectedLines) != len(outputLines) {
+		return false, nil
+	}
+	for i, re := range patterns {
+		if !re.MatchString(outputLines[i]) {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func compareUnorderedLines(expected, output []byte, config TestConfig) (bool, error) {
+	expectedLines, outputLines := contentLines(expected), contentLines(output)
+	if len(expectedLines) != len(outputLines) {
+		return false, nil
+	}
+	sort.Strings(expectedLines)
+	sort.Strings(outputLines)
+	for i := range expectedLines {
+		if expectedLines[i] != outputLines[i] {
+			return false, nil
+		}
+	}
+	return true, nil
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestComparators(t *testing.T) {
+	cases := []struct {
+		mode     CompareMode
+		expected string
+		output   string
+		ok       bool
+	}{
+		{ExactMatch, "a\nb", "a\nb\n", true},
+		{ExactMatch, "a\nb\n\n", "a\nb", true},
+		{ExactMatch, "a\nb\r\n", "a\nb", true},
+		{ExactMatch, "a\r\nb", "a\nb", false},
+		{ExactMatch, "a \nb", "a\nb", false},
+
+		{IgnoreTrailingWhitespace, "a\nb", "a \t\nb\r\n", true},
+		{IgnoreTrailingWhitespace, "a\r\nb\r\n", "a\nb", true},
+		{IgnoreTrailingWhitespace, "a\nb", " a\nb", false},
+		{IgnoreTrailingWhitespace, "a\n\nb", "a\nb", false},
+
+		{IgnoreWhitespace, "a b\nc", "ab c\r\n", true},
+		{IgnoreWhitespace, "a b", "a c", false},
+
+		{IgnoreCase, "Hello\nWORLD\n", "hello\nworld", true},
+		{IgnoreCase, "Hello", "Hello!", false},
+
+		{TokenMatch, "1 2\n3", "1\t2 3\r\n", true},
+		{TokenMatch, "1 2 3", "1 2", false},
+		{TokenMatch, "12", "1 2", false},
+
+		{FloatTolerance, "x 1.0 2", "x 1.00001 2.0", true},
+		{FloatTolerance, "1.0", "1.1", false},
+		{FloatTolerance, "x", "y", false},
+		{FloatTolerance, "1.0 2.0", "1.0", false},
+
+		{LineRegex, "a+\nb.*", "aaa\nbxyz\n", true},
+		{LineRegex, "a+\r\n", "aa", true},
+		// the regex must match the whole line
+		{LineRegex, "a", "ab", false},
+		{LineRegex, "a|b", "ab", false},
+		// every line is a regular expression, literal characters must be escaped
+		{LineRegex, "1.5", "105", true},
+		{LineRegex, `1\.5`, "105", false},
+		{LineRegex, `\Q(1+2)\E`, "(1+2)", true},
+		{LineRegex, "a\nb", "a", false},
+
+		{UnorderedLines, "a\nb\nc", "c\na\nb\n", true},
+		{UnorderedLines, "a\r\nb\r\n", "b\r\na", true},
+		// duplicate lines must occur as often as expected
+		{UnorderedLines, "a\na\nb", "b\na\na", true},
+		{UnorderedLines, "a\na\nb", "a\nb\nb", false},
+		{UnorderedLines, "a\nb", "a\nb\na", false},
+		{UnorderedLines, "a\nb", "a\n\nb", false},
+	}
+	for _, c := range cases {
+		ok, err := comparators[c.mode]([]byte(c.expected), []byte(c.output), TestConfig{CompareAbsTolerance: 1e-3})
+		if err != nil || ok != c.ok {
+			t.Errorf("mode %v: %q with %q = %v, %v, want %v", c.mode, c.expected, c.output, ok, err, c.ok)
+		}
+	}
+}
+
+func TestCompareFloatsTolerance(t *testing.T) {
+	cases := []struct {
+		expected string
+		output   string
+		abs      float64
+		rel      float64
+		ok       bool
+	}{
+		{"100", "101", 0, 0.01, true},
+		{"100", "102", 0, 0.01, false},
+		{"-100", "-101", 0, 0.01, true},
+		{"100", "101", 1, 0, true},
+		// with an expected 0, the relative tolerance allows no difference
+		{"0", "0.0", 0, 0.01, true},
+		{"0", "1e-9", 0, 0.01, false},
+		{"0", "1e-9", 1e-6, 0.01, true},
+		{"0.0", "-0", 0, 0, true},
+		{"1e3", "1000", 0, 0, true},
+		{"nan", "nan", 0, 0, true},
+		{"inf", "1e308", 0, 0.5, false},
+	}
+	for _, c := range cases {
+		config := TestConfig{CompareAbsTolerance: c.abs, CompareRelTolerance: c.rel}
+		if ok, _ := compareFloats([]byte(c.expected), []byte(c.output), config); ok != c.ok {
+			t.Errorf("%s with %s, abs %v, rel %v = %v, want %v", c.expected, c.output, c.abs, c.rel, ok, c.ok)
+		}
+	}
+}
+
+func TestCompareLineRegexInvalid(t *testing.T) {
+	cases := []struct {
+		expected string
+		err      string
+	}{
+		{"ok\n(", "line 2 of the expected output is no valid regular expression: error parsing regexp: missing closing ): `(`"},
+		// the error is reported, even if the number of lines differs
+		{"a[", "line 1 of the expected output is no valid regular expression: error parsing regexp: missing closing ]: `[`"},
+		// a line must not close the group around it and match only a part of the output line
+		{"x)|(b", "line 1 of the expected output is no valid regular expression: error parsing regexp: unexpected ): `x)|(b`"},
+	}
+	for _, c := range cases {
+		ok, err := compareLineRegex([]byte(c.expected), []byte("ok\nx"), TestConfig{})
+		if ok || err == nil || err.Error() != c.err {
+			t.Errorf("%q: %v, %v, want error %q", c.expected, ok, err, c.err)
+		}
+	}
+}
@@ -1,6 +1,7 @@
 package main
 
 import (
+	"bytes"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -10,6 +11,7 @@ import (
 
 // Compiler types supported by the compiling service
 // install enumer (go get github.com/campoy/jsonenums)
+//
 //go:generate jsonenums -type=Compiler
 type Compiler int
 
@@ -56,6 +58,70 @@ func (c CompilerProviderErr) compile(e Execution) error {
 	return fmt.Errorf("Compiler not supported: %d", c.compiler)
 }
 
+// CompileTimeoutError is returned by the compiler providers if the compiler did not finish in time
+type CompileTimeoutError struct {
+	Timeout int // in seconds
+}
+
+func (e CompileTimeoutError) Error() string {
+	return fmt.Sprintf("Compilation did not finish within %d seconds", e.Timeout)
+}
+
+func isCompileTimeout(err error) bool {
+	_, ok := err.(CompileTimeoutError)
+	return ok
+}
+
+// runCompiler executes a compiler in the sandbox. If compilation fails, the output of the compiler is returned as error.
+func runCompiler(execution Execution, image string, mounts []Mount, command ...string) error {
+	return runCompilerEnv(execution, image, mounts, nil, command...)
+}
+
+// runCompilerEnv is like runCompiler, but sets the given environment variables (KEY=value) for the compiler
+func runCompilerEnv(execution Execution, image string, mounts []Mount, env []string, command ...string) error {
+	timeout := execution.Config.CompileTimeout
+	if timeout == 0 {
+		timeout = 120
+	}
+	maxMem := execution.Config.CompileMaxMem
+	if maxMem == 0 {
+		maxMem = 1024
+	}
+
+	code, err := codeMount(execution.RunDir)
+	if err != nil {
+		return fmt.Errorf("Could not get docker arguments: %s", err)
+	}
+	out := new(bytes.Buffer)
+	res, err := sandbox.Run(SandboxCommand{
+		Name:        execution.ID,
+		Image:       image,
+		Command:     command,
+		WorkDir:     "/code",
+		Mounts:      append([]Mount{code}, mounts...),
+		Env:         env,
+		Stdout:      out,
+		Stderr:      out,
+		StdoutLimit: 1024 * 1024,
+		MaxMem:      maxMem,
+		Timeout:     time.Duration(timeout) * time.Second,
+		Security:    execution.securityProfile(),
+	})
+	if err != nil {
+		return fmt.Errorf("Error compiling:\n%s\n%s", string(out.Bytes()), err)
+	}
+	if res.TimedOut {
+		return CompileTimeoutError{Timeout: timeout}
+	}
+	if res.OOMKilled {
+		return fmt.Errorf("Error compiling:\n%s\nMemory limit of %d MB exceeded", string(out.Bytes()), maxMem)
+	}
+	if res.ExitCode != 0 {
+		return fmt.Errorf("Error compiling:\n%s", string(out.Bytes()))
+	}
+	return nil
+}
+
 func copyResources(execution Execution) error {
 	if debug {
 		Debug.Print("Copying resources")
@@ -134,7 +200,8 @@ func fileExists(f string) bool {
 
 func compileService() {
 	for {
-		execution := <-compileChannel
+		execution := compileQueue.pop()
+		close(execution.Started)
 
 		if debug {
 			Debug.Printf("Compiling: %+v\n", execution)
@@ -145,12 +212,13 @@ func compileService() {
 		copyResources(execution)
 
 		if execution.AnalysisChan != nil {
-			analysisChannel <- execution
+			analysisQueue.push(execution)
 		}
 		if execution.ClocChan != nil {
-			metricChannel <- execution
+			metricQueue.push(execution)
 		}
 
+		execution.report(ProgressEvent{Type: EventCompiling})
 		startTime := time.Now()
 		err = compilerProvider(execution.Config.Compiler).compile(execution)
 		duration := time.Since(startTime)
@@ -159,14 +227,20 @@ func compileService() {
 		}
 		if err != nil {
 			compileErrorCounter.Inc()
+			if isCompileTimeout(err) {
+				compileTimeoutCounter.Inc()
+			}
+			execution.report(ProgressEvent{Type: EventCompileError, Message: err.Error()})
 			execution.ResChan <- TestResult{
-				ID:           execution.ID,
-				Compiled:     false,
-				CompileError: err.Error(),
+				ID:             execution.ID,
+				Compiled:       false,
+				CompileError:   err.Error(),
+				CompileTimeout: isCompileTimeout(err),
+				Error:          compileApiError(err),
 			}
 			continue
 		}
-		metricChannel <- execution
-		testChannel <- execution
+		execution.report(ProgressEvent{Type: EventCompiled})
+		testQueue.push(execution)
 	}
 }
@@ -0,0 +1,84 @@
+package main
+
+import (
+	"errors"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRunCompiler(t *testing.T) {
+	cases := []struct {
+		name    string
+		output  string
+		result  SandboxResult
+		runErr  error
+		wantErr string
+		timeout bool
+	}{
+		{name: "success", result: SandboxResult{ExitCode: 0}},
+		{name: "compile error", output: "SyntaxError: invalid syntax", result: SandboxResult{ExitCode: 1}, wantErr: "SyntaxError: invalid syntax"},
+		{name: "timeout", result: SandboxResult{ExitCode: -1, TimedOut: true}, wantErr: "Compilation did not finish within 120 seconds", timeout: true},
+		{name: "memory", output: "killed", result: SandboxResult{ExitCode: 137, OOMKilled: true}, wantErr: "Memory limit of 1024 MB exceeded"},
+		{name: "sandbox error", runErr: errors.New("no such image"), wantErr: "no such image"},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			fake := &fakeSandbox{run: func(cmd SandboxCommand) (SandboxResult, error) {
+				writeOutput(cmd.Stdout, cmd.StdoutLimit, c.output)
+				return c.result, c.runErr
+			}}
+			useSandbox(t, fake)
+
+			execution := Execution{ID: "run", RunDir: t.TempDir()}
+			err := runCompiler(execution, "python-image", nil, "python3", "-m", "py_compile", "main.py")
+			if c.wantErr == "" {
+				if err != nil {
+					t.Fatalf("unexpected error: %s", err)
+				}
+			} else if err == nil || !strings.Contains(err.Error(), c.wantErr) {
+				t.Fatalf("error %v does not contain %q", err, c.wantErr)
+			}
+			if isCompileTimeout(err) != c.timeout {
+				t.Errorf("isCompileTimeout = %v, want %v", !c.timeout, c.timeout)
+			}
+
+			if len(fake.commands) != 1 {
+				t.Fatalf("%d commands executed, want 1", len(fake.commands))
+			}
+			cmd := fake.commands[0]
+			if cmd.Name != "run" || cmd.Image != "python-image" || cmd.WorkDir != "/code" {
+				t.Errorf("unexpected command %+v", cmd)
+			}
+			if strings.Join(cmd.Command, " ") != "python3 -m py_compile main.py" {
+				t.Errorf("command = %v", cmd.Command)
+			}
+			if len(cmd.Mounts) != 1 || cmd.Mounts[0].Target != "/code" {
+				t.Errorf("mounts = %+v, want the run directory in /code", cmd.Mounts)
+			}
+			if cmd.Timeout != 120*time.Second || cmd.MaxMem != 1024 {
+				t.Errorf("limits = %s, %d MB, want the default compile limits", cmd.Timeout, cmd.MaxMem)
+			}
+			if cmd.Security == nil || cmd.Security.ReadOnly == nil || !*cmd.Security.ReadOnly {
+				t.Errorf("security profile %+v is not the default profile", cmd.Security)
+			}
+		})
+	}
+}
+
+func TestRunCompilerEnv(t *testing.T) {
+	fake := &fakeSandbox{}
+	useSandbox(t, fake)
+
+	execution := Execution{ID: "run", RunDir: t.TempDir(), Config: TestConfig{CompileTimeout: 30, CompileMaxMem: 2048}}
+	if err := runCompilerEnv(execution, "fsharp-image", nil, dotnetEnv, "dotnet", "build"); err != nil {
+		t.Fatal(err)
+	}
+	cmd := fake.commands[0]
+	if strings.Join(cmd.Env, " ") != strings.Join(dotnetEnv, " ") {
+		t.Errorf("env = %v, want %v", cmd.Env, dotnetEnv)
+	}
+	if cmd.Timeout != 30*time.Second || cmd.MaxMem != 2048 {
+		t.Errorf("limits = %s, %d MB, want the limits of the test", cmd.Timeout, cmd.MaxMem)
+	}
+}
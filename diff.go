@@ -0,0 +1,338 @@
+package main
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+	"unicode/utf8"
+)
+
+// limits of the diff of a failed IO test case
+const (
+	// diffContext is the number of unchanged lines around the changes of a hunk
+	diffContext = 3
+	// diffMaxLines is the maximum number of lines of all hunks
+	diffMaxLines = 200
+	// diffMaxCells limits the table of the longest common subsequence, larger changes are shown as replaced as a whole
+	diffMaxCells = 1 << 20
+	// diffMaxRegexCells is the smaller limit for LineRegex, which matches a regular expression for every cell
+	diffMaxRegexCells = 1 << 16
+)
+
+// OutputDiff describes where the output of an IO test case differs from the expected output
+type OutputDiff struct {
+	// Line and Column (starting with 1) of the first difference in the output,
+	// omitted for UnorderedLines, whose lines are compared in sorted order
+	Line   int `json:"line,omitempty"`
+	Column int `json:"column,omitempty"`
+	// Whitespace tells that the outputs only differ in whitespace.
+	// The lines of the hunks then show carriage returns as ␍, tabs as → and trailing spaces as ·.
+	Whitespace bool       `json:"whitespace,omitempty"`
+	Hunks      []DiffHunk `json:"hunks"`
+	// Truncated tells that the hunks were cut off after diffMaxLines lines
+	Truncated bool `json:"truncated,omitempty"`
+}
+
+// DiffHunk is a part of a unified diff, the start lines begin with 1.
+// As in unified diffs, a side without lines starts at the line before the hunk, i.e. 0 (omitted) at the beginning.
+// The start lines are omitted for UnorderedLines, as the hunks show the sorted lines.
+type DiffHunk struct {
+	ExpectedStart int `json:"expected_start,omitempty"`
+	ExpectedLines int `json:"expected_lines"`
+	OutputStart   int `json:"output_start,omitempty"`
+	OutputLines   int `json:"output_lines"`
+	// Lines start with " " for unchanged lines, "-" for lines of the expected output and "+" for lines of the output
+	Lines []string `json:"lines"`
+}
+
+// diffOp is a step of the edit script, e and o are the current lines of the expected output and of the output
+type diffOp struct {
+	kind byte
+	e, o int
+}
+
+// diffOutput compares the lines of the outputs in the same way as the CompareMode of the test
+func diffOutput(expected, output []byte, config TestConfig) *OutputDiff {
+	expectedLines, outputLines := diffLines(expected), diffLines(output)
+	if config.CompareMode == UnorderedLines {
+		sort.Strings(expectedLines)
+		sort.Strings(outputLines)
+	}
+	equal := lineEquality(config, expectedLines, outputLines)
+	maxCells := diffMaxCells
+	if config.CompareMode == LineRegex {
+		maxCells = diffMaxRegexCells
+	}
+	ops := diffOps(len(expectedLines), len(outputLines), equal, maxCells)
+
+	diff := &OutputDiff{
+		Whitespace: strings.Join(strings.Fields(string(expected)), "") == strings.Join(strings.Fields(string(output)), ""),
+	}
+	diff.Hunks, diff.Truncated = diffHunks(ops, expectedLines, outputLines, diff.Whitespace)
+	if config.CompareMode == UnorderedLines {
+		// the positions in the sorted lines do not locate anything in the output
+		for i := range diff.Hunks {
+			diff.Hunks[i].ExpectedStart, diff.Hunks[i].OutputStart = 0, 0
+		}
+		return diff
+	}
+	diff.Line, diff.Column = firstChange(ops, expectedLines, outputLines, config)
+	if diff.Line == 0 {
+		// the lines are equal, but the outputs differ in the line breaks at the end
+		diff.Line, diff.Column = firstDifference(expected, output)
+	}
+	return diff
+}
+
+// diffLines splits the content into lines, keeping carriage returns to show them in the diff
+func diffLines(content []byte) []string {
+	text := strings.TrimRight(string(content), "\n")
+	if text == "" {
+		return []string{}
+	}
+	return strings.Split(text, "\n")
+}
+
+// lineEquality returns a function telling if line i of the expected output and line j of the output match with the CompareMode
+func lineEquality(config TestConfig, expected, output []string) func(i, j int) bool {
+	var key func(string) string
+	switch config.CompareMode {
+	case IgnoreTrailingWhitespace:
+		key = func(line string) string { return strings.TrimRight(line, " \t\r") }
+	case IgnoreWhitespace:
+		key = func(line string) string { return strings.Join(strings.Fields(line), "") }
+	case IgnoreCase:
+		key = strings.ToLower
+	case TokenMatch:
+		key = func(line string) string { return strings.Join(strings.Fields(line), " ") }
+	case FloatTolerance:
+		return func(i, j int) bool {
+			expectedTokens, outputTokens := strings.Fields(expected[i]), strings.Fields(output[j])
+			if len(expectedTokens) != len(outputTokens) {
+				return false
+			}
+			for k := range expectedTokens {
+				if !numbersClose(expectedTokens[k], outputTokens[k], config.CompareAbsTolerance, config.CompareRelTolerance) {
+					return false
+				}
+			}
+			return true
+		}
+	case LineRegex:
+		patterns := make([]*regexp.Regexp, len(expected))
+		for i, line := range expected {
+			patterns[i], _ = regexp.Compile("^(?:" + line + ")$")
+		}
+		return func(i, j int) bool {
+			return patterns[i] != nil && patterns[i].MatchString(output[j])
+		}
+	default:
+		key = func(line string) string { return line }
+	}
+	expectedKeys, outputKeys := make([]string, len(expected)), make([]string, len(output))
+	for i, line := range expected {
+		expectedKeys[i] = key(line)
+	}
+	for j, line := range output {
+		outputKeys[j] = key(line)
+	}
+	return func(i, j int) bool { return expectedKeys[i] == outputKeys[j] }
+}
+
+// diffOps computes the edit script from the longest common subsequence of the lines,
+// if the table of the changed lines has at most maxCells cells
+func diffOps(n, m int, equal func(i, j int) bool, maxCells int) []diffOp {
+	prefix := 0
+	for prefix < n && prefix < m && equal(prefix, prefix) {
+		prefix++
+	}
+	suffix := 0
+	for suffix < n-prefix && suffix < m-prefix && equal(n-1-suffix, m-1-suffix) {
+		suffix++
+	}
+
+	ops := make([]diffOp, 0, n+m)
+	for i := 0; i < prefix; i++ {
+		ops = append(ops, diffOp{' ', i, i})
+	}
+	en, om := n-prefix-suffix, m-prefix-suffix
+	i, j := 0, 0
+	if en > 0 && om > 0 && en*om <= maxCells {
+		// lcs[i][j] is the length of the longest common subsequence of the lines from i and j on
+		lcs := make([][]int32, en+1)
+		for i := range lcs {
+			lcs[i] = make([]int32, om+1)
+		}
+		for i := en - 1; i >= 0; i-- {
+			for j := om - 1; j >= 0; j-- {
+				if equal(prefix+i, prefix+j) {
+					lcs[i][j] = lcs[i+1][j+1] + 1
+				} else if lcs[i+1][j] >= lcs[i][j+1] {
+					lcs[i][j] = lcs[i+1][j]
+				} else {
+					lcs[i][j] = lcs[i][j+1]
+				}
+			}
+		}
+		for i < en && j < om {
+			if equal(prefix+i, prefix+j) {
+				ops = append(ops, diffOp{' ', prefix + i, prefix + j})
+				i++
+				j++
+			} else if lcs[i+1][j] >= lcs[i][j+1] {
+				ops = append(ops, diffOp{'-', prefix + i, prefix + j})
+				i++
+			} else {
+				ops = append(ops, diffOp{'+', prefix + i, prefix + j})
+				j++
+			}
+		}
+	}
+	for ; i < en; i++ {
+		ops = append(ops, diffOp{'-', prefix + i, prefix + j})
+	}
+	for ; j < om; j++ {
+		ops = append(ops, diffOp{'+', prefix + i, prefix + j})
+	}
+	for k := 0; k < suffix; k++ {
+		ops = append(ops, diffOp{' ', n - suffix + k, m - suffix + k})
+	}
+	return ops
+}
+
+// diffHunks groups the changes with diffContext unchanged lines around them
+func diffHunks(ops []diffOp, expected, output []string, visible bool) ([]DiffHunk, bool) {
+	show := func(line string) string { return line }
+	if visible {
+		show = visibleWhitespace
+	}
+	hunks := []DiffHunk{}
+	total := 0
+	for k := 0; k < len(ops); {
+		if ops[k].kind == ' ' {
+			k++
+			continue
+		}
+		if total == diffMaxLines {
+			return hunks, true
+		}
+		start := k - diffContext
+		if start < 0 {
+			start = 0
+		}
+		// changes separated by at most twice the context are in the same hunk
+		end := k
+		for end < len(ops) {
+			if ops[end].kind != ' ' {
+				end++
+				continue
+			}
+			next := end
+			for next < len(ops) && ops[next].kind == ' ' {
+				next++
+			}
+			if next == len(ops) || next-end > 2*diffContext {
+				break
+			}
+			end = next
+		}
+		stop := end + diffContext
+		if stop > len(ops) {
+			stop = len(ops)
+		}
+
+		hunk := DiffHunk{ExpectedStart: ops[start].e + 1, OutputStart: ops[start].o + 1}
+		for _, op := range ops[start:stop] {
+			if total == diffMaxLines {
+				return append(hunks, hunk.emptyStarts()), true
+			}
+			switch op.kind {
+			case ' ':
+				hunk.Lines = append(hunk.Lines, " "+show(output[op.o]))
+				hunk.ExpectedLines++
+				hunk.OutputLines++
+			case '-':
+				hunk.Lines = append(hunk.Lines, "-"+show(expected[op.e]))
+				hunk.ExpectedLines++
+			case '+':
+				hunk.Lines = append(hunk.Lines, "+"+show(output[op.o]))
+				hunk.OutputLines++
+			}
+			total++
+		}
+		hunks = append(hunks, hunk.emptyStarts())
+		k = stop
+	}
+	return hunks, false
+}
+
+// emptyStarts moves the start of a side without lines to the line before the hunk, as unified diffs do
+func (h DiffHunk) emptyStarts() DiffHunk {
+	if h.ExpectedLines == 0 {
+		h.ExpectedStart--
+	}
+	if h.OutputLines == 0 {
+		h.OutputStart--
+	}
+	return h
+}
+
+// firstChange returns the line and column of the output where the first change starts, 0 if there is none
+func firstChange(ops []diffOp, expected, output []string, config TestConfig) (int, int) {
+	for k, op := range ops {
+		if op.kind == ' ' {
+			continue
+		}
+		// a changed line is a removed line of the expected output followed by an added line of the output
+		if op.kind == '-' {
+			for _, next := range ops[k+1:] {
+				if next.kind == ' ' {
+					break
+				}
+				if next.kind == '+' {
+					e, o := expected[op.e], output[next.o]
+					if config.CompareMode == IgnoreCase {
+						e, o = strings.ToLower(e), strings.ToLower(o)
+					}
+					return next.o + 1, firstDifferentColumn(e, o)
+				}
+			}
+		}
+		return op.o + 1, 1
+	}
+	return 0, 0
+}
+
+// firstDifferentColumn returns the column (in characters, starting with 1) of the first difference of the lines
+func firstDifferentColumn(a, b string) int {
+	column := 1
+	for len(a) > 0 && len(b) > 0 {
+		ra, sizeA := utf8.DecodeRuneInString(a)
+		rb, sizeB := utf8.DecodeRuneInString(b)
+		if ra != rb {
+			break
+		}
+		a, b = a[sizeA:], b[sizeB:]
+		column++
+	}
+	return column
+}
+
+// firstDifference returns the line and column of the first byte which differs
+func firstDifference(expected, output []byte) (int, int) {
+	i := 0
+	for i < len(expected) && i < len(output) && expected[i] == output[i] {
+		i++
+	}
+	line := 1 + strings.Count(string(output[:i]), "\n")
+	lineStart := strings.LastIndexByte(string(output[:i]), '\n') + 1
+	return line, 1 + utf8.RuneCount(output[lineStart:i])
+}
+
+// visibleWhitespace shows carriage returns, tabs and trailing spaces of a line
+func visibleWhitespace(line string) string {
+	content := strings.TrimRight(line, " \t\r")
+	trailing := line[len(content):]
+	content = strings.NewReplacer("\r", "␍", "\t", "→").Replace(content)
+	return content + strings.NewReplacer("\r", "␍", "\t", "→", " ", "·").Replace(trailing)
+}
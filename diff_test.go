@@ -0,0 +1,87 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+func TestDiffOutput(t *testing.T) {
+	diff := diffOutput([]byte("1\n2\n3\n4\n"), []byte("1\n2\nx3\n4\n"), TestConfig{})
+	if diff.Line != 3 || diff.Column != 1 {
+		t.Errorf("difference at %d:%d, want 3:1", diff.Line, diff.Column)
+	}
+	want := []DiffHunk{{ExpectedStart: 1, ExpectedLines: 4, OutputStart: 1, OutputLines: 4, Lines: []string{" 1", " 2", "-3", "+x3", " 4"}}}
+	if fmt.Sprint(diff.Hunks) != fmt.Sprint(want) {
+		t.Errorf("hunks %v, want %v", diff.Hunks, want)
+	}
+}
+
+func TestDiffOutputUnorderedLines(t *testing.T) {
+	diff := diffOutput([]byte("c\na\nb\n"), []byte("b\nc\nd\n"), TestConfig{CompareMode: UnorderedLines})
+	// the sorted lines are compared, their positions are omitted
+	if diff.Line != 0 || diff.Column != 0 {
+		t.Errorf("difference at %d:%d in the sorted lines", diff.Line, diff.Column)
+	}
+	want := []DiffHunk{{ExpectedLines: 3, OutputLines: 3, Lines: []string{"-a", " b", " c", "+d"}}}
+	if fmt.Sprint(diff.Hunks) != fmt.Sprint(want) {
+		t.Errorf("hunks %v, want %v", diff.Hunks, want)
+	}
+}
+
+func TestDiffHunksLimit(t *testing.T) {
+	// the first hunk has exactly diffMaxLines lines with its context, the second change is not shown
+	removed := diffMaxLines - diffContext
+	expected := strings.Split(strings.Repeat("x\n", removed+2*diffContext+2), "\n")
+	output := strings.Split(strings.Repeat("x\n", 2*diffContext+1), "\n")
+	ops := []diffOp{}
+	for i := 0; i < removed; i++ {
+		ops = append(ops, diffOp{'-', i, 0})
+	}
+	for j := 0; j <= 2*diffContext; j++ {
+		ops = append(ops, diffOp{' ', removed + j, j})
+	}
+	ops = append(ops, diffOp{'-', removed + 2*diffContext + 1, 2*diffContext + 1})
+
+	hunks, truncated := diffHunks(ops, expected, output, false)
+	if !truncated || len(hunks) != 1 || len(hunks[0].Lines) != diffMaxLines {
+		lines := make([]int, len(hunks))
+		for i, hunk := range hunks {
+			lines[i] = len(hunk.Lines)
+		}
+		t.Errorf("hunks with %v lines, truncated %v, want one hunk with %d lines", lines, truncated, diffMaxLines)
+	}
+}
+
+func TestDiffOutputEmptySide(t *testing.T) {
+	// as in unified diffs, an empty side starts at line 0
+	cases := []struct {
+		expected, output string
+		want             DiffHunk
+	}{
+		{"", "a\n", DiffHunk{ExpectedStart: 0, ExpectedLines: 0, OutputStart: 1, OutputLines: 1, Lines: []string{"+a"}}},
+		{"a\nb\n", "", DiffHunk{ExpectedStart: 1, ExpectedLines: 2, OutputStart: 0, OutputLines: 0, Lines: []string{"-a", "-b"}}},
+	}
+	for _, c := range cases {
+		diff := diffOutput([]byte(c.expected), []byte(c.output), TestConfig{})
+		if len(diff.Hunks) != 1 || fmt.Sprint(diff.Hunks[0]) != fmt.Sprint(c.want) {
+			t.Errorf("%q and %q: hunks %v, want %v", c.expected, c.output, diff.Hunks, c.want)
+		}
+	}
+}
+
+func TestDiffOpsMaxCells(t *testing.T) {
+	// with more than maxCells cells, the lines are replaced as a whole without comparing all of them
+	n := 300
+	calls := 0
+	ops := diffOps(n, n, func(i, j int) bool {
+		calls++
+		return false
+	}, diffMaxRegexCells)
+	if calls > 2 {
+		t.Errorf("%d comparisons, want at most 2 for the common prefix and suffix", calls)
+	}
+	if len(ops) != 2*n || ops[0].kind != '-' || ops[n].kind != '+' {
+		t.Errorf("%d ops, want %d removed lines followed by %d added lines", len(ops), n, n)
+	}
+}
@@ -0,0 +1,304 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/url"
+)
+
+// version of the Docker Engine API used by the client (supported since Docker 19.03)
+const dockerApiVersion = "v1.40"
+
+// dockerClient talks to the Docker Engine API over a unix socket
+type dockerClient struct {
+	socket string
+	http   *http.Client
+}
+
+func newDockerClient(socket string) *dockerClient {
+	dial := func(ctx context.Context, _, _ string) (net.Conn, error) {
+		var d net.Dialer
+		return d.DialContext(ctx, "unix", socket)
+	}
+	return &dockerClient{
+		socket: socket,
+		http:   &http.Client{Transport: &http.Transport{DialContext: dial}},
+	}
+}
+
+type dockerHostConfig struct {
+	Binds          []string          `json:",omitempty"`
+	Memory         int64             `json:",omitempty"`
+	NetworkMode    string            `json:",omitempty"`
+	ReadonlyRootfs bool              `json:",omitempty"`
+	Tmpfs          map[string]string `json:",omitempty"`
+	PidsLimit      int64             `json:",omitempty"`
+	NanoCpus       int64             `json:",omitempty"`
+	CapDrop        []string          `json:",omitempty"`
+	SecurityOpt    []string          `json:",omitempty"`
+}
+
+type dockerContainerConfig struct {
+	Image        string
+	Cmd          []string
+	User         string            `json:",omitempty"`
+	WorkingDir   string            `json:",omitempty"`
+	Env          []string          `json:",omitempty"`
+	Labels       map[string]string `json:",omitempty"`
+	AttachStdin  bool
+	AttachStdout bool
+	AttachStderr bool
+	OpenStdin    bool
+	StdinOnce    bool
+	Tty          bool
+	HostConfig   dockerHostConfig
+}
+
+type dockerContainerState struct {
+	Running   bool
+	OOMKilled bool
+	ExitCode  int
+}
+
+// dockerApiError is returned if the Docker Engine answers with an error status
+type dockerApiError struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *dockerApiError) Error() string {
+	return fmt.Sprintf("Docker API error %d: %s", e.StatusCode, e.Message)
+}
+
+// do sends a request to the Docker Engine and decodes the JSON answer into result (if not nil)
+func (c *dockerClient) do(ctx context.Context, method string, path string, query url.Values, body interface{}, result interface{}) error {
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return err
+		}
+		reqBody = bytes.NewReader(data)
+	}
+	u := "http://docker/" + dockerApiVersion + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequest(method, u, reqBody)
+	if err != nil {
+		return err
+	}
+	req = req.WithContext(ctx)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		var apiErr struct {
+			Message string `json:"message"`
+		}
+		data, _ := ioutil.ReadAll(resp.Body)
+		if json.Unmarshal(data, &apiErr) != nil {
+			apiErr.Message = string(data)
+		}
+		return &dockerApiError{StatusCode: resp.StatusCode, Message: apiErr.Message}
+	}
+	if result != nil {
+		return json.NewDecoder(resp.Body).Decode(result)
+	}
+	return nil
+}
+
+func (c *dockerClient) createContainer(ctx context.Context, name string, config dockerContainerConfig) (string, error) {
+	var created struct {
+		Id string
+	}
+	err := c.do(ctx, "POST", "/containers/create", url.Values{"name": {name}}, config, &created)
+	return created.Id, err
+}
+
+func (c *dockerClient) startContainer(ctx context.Context, id string) error {
+	return c.do(ctx, "POST", "/containers/"+id+"/start", nil, nil, nil)
+}
+
+// waitContainer blocks until the container stops and returns its exit code
+func (c *dockerClient) waitContainer(ctx context.Context, id string) (int, error) {
+	var status struct {
+		StatusCode int
+	}
+	err := c.do(ctx, "POST", "/containers/"+id+"/wait", nil, nil, &status)
+	return status.StatusCode, err
+}
+
+func (c *dockerClient) killContainer(ctx context.Context, id string) error {
+	return c.do(ctx, "POST", "/containers/"+id+"/kill", nil, nil, nil)
+}
+
+func (c *dockerClient) inspectContainer(ctx context.Context, id string) (dockerContainerState, error) {
+	var info struct {
+		State dockerContainerState
+	}
+	err := c.do(ctx, "GET", "/containers/"+id+"/json", nil, nil, &info)
+	return info.State, err
+}
+
+func (c *dockerClient) removeContainer(ctx context.Context, id string) error {
+	return c.do(ctx, "DELETE", "/containers/"+id, url.Values{"force": {"true"}}, nil, nil)
+}
+
+// listContainers returns the ids of all containers with the given label value
+func (c *dockerClient) listContainers(ctx context.Context, label string, value string) ([]string, error) {
+	filters, err := json.Marshal(map[string][]string{"label": {label + "=" + value}})
+	if err != nil {
+		return nil, err
+	}
+	var containers []struct {
+		Id string
+	}
+	err = c.do(ctx, "GET", "/containers/json", url.Values{"all": {"true"}, "filters": {string(filters)}}, nil, &containers)
+	if err != nil {
+		return nil, err
+	}
+	ids := make([]string, 0, len(containers))
+	for _, container := range containers {
+		ids = append(ids, container.Id)
+	}
+	return ids, nil
+}
+
+// attachContainer attaches to stdin, stdout and stderr of a created container.
+// The returned connection is hijacked from the HTTP connection: writing to it sends data to stdin,
+// the reader returns the multiplexed output stream (see demultiplexOutput).
+func (c *dockerClient) attachContainer(ctx context.Context, id string, stdin bool) (net.Conn, *bufio.Reader, error) {
+	query := url.Values{"stream": {"1"}, "stdout": {"1"}, "stderr": {"1"}}
+	if stdin {
+		query.Set("stdin", "1")
+	}
+	return c.hijack(ctx, "/containers/"+id+"/attach", query, nil)
+}
+
+type dockerExecConfig struct {
+	AttachStdin  bool
+	AttachStdout bool
+	AttachStderr bool
+	Cmd          []string
+	Env          []string `json:",omitempty"`
+	WorkingDir   string   `json:",omitempty"`
+}
+
+type dockerExecState struct {
+	Running  bool
+	ExitCode int
+}
+
+// createExec creates a command in the running container, which is started with startExec
+func (c *dockerClient) createExec(ctx context.Context, id string, config dockerExecConfig) (string, error) {
+	var created struct {
+		Id string
+	}
+	err := c.do(ctx, "POST", "/containers/"+id+"/exec", nil, config, &created)
+	return created.Id, err
+}
+
+// startExec starts a created command and attaches to it like attachContainer
+func (c *dockerClient) startExec(ctx context.Context, id string) (net.Conn, *bufio.Reader, error) {
+	return c.hijack(ctx, "/exec/"+id+"/start", nil, map[string]bool{"Detach": false, "Tty": false})
+}
+
+// inspectExec returns the state of a command, the exit code is available when it is not running any more
+func (c *dockerClient) inspectExec(ctx context.Context, id string) (dockerExecState, error) {
+	var state dockerExecState
+	err := c.do(ctx, "GET", "/exec/"+id+"/json", nil, nil, &state)
+	return state, err
+}
+
+// hijack sends a POST request upgrading the connection to a raw stream of the container
+func (c *dockerClient) hijack(ctx context.Context, path string, query url.Values, body interface{}) (net.Conn, *bufio.Reader, error) {
+	var reqBody io.Reader
+	if body != nil {
+		data, err := json.Marshal(body)
+		if err != nil {
+			return nil, nil, err
+		}
+		reqBody = bytes.NewReader(data)
+	}
+	var d net.Dialer
+	conn, err := d.DialContext(ctx, "unix", c.socket)
+	if err != nil {
+		return nil, nil, err
+	}
+	u := "http://docker/" + dockerApiVersion + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequest("POST", u, reqBody)
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "tcp")
+	if err := req.Write(conn); err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	reader := bufio.NewReader(conn)
+	resp, err := http.ReadResponse(reader, req)
+	if err != nil {
+		conn.Close()
+		return nil, nil, err
+	}
+	if resp.StatusCode != http.StatusSwitchingProtocols && resp.StatusCode != http.StatusOK {
+		resp.Body.Close()
+		conn.Close()
+		return nil, nil, &dockerApiError{StatusCode: resp.StatusCode, Message: "could not attach to " + path}
+	}
+	return conn, reader, nil
+}
+
+// demultiplexOutput splits the output stream of a container without tty into stdout and stderr.
+// Each frame starts with a header containing the stream type (1 = stdout, 2 = stderr) and the length of the frame.
+func demultiplexOutput(r io.Reader, stdout io.Writer, stderr io.Writer) error {
+	header := make([]byte, 8)
+	for {
+		if _, err := io.ReadFull(r, header); err != nil {
+			if err == io.EOF {
+				return nil
+			}
+			return err
+		}
+		var w io.Writer
+		switch header[0] {
+		case 1:
+			w = stdout
+		case 2:
+			w = stderr
+		}
+		if w == nil {
+			w = ioutil.Discard
+		}
+		size := int64(binary.BigEndian.Uint32(header[4:]))
+		if _, err := io.CopyN(w, r, size); err != nil {
+			if err == io.EOF {
+				// the stream ended inside of a frame
+				return io.ErrUnexpectedEOF
+			}
+			return err
+		}
+	}
+}
@@ -0,0 +1,398 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeContainer is a container of fakeDockerEngine. The first word of its command selects what it does:
+// "echo" copies stdin to stdout, "fail" writes to stderr and exits with 2,
+// "oom" is killed for exceeding its memory and "hang" runs until it is killed.
+type fakeContainer struct {
+	id        string
+	name      string
+	config    dockerContainerConfig
+	conn      net.Conn
+	stdin     *bufio.Reader
+	attached  chan struct{}
+	killed    chan struct{}
+	stopped   chan struct{}
+	exitCode  int
+	oomKilled bool
+}
+
+// fakeDockerEngine answers the requests of dockerClient on a unix socket like the Docker Engine API
+type fakeDockerEngine struct {
+	sync.Mutex
+	server     *httptest.Server
+	socket     string
+	containers map[string]*fakeContainer
+	requests   []string
+	nextId     int
+}
+
+func newFakeDockerEngine(t *testing.T) *fakeDockerEngine {
+	dir, err := ioutil.TempDir("", "docker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.RemoveAll(dir) })
+	e := &fakeDockerEngine{socket: filepath.Join(dir, "docker.sock"), containers: make(map[string]*fakeContainer)}
+	listener, err := net.Listen("unix", e.socket)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e.server = httptest.NewUnstartedServer(http.HandlerFunc(e.handle))
+	e.server.Listener = listener
+	e.server.Start()
+	t.Cleanup(e.server.Close)
+	return e
+}
+
+// container returns the container with the given id or name
+func (e *fakeDockerEngine) container(ref string) *fakeContainer {
+	e.Lock()
+	defer e.Unlock()
+	for _, c := range e.containers {
+		if c.id == ref || c.name == ref {
+			return c
+		}
+	}
+	return nil
+}
+
+// requested returns the requests without the API version and the container ids, e.g. "POST /containers/start"
+func (e *fakeDockerEngine) requested() []string {
+	e.Lock()
+	defer e.Unlock()
+	return append([]string(nil), e.requests...)
+}
+
+func (e *fakeDockerEngine) handle(w http.ResponseWriter, r *http.Request) {
+	path := strings.TrimPrefix(r.URL.Path, "/"+dockerApiVersion)
+	parts := strings.Split(strings.Trim(path, "/"), "/")
+	action := ""
+	if len(parts) == 3 || path == "/containers/create" {
+		action = "/" + parts[len(parts)-1]
+	}
+	e.Lock()
+	e.requests = append(e.requests, r.Method+" /"+parts[0]+action)
+	e.Unlock()
+
+	if path == "/containers/create" {
+		e.create(w, r)
+		return
+	}
+	if len(parts) < 2 || parts[0] != "containers" {
+		writeDockerError(w, http.StatusNotFound, "page not found")
+		return
+	}
+	c := e.container(parts[1])
+	if c == nil {
+		writeDockerError(w, http.StatusNotFound, "No such container: "+parts[1])
+		return
+	}
+	switch r.Method + " " + action {
+	case "POST /attach":
+		e.attach(w, c)
+	case "POST /start":
+		go c.run()
+		w.WriteHeader(http.StatusNoContent)
+	case "POST /wait":
+		select {
+		case <-c.stopped:
+			json.NewEncoder(w).Encode(map[string]int{"StatusCode": c.exitCode})
+		case <-r.Context().Done():
+		}
+	case "POST /kill":
+		close(c.killed)
+		w.WriteHeader(http.StatusNoContent)
+	case "GET /json":
+		json.NewEncoder(w).Encode(map[string]dockerContainerState{"State": {OOMKilled: c.oomKilled, ExitCode: c.exitCode}})
+	case "DELETE ":
+		e.Lock()
+		delete(e.containers, c.id)
+		e.Unlock()
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		writeDockerError(w, http.StatusNotFound, "page not found")
+	}
+}
+
+func (e *fakeDockerEngine) create(w http.ResponseWriter, r *http.Request) {
+	var config dockerContainerConfig
+	if err := json.NewDecoder(r.Body).Decode(&config); err != nil {
+		writeDockerError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	name := r.URL.Query().Get("name")
+	if e.container(name) != nil {
+		writeDockerError(w, http.StatusConflict, fmt.Sprintf("Conflict. The container name %q is already in use", name))
+		return
+	}
+	e.Lock()
+	e.nextId++
+	c := &fakeContainer{
+		id:       fmt.Sprintf("c%d", e.nextId),
+		name:     name,
+		config:   config,
+		attached: make(chan struct{}),
+		killed:   make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+	e.containers[c.id] = c
+	e.Unlock()
+	w.WriteHeader(http.StatusCreated)
+	json.NewEncoder(w).Encode(map[string]string{"Id": c.id})
+}
+
+// attach hijacks the connection to send the output and receive the input of the container
+func (e *fakeDockerEngine) attach(w http.ResponseWriter, c *fakeContainer) {
+	conn, rw, err := w.(http.Hijacker).Hijack()
+	if err != nil {
+		return
+	}
+	rw.WriteString("HTTP/1.1 101 UPGRADED\r\nContent-Type: application/vnd.docker.raw-stream\r\nConnection: Upgrade\r\nUpgrade: tcp\r\n\r\n")
+	rw.Flush()
+	c.conn, c.stdin = conn, rw.Reader
+	close(c.attached)
+}
+
+// run executes the command of the container after it was started
+func (c *fakeContainer) run() {
+	defer close(c.stopped)
+	select {
+	case <-c.attached:
+		defer c.conn.Close()
+	default:
+	}
+	switch c.config.Cmd[0] {
+	case "echo":
+		input, _ := ioutil.ReadAll(c.stdin)
+		c.conn.Write(dockerFrame(1, string(input)))
+	case "fail":
+		c.conn.Write(dockerFrame(1, "some output\n"))
+		c.conn.Write(dockerFrame(2, "error\n"))
+		c.exitCode = 2
+	case "oom":
+		c.exitCode, c.oomKilled = 137, true
+	case "hang":
+		<-c.killed
+		c.exitCode = 137
+	}
+}
+
+func writeDockerError(w http.ResponseWriter, status int, message string) {
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(map[string]string{"message": message})
+}
+
+// dockerFrame creates a frame of the multiplexed output stream
+func dockerFrame(stream byte, content string) []byte {
+	frame := make([]byte, 8, 8+len(content))
+	frame[0] = stream
+	binary.BigEndian.PutUint32(frame[4:], uint32(len(content)))
+	return append(frame, content...)
+}
+
+func TestDockerApiSandboxRun(t *testing.T) {
+	engine := newFakeDockerEngine(t)
+	s := newDockerApiSandbox(engine.socket, "test")
+
+	var stdout, stderr bytes.Buffer
+	res, err := s.Run(SandboxCommand{
+		Name:    "run",
+		Image:   "python",
+		Command: []string{"echo"},
+		WorkDir: "/code",
+		Mounts:  []Mount{{Source: "/runs/run", Target: "/code"}, {Source: "/libs", Target: "/libs", ReadOnly: true}},
+		Stdin:   strings.NewReader("hello\n"),
+		Stdout:  &stdout,
+		Stderr:  &stderr,
+		MaxMem:  100,
+		Timeout: 10 * time.Second,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != (SandboxResult{}) || stdout.String() != "hello\n" || stderr.String() != "" {
+		t.Errorf("result %+v, stdout %q, stderr %q", res, stdout.String(), stderr.String())
+	}
+
+	want := []string{
+		"POST /containers/create",
+		"POST /containers/attach",
+		"POST /containers/start",
+		"POST /containers/wait",
+		"GET /containers/json",
+		"DELETE /containers",
+	}
+	if got := engine.requested(); strings.Join(got, ", ") != strings.Join(want, ", ") {
+		t.Errorf("requests %v, want %v", got, want)
+	}
+	if len(engine.containers) != 0 {
+		t.Errorf("the container was not removed")
+	}
+}
+
+func TestDockerApiSandboxConfig(t *testing.T) {
+	s := newDockerApiSandbox("/var/run/docker.sock", "test")
+	config, err := s.containerConfig(SandboxCommand{
+		Image:   "python",
+		Command: []string{"python3", "main.py"},
+		Mounts:  []Mount{{Source: "/runs/run", Target: "/code"}, {Source: "/libs", Target: "/libs", ReadOnly: true}},
+		MaxMem:  100,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	host := config.HostConfig
+	if strings.Join(host.Binds, " ") != "/runs/run:/code /libs:/libs:ro" {
+		t.Errorf("binds = %v", host.Binds)
+	}
+	if host.Memory != 100*1024*1024 || host.NetworkMode != "none" || !host.ReadonlyRootfs || host.PidsLimit != 128 {
+		t.Errorf("host config %+v does not apply the limits and the default security profile", host)
+	}
+	if config.Labels[dockerInstanceLabel] != "test" || config.AttachStdin {
+		t.Errorf("config %+v", config)
+	}
+}
+
+func TestDockerApiSandboxExitCode(t *testing.T) {
+	engine := newFakeDockerEngine(t)
+	s := newDockerApiSandbox(engine.socket, "test")
+
+	var stdout, stderr bytes.Buffer
+	res, err := s.Run(SandboxCommand{Name: "run", Image: "python", Command: []string{"fail"}, Stdout: &stdout, Stderr: &stderr, StdoutLimit: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != (SandboxResult{ExitCode: 2}) {
+		t.Errorf("result %+v, want exit code 2", res)
+	}
+	if stdout.String() != "some" || stderr.String() != "error\n" {
+		t.Errorf("stdout %q, stderr %q, want the limited stdout and stderr", stdout.String(), stderr.String())
+	}
+}
+
+func TestDockerApiSandboxOOMKilled(t *testing.T) {
+	engine := newFakeDockerEngine(t)
+	s := newDockerApiSandbox(engine.socket, "test")
+
+	res, err := s.Run(SandboxCommand{Name: "run", Image: "python", Command: []string{"oom"}, MaxMem: 10})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res != (SandboxResult{ExitCode: 137, OOMKilled: true}) {
+		t.Errorf("result %+v, want the container to be killed for its memory", res)
+	}
+}
+
+func TestDockerApiSandboxTimeout(t *testing.T) {
+	engine := newFakeDockerEngine(t)
+	s := newDockerApiSandbox(engine.socket, "test")
+
+	res, err := s.Run(SandboxCommand{Name: "run", Image: "python", Command: []string{"hang"}, Timeout: 100 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !res.TimedOut || res.ExitCode != 137 {
+		t.Errorf("result %+v, want a timeout", res)
+	}
+	if got := strings.Join(engine.requested(), ", "); !strings.Contains(got, "POST /containers/kill, POST /containers/wait") {
+		t.Errorf("requests %s, want the container to be killed after the timeout", got)
+	}
+}
+
+func TestDockerApiSandboxConflict(t *testing.T) {
+	engine := newFakeDockerEngine(t)
+	s := newDockerApiSandbox(engine.socket, "test")
+
+	// a container left behind with the same name is replaced
+	if _, err := s.client.createContainer(context.Background(), "run", dockerContainerConfig{Image: "python", Cmd: []string{"hang"}}); err != nil {
+		t.Fatal(err)
+	}
+	old := engine.container("run")
+
+	var stdout bytes.Buffer
+	if _, err := s.Run(SandboxCommand{Name: "run", Image: "python", Command: []string{"echo"}, Stdin: strings.NewReader("new"), Stdout: &stdout}); err != nil {
+		t.Fatal(err)
+	}
+	if stdout.String() != "new" {
+		t.Errorf("stdout %q, want the output of the new container", stdout.String())
+	}
+	want := "POST /containers/create, POST /containers/create, DELETE /containers, POST /containers/create"
+	if got := strings.Join(engine.requested(), ", "); !strings.HasPrefix(got, want) {
+		t.Errorf("requests %s, want them to start with %s", got, want)
+	}
+	if engine.container(old.id) != nil {
+		t.Errorf("the old container was not removed")
+	}
+}
+
+func TestDockerClientError(t *testing.T) {
+	engine := newFakeDockerEngine(t)
+	client := newDockerClient(engine.socket)
+
+	err := client.startContainer(context.Background(), "missing")
+	apiErr, ok := err.(*dockerApiError)
+	if !ok || apiErr.StatusCode != http.StatusNotFound || apiErr.Message != "No such container: missing" {
+		t.Errorf("error %#v, want the status and message of the Docker Engine", err)
+	}
+
+	if _, _, err := client.attachContainer(context.Background(), "missing", false); err == nil {
+		t.Errorf("attaching to a missing container succeeded")
+	}
+
+	if err := newDockerClient(filepath.Join(t.TempDir(), "missing.sock")).startContainer(context.Background(), "run"); err == nil {
+		t.Errorf("request to a missing socket succeeded")
+	}
+}
+
+func TestDemultiplexOutput(t *testing.T) {
+	cases := []struct {
+		name           string
+		stream         []byte
+		stdout, stderr string
+		err            error
+	}{
+		{name: "empty"},
+		{
+			name:   "frames",
+			stream: bytes.Join([][]byte{dockerFrame(1, "out1 "), dockerFrame(2, "err"), dockerFrame(1, "out2")}, nil),
+			stdout: "out1 out2",
+			stderr: "err",
+		},
+		{name: "empty frame", stream: append(dockerFrame(1, ""), dockerFrame(1, "x")...), stdout: "x"},
+		{name: "stdin stream is ignored", stream: append(dockerFrame(0, "in"), dockerFrame(1, "out")...), stdout: "out"},
+		{name: "truncated header", stream: append(dockerFrame(1, "out"), 1, 0, 0), stdout: "out", err: io.ErrUnexpectedEOF},
+		{name: "truncated content", stream: dockerFrame(2, "error")[:10], stderr: "er", err: io.ErrUnexpectedEOF},
+	}
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			var stdout, stderr bytes.Buffer
+			err := demultiplexOutput(bytes.NewReader(c.stream), &stdout, &stderr)
+			if err != c.err {
+				t.Errorf("error %v, want %v", err, c.err)
+			}
+			if stdout.String() != c.stdout || stderr.String() != c.stderr {
+				t.Errorf("stdout %q, stderr %q, want %q and %q", stdout.String(), stderr.String(), c.stdout, c.stderr)
+			}
+		})
+	}
+}
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync/atomic"
+	"time"
+)
+
+// GitSource is a Git repository whose files are submitted
+type GitSource struct {
+	URL string `json:"url,omitempty"`
+	// Ref is a branch, tag or commit, the default branch (HEAD) if empty
+	Ref string `json:"ref,omitempty"`
+	// Bundle is a file created by git bundle, used instead of URL, e.g. if the repository is not reachable by RTE
+	Bundle *SubmittedFile `json:"bundle,omitempty"`
+}
+
+// GitError is returned if the files of a Git source cannot be fetched
+type GitError struct {
+	Reason string `json:"reason"`
+	// Output of git, if it failed
+	Output string `json:"output,omitempty"`
+}
+
+func (e GitError) Error() string {
+	if e.Output == "" {
+		return "Could not fetch Git repository: " + e.Reason
+	}
+	return fmt.Sprintf("Could not fetch Git repository: %s\n%s", e.Reason, e.Output)
+}
+
+var scpLikeGitURL = regexp.MustCompile(`^([^/@:]+@)?([^/:]+):`)
+
+// gitProtocol returns the protocol git uses for the URL (the names used by GIT_ALLOW_PROTOCOL)
+func gitProtocol(url string) string {
+	if i := strings.Index(url, "://"); i > 0 {
+		return strings.ToLower(url[:i])
+	}
+	if scpLikeGitURL.MatchString(url) {
+		return "ssh"
+	}
+	return "file"
+}
+
+// gitHost returns the host of the URL in lower case, an empty host for local repositories
+func gitHost(gitURL string) (string, error) {
+	if strings.Contains(gitURL, "://") {
+		u, err := url.Parse(gitURL)
+		if err != nil {
+			return "", err
+		}
+		return strings.ToLower(u.Hostname()), nil
+	}
+	if m := scpLikeGitURL.FindStringSubmatch(gitURL); m != nil {
+		return strings.ToLower(m[2]), nil
+	}
+	return "", nil
+}
+
+// splitList splits a comma separated list of a flag
+func splitList(list string) []string {
+	var values []string
+	for _, value := range strings.Split(list, ",") {
+		if value = strings.TrimSpace(value); value != "" {
+			values = append(values, value)
+		}
+	}
+	return values
+}
+
+func allowedGitProtocols() []string {
+	return splitList(*gitProtocols)
+}
+
+// checkGitURL checks the protocol of the URL and the host against -git_hosts, so that submissions cannot make RTE
+// send requests to arbitrary hosts, e.g. services in the internal network
+func checkGitURL(gitURL string) error {
+	protocol := gitProtocol(gitURL)
+	allowed := false
+	for _, p := range allowedGitProtocols() {
+		if p == protocol {
+			allowed = true
+		}
+	}
+	if !allowed {
+		return GitError{Reason: fmt.Sprintf("protocol %s is not allowed", protocol)}
+	}
+	if protocol == "file" {
+		return nil
+	}
+	host, err := gitHost(gitURL)
+	if err != nil || host == "" {
+		return GitError{Reason: "URL without host"}
+	}
+	for _, h := range splitList(*gitHosts) {
+		h = strings.ToLower(h)
+		if host == h || (strings.HasPrefix(h, ".") && strings.HasSuffix(host, h)) {
+			return nil
+		}
+	}
+	return GitError{Reason: fmt.Sprintf("host %s is not allowed", host)}
+}
+
+// runGit executes git in dir without prompts and system-wide configuration
+func runGit(ctx context.Context, dir string, allowProtocols string, args ...string) (string, error) {
+	cmd := exec.CommandContext(ctx, "git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(),
+		"GIT_TERMINAL_PROMPT=0",
+		"GIT_CONFIG_NOSYSTEM=1",
+		"GIT_ALLOW_PROTOCOL="+allowProtocols,
+		// redirects could lead to hosts which are not allowed
+		"GIT_CONFIG_COUNT=1",
+		"GIT_CONFIG_KEY_0=http.followRedirects",
+		"GIT_CONFIG_VALUE_0=false",
+		// blobs left out by the filter of the fetch must not be fetched later (git 2.45 and newer)
+		"GIT_NO_LAZY_FETCH=1",
+	)
+	var output bytes.Buffer
+	cmd.Stdout = &output
+	cmd.Stderr = &output
+	err := cmd.Run()
+	if ctx.Err() == context.DeadlineExceeded {
+		return output.String(), GitError{Reason: fmt.Sprintf("git %s did not finish within %d seconds", args[0], *gitTimeout)}
+	}
+	if err != nil {
+		return output.String(), GitError{Reason: fmt.Sprintf("git %s failed: %s", args[0], err), Output: strings.TrimSpace(output.String())}
+	}
+	return output.String(), nil
+}
+
+// dirSize returns the size of the regular files in dir
+func dirSize(dir string) int64 {
+	var size int64
+	filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err == nil && info.Mode().IsRegular() {
+			size += info.Size()
+		}
+		return nil
+	})
+	return size
+}
+
+// limitGitSize cancels git when the size of the files in dir exceeds max bytes. git writes the received objects
+// to disk while fetching, so that repositories which are too large are stopped early. The returned function
+// tells if the limit was exceeded, it is called after git finished.
+func limitGitSize(ctx context.Context, cancel context.CancelFunc, dir string, max int64) func() bool {
+	var exceeded int32
+	if max <= 0 {
+		return func() bool { return false }
+	}
+	go func() {
+		ticker := time.NewTicker(50 * time.Millisecond)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+			if dirSize(dir) > max {
+				atomic.StoreInt32(&exceeded, 1)
+				cancel()
+				return
+			}
+		}
+	}()
+	return func() bool {
+		// git may finish between two checks
+		return atomic.LoadInt32(&exceeded) == 1 || dirSize(dir) > max
+	}
+}
+
+// fetchGitSource fetches the files of a single commit of the repository without the history.
+// Blobs larger than -git_max_bytes are left out by a filter (if the server supports it), and the fetch is stopped
+// when the repository grows beyond -git_max_fetch_bytes.
+// It returns the files of the commit and the hash of the commit.
+func fetchGitSource(source GitSource) ([]SubmittedFile, string, error) {
+	ref := source.Ref
+	if ref == "" {
+		ref = "HEAD"
+	}
+	if strings.HasPrefix(ref, "-") || strings.HasPrefix(source.URL, "-") {
+		return nil, "", GitError{Reason: "URL and ref must not start with -"}
+	}
+
+	dir, err := ioutil.TempDir("", "rte-git-")
+	if err != nil {
+		return nil, "", err
+	}
+	defer os.RemoveAll(dir)
+	worktree := filepath.Join(dir, "repository")
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(*gitTimeout)*time.Second)
+	defer cancel()
+
+	url := source.URL
+	protocols := strings.Join(allowedGitProtocols(), ":")
+	fetchArgs := []string{"fetch", "--quiet", "--no-tags", "--depth", "1"}
+	if *gitMaxBytes > 0 {
+		fetchArgs = append(fetchArgs, fmt.Sprintf("--filter=blob:limit=%d", *gitMaxBytes))
+	}
+	if source.Bundle != nil {
+		content, err := source.Bundle.bytes()
+		if err != nil {
+			return nil, "", GitError{Reason: err.Error()}
+		}
+		url = filepath.Join(dir, "submission.bundle")
+		if err := ioutil.WriteFile(url, content, 0600); err != nil {
+			return nil, "", err
+		}
+		// the bundle is a local file, it contains the history anyway
+		protocols = "file"
+		fetchArgs = []string{"fetch", "--quiet", "--no-tags"}
+	} else {
+		if url == "" {
+			return nil, "", GitError{Reason: "URL or bundle required"}
+		}
+		if err := checkGitURL(url); err != nil {
+			return nil, "", err
+		}
+	}
+
+	if _, err := runGit(ctx, dir, protocols, "init", "--quiet", worktree); err != nil {
+		return nil, "", err
+	}
+	// the filter of partial fetches needs a named remote
+	if _, err := runGit(ctx, worktree, protocols, "remote", "add", "origin", url); err != nil {
+		return nil, "", err
+	}
+	fetchCtx, cancelFetch := context.WithCancel(ctx)
+	tooLarge := limitGitSize(fetchCtx, cancelFetch, worktree, *gitMaxFetchBytes)
+	_, err = runGit(fetchCtx, worktree, protocols, append(fetchArgs, "origin", ref)...)
+	cancelFetch()
+	if tooLarge() {
+		return nil, "", GitError{Reason: fmt.Sprintf("repository larger than %d bytes", *gitMaxFetchBytes)}
+	}
+	if err != nil {
+		return nil, "", err
+	}
+	// blobs left out by the filter are listed as missing objects, they are not fetched by the checkout
+	objects, err := runGit(ctx, worktree, protocols, "rev-list", "--objects", "--missing=print", "FETCH_HEAD")
+	if err != nil {
+		return nil, "", err
+	}
+	for _, line := range strings.Split(objects, "\n") {
+		if strings.HasPrefix(line, "?") {
+			return nil, "", GitError{Reason: fmt.Sprintf("the commit contains files larger than %d bytes", *gitMaxBytes)}
+		}
+	}
+	if _, err := runGit(ctx, worktree, protocols, "checkout", "--quiet", "--detach", "FETCH_HEAD"); err != nil {
+		return nil, "", err
+	}
+	commit, err := runGit(ctx, worktree, protocols, "rev-parse", "HEAD")
+	if err != nil {
+		return nil, "", err
+	}
+
+	files, err := readGitWorktree(worktree)
+	if err != nil {
+		return nil, "", err
+	}
+	return files, strings.TrimSpace(commit), nil
+}
+
+// readGitWorktree reads the files of a checked out commit, without the .git folder.
+// Symbolic links are rejected, the files are limited like the files of archives.
+func readGitWorktree(worktree string) ([]SubmittedFile, error) {
+	x := archiveExtractor{limits: archiveLimits{maxBytes: *gitMaxBytes, maxEntries: *archiveMaxEntries}}
+	err := filepath.Walk(worktree, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(worktree, path)
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			if info.Name() == ".git" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !info.Mode().IsRegular() {
+			return GitError{Reason: fmt.Sprintf("%s is not a regular file (symbolic links are not allowed)", filepath.ToSlash(rel))}
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		if err := x.add(filepath.ToSlash(rel), f); err != nil {
+			return GitError{Reason: err.Error()}
+		}
+		return nil
+	})
+	return x.files, err
+}
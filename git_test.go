@@ -0,0 +1,198 @@
+package main
+
+import (
+	"crypto/rand"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// useGitFlags sets the flags of Git submissions for the duration of the test
+func useGitFlags(t *testing.T, protocols string, hosts string, maxBytes int64, maxFetchBytes int64) {
+	previousProtocols, previousHosts, previousMax, previousFetch := *gitProtocols, *gitHosts, *gitMaxBytes, *gitMaxFetchBytes
+	*gitProtocols, *gitHosts, *gitMaxBytes, *gitMaxFetchBytes = protocols, hosts, maxBytes, maxFetchBytes
+	t.Cleanup(func() {
+		*gitProtocols, *gitHosts, *gitMaxBytes, *gitMaxFetchBytes = previousProtocols, previousHosts, previousMax, previousFetch
+	})
+}
+
+// git runs git in dir and fails the test if it fails
+func git(t *testing.T, dir string, args ...string) string {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	cmd.Env = append(os.Environ(), "GIT_CONFIG_NOSYSTEM=1", "GIT_AUTHOR_NAME=rte", "GIT_AUTHOR_EMAIL=rte@example.org",
+		"GIT_COMMITTER_NAME=rte", "GIT_COMMITTER_EMAIL=rte@example.org")
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		t.Fatalf("git %s: %s\n%s", strings.Join(args, " "), err, output)
+	}
+	return strings.TrimSpace(string(output))
+}
+
+// bareRepository creates a bare repository with a commit of the files on the branch main and returns its path
+func bareRepository(t *testing.T, files map[string][]byte) string {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	dir := t.TempDir()
+	bare, work := filepath.Join(dir, "bare.git"), filepath.Join(dir, "work")
+	git(t, dir, "init", "--quiet", "--bare", bare)
+	// the filter of partial fetches is only used if the server allows it
+	git(t, bare, "config", "uploadpack.allowFilter", "true")
+	git(t, dir, "init", "--quiet", work)
+	for name, content := range files {
+		path := filepath.Join(work, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, content, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	git(t, work, "add", ".")
+	git(t, work, "commit", "--quiet", "-m", "submission")
+	git(t, work, "push", "--quiet", bare, "HEAD:refs/heads/main")
+	return bare
+}
+
+// randomBytes returns n bytes which cannot be compressed
+func randomBytes(t *testing.T, n int) []byte {
+	data := make([]byte, n)
+	if _, err := rand.Read(data); err != nil {
+		t.Fatal(err)
+	}
+	return data
+}
+
+func TestCheckGitURL(t *testing.T) {
+	useGitFlags(t, "https,ssh,file", "github.com, .example.org", 0, 0)
+	cases := []struct {
+		url    string
+		reason string
+	}{
+		{"https://github.com/rte/hello.git", ""},
+		{"https://GitHub.com:443/rte/hello.git", ""},
+		{"ssh://git@github.com/rte/hello.git", ""},
+		{"git@github.com:rte/hello.git", ""},
+		{"https://gitlab.example.org/rte/hello.git", ""},
+		{"/srv/git/hello.git", ""},
+		{"file:///srv/git/hello.git", ""},
+		{"https://example.org/rte/hello.git", "host example.org is not allowed"},
+		{"https://github.com.evil.net/rte/hello.git", "host github.com.evil.net is not allowed"},
+		{"https://github.com@evil.net/rte/hello.git", "host evil.net is not allowed"},
+		{"https://169.254.169.254/latest/meta-data", "host 169.254.169.254 is not allowed"},
+		{"https://[::1]:8080/repo.git", "host ::1 is not allowed"},
+		{"git@localhost:repo.git", "host localhost is not allowed"},
+		{"git://github.com/rte/hello.git", "protocol git is not allowed"},
+		{"https:///rte/hello.git", "URL without host"},
+	}
+	for _, c := range cases {
+		var reason string
+		if err := checkGitURL(c.url); err != nil {
+			reason = err.(GitError).Reason
+		}
+		if reason != c.reason {
+			t.Errorf("checkGitURL(%s): %q, want %q", c.url, reason, c.reason)
+		}
+	}
+
+	// without -git_hosts only local repositories can be fetched
+	useGitFlags(t, "https,file", "", 0, 0)
+	if err := checkGitURL("https://github.com/rte/hello.git"); err == nil {
+		t.Errorf("host accepted without -git_hosts")
+	}
+}
+
+func TestFetchGitSource(t *testing.T) {
+	useGitFlags(t, "file", "", 1024, 1024*1024)
+	bare := bareRepository(t, map[string][]byte{
+		"main.py":     []byte("print(input())\n"),
+		"lib/util.py": []byte("x = 1\n"),
+	})
+
+	files, commit, err := fetchGitSource(GitSource{URL: bare, Ref: "main"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := git(t, bare, "rev-parse", "main"); commit != want {
+		t.Errorf("commit %s, want %s", commit, want)
+	}
+	names := make([]string, len(files))
+	for i, file := range files {
+		names[i] = file.Name
+	}
+	if got := strings.Join(names, " "); got != "lib/util.py main.py" {
+		t.Errorf("files %s, want lib/util.py main.py", got)
+	}
+
+	bundle := filepath.Join(t.TempDir(), "submission.bundle")
+	git(t, bare, "bundle", "create", "--quiet", bundle, "main")
+	content, err := ioutil.ReadFile(bundle)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// bundles are accepted without the protocol file
+	useGitFlags(t, "https", "", 1024, 1024*1024)
+	if _, bundleCommit, err := fetchGitSource(GitSource{Ref: "main", Bundle: &SubmittedFile{Content: string(content)}}); err != nil || bundleCommit != commit {
+		t.Errorf("commit %s of the bundle, want %s: %v", bundleCommit, commit, err)
+	}
+	if _, _, err := fetchGitSource(GitSource{URL: bare}); err == nil {
+		t.Errorf("local repository fetched without the protocol file")
+	}
+
+	useGitFlags(t, "https,file", "", 1024, 1024*1024)
+
+	cases := []struct {
+		name   string
+		source GitSource
+		reason string
+	}{
+		{"missing ref", GitSource{URL: bare, Ref: "missing"}, "git fetch failed: exit status 128"},
+		{"option as ref", GitSource{URL: bare, Ref: "--upload-pack=touch"}, "URL and ref must not start with -"},
+		{"no URL", GitSource{}, "URL or bundle required"},
+		{"host", GitSource{URL: "https://github.com/rte/hello.git"}, "host github.com is not allowed"},
+	}
+	for _, c := range cases {
+		_, _, err := fetchGitSource(c.source)
+		gitErr, ok := err.(GitError)
+		if !ok || gitErr.Reason != c.reason {
+			t.Errorf("%s: error %v, want %q", c.name, err, c.reason)
+		}
+	}
+}
+
+func TestFetchGitSourceLimits(t *testing.T) {
+	bare := bareRepository(t, map[string][]byte{
+		"main.py":  []byte("print(input())\n"),
+		"data.bin": randomBytes(t, 256*1024),
+	})
+	cases := []struct {
+		name          string
+		maxBytes      int64
+		maxFetchBytes int64
+		reason        string
+	}{
+		// the large blob is left out by the filter and not fetched by the checkout
+		{"filtered blob", 64 * 1024, 0, "the commit contains files larger than 65536 bytes"},
+		// without the filter, the size of the received pack is limited
+		{"fetch size", 0, 64 * 1024, "repository larger than 65536 bytes"},
+		{"no limits", 0, 0, ""},
+	}
+	for _, c := range cases {
+		useGitFlags(t, "file", "", c.maxBytes, c.maxFetchBytes)
+		_, _, err := fetchGitSource(GitSource{URL: "file://" + bare, Ref: "main"})
+		var reason string
+		if err != nil {
+			reason = err.Error()
+			if gitErr, ok := err.(GitError); ok {
+				reason = gitErr.Reason
+			}
+		}
+		if reason != c.reason {
+			t.Errorf("%s: error %q, want %q", c.name, reason, c.reason)
+		}
+	}
+}
@@ -1,12 +1,29 @@
 module rte-go
 
-go 1.16
+go 1.18
 
 require (
-	github.com/antchfx/xpath v1.1.11 // indirect
 	github.com/antchfx/xquery v0.0.0-20180515051857-ad5b8c7a47b0
+	github.com/fsnotify/fsnotify v1.4.9
 	github.com/go-errors/errors v1.4.0
 	github.com/mattn/go-zglob v0.0.3
 	github.com/prometheus/client_golang v1.10.0
 	github.com/satori/go.uuid v1.2.0
+	go.etcd.io/bbolt v1.3.5
+	gopkg.in/yaml.v2 v2.4.0
+)
+
+require (
+	github.com/antchfx/xpath v1.1.11 // indirect
+	github.com/beorn7/perks v1.0.1 // indirect
+	github.com/cespare/xxhash/v2 v2.1.1 // indirect
+	github.com/golang/protobuf v1.4.3 // indirect
+	github.com/matttproud/golang_protobuf_extensions v1.0.1 // indirect
+	github.com/prometheus/client_model v0.2.0 // indirect
+	github.com/prometheus/common v0.18.0 // indirect
+	github.com/prometheus/procfs v0.6.0 // indirect
+	golang.org/x/net v0.0.0-20200625001655-4c5254603344 // indirect
+	golang.org/x/sys v0.0.0-20210309074719-68d13333faf2 // indirect
+	golang.org/x/text v0.3.2 // indirect
+	google.golang.org/protobuf v1.23.0 // indirect
 )
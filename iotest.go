@@ -0,0 +1,278 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+)
+
+// ioTestManifests are the names of the optional file listing the cases of an IOTest, the first one found is used
+var ioTestManifests = []string{"iotests.yaml", "iotests.yml", "iotests.json"}
+
+// the expectations of an IO test case reported in Mismatch.Check
+const (
+	CheckStdout   = "stdout"
+	CheckStderr   = "stderr"
+	CheckExitCode = "exit_code"
+)
+
+// ioTestCase is a single execution of the program of an IOTest.
+// Cases are either listed in a manifest or given by <name>.out.txt files with the optional
+// <name>.in.txt, <name>.param.txt, <name>.stderr.txt and <name>.exit.txt files.
+type ioTestCase struct {
+	Name string `yaml:"name" json:"name"`
+	// Stdin is the input of the program, StdinFile a file in the test folder with the input
+	Stdin     string `yaml:"stdin" json:"stdin"`
+	StdinFile string `yaml:"stdin_file" json:"stdin_file"`
+	// Args are the command line arguments of the program
+	Args []string          `yaml:"args" json:"args"`
+	Env  map[string]string `yaml:"env" json:"env"`
+	// Stdout is the expected output, StdoutFile a file in the test folder with the expected output
+	Stdout     *string `yaml:"stdout" json:"stdout"`
+	StdoutFile string  `yaml:"stdout_file" json:"stdout_file"`
+	// Stderr is the expected error output, StderrFile a file in the test folder with the expected error output
+	Stderr     *string `yaml:"stderr" json:"stderr"`
+	StderrFile string  `yaml:"stderr_file" json:"stderr_file"`
+	// ExitCode is the expected exit status. Without it, the case fails if the program does not exit with 0.
+	ExitCode *int `yaml:"exit_code" json:"exit_code"`
+	// Timeout in seconds replaces the Timeout of the test for this case
+	Timeout int `yaml:"timeout" json:"timeout"`
+	// Weight is the number of points of the case, 1 if it is not given. Cases with weight 0 do not count for the score.
+	Weight *float64 `yaml:"weight" json:"weight"`
+	// Hidden cases only report whether they passed, not the input and the output
+	Hidden bool `yaml:"hidden" json:"hidden"`
+}
+
+// ioTestManifest is the content of iotests.yaml or iotests.json
+type ioTestManifest struct {
+	Cases []ioTestCase `yaml:"cases" json:"cases"`
+}
+
+var ioTestCaseName = regexp.MustCompile(`^[A-Za-z0-9][A-Za-z0-9_.-]*$`)
+
+// ioTestManifestPath returns the manifest of the test in testDir, an empty string if the test has none
+func ioTestManifestPath(testDir string) string {
+	for _, name := range ioTestManifests {
+		path := filepath.Join(testDir, name)
+		if fileExists(path) {
+			return path
+		}
+	}
+	return ""
+}
+
+// loadIOTestCases returns the cases of the IOTest in testDir from its manifest, or from the .out.txt files if it has none
+func loadIOTestCases(testDir string) ([]ioTestCase, error) {
+	if manifest := ioTestManifestPath(testDir); manifest != "" {
+		return loadIOTestManifest(testDir, manifest)
+	}
+	return ioTestCasesFromFiles(testDir)
+}
+
+// ioTestCasesFromFiles creates a case for each <name>.out.txt file
+func ioTestCasesFromFiles(testDir string) ([]ioTestCase, error) {
+	files, err := ioutil.ReadDir(testDir)
+	if err != nil {
+		return nil, err
+	}
+	var cases []ioTestCase
+	for _, f := range files {
+		if f.IsDir() || !strings.HasSuffix(f.Name(), ".out.txt") {
+			continue
+		}
+		name := strings.TrimSuffix(f.Name(), ".out.txt")
+		tc := ioTestCase{Name: name, StdoutFile: f.Name()}
+		if stat, err := os.Stat(filepath.Join(testDir, name+".in.txt")); err == nil && !stat.IsDir() {
+			tc.StdinFile = name + ".in.txt"
+		}
+		if params, err := ioutil.ReadFile(filepath.Join(testDir, name+".param.txt")); err == nil {
+			tc.Args = strings.Split(strings.Trim(string(params), "\r\n"), " ")
+		}
+		if stat, err := os.Stat(filepath.Join(testDir, name+".stderr.txt")); err == nil && !stat.IsDir() {
+			tc.StderrFile = name + ".stderr.txt"
+		}
+		if content, err := ioutil.ReadFile(filepath.Join(testDir, name+".exit.txt")); err == nil {
+			exitCode, err := strconv.Atoi(strings.TrimSpace(string(content)))
+			if err != nil {
+				return nil, fmt.Errorf("%s.exit.txt does not contain an exit status: %s", name, strings.TrimSpace(string(content)))
+			}
+			tc.ExitCode = &exitCode
+		}
+		cases = append(cases, tc)
+	}
+	return cases, nil
+}
+
+// loadIOTestManifest reads the cases of a manifest and checks them
+func loadIOTestManifest(testDir string, path string) ([]ioTestCase, error) {
+	data, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	var manifest ioTestManifest
+	if strings.HasSuffix(path, ".json") {
+		dec := json.NewDecoder(bytes.NewReader(data))
+		dec.DisallowUnknownFields()
+		err = dec.Decode(&manifest)
+		if err == nil && dec.More() {
+			err = fmt.Errorf("unexpected data after the manifest")
+		}
+	} else {
+		err = yaml.UnmarshalStrict(data, &manifest)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Invalid %s: %s", filepath.Base(path), err)
+	}
+	names := make(map[string]bool)
+	for i, tc := range manifest.Cases {
+		if err := tc.check(testDir); err != nil {
+			return nil, fmt.Errorf("Invalid case %d (%s) in %s: %s", i+1, tc.Name, filepath.Base(path), err)
+		}
+		if names[tc.Name] {
+			return nil, fmt.Errorf("Duplicate case %s in %s", tc.Name, filepath.Base(path))
+		}
+		names[tc.Name] = true
+	}
+	return manifest.Cases, nil
+}
+
+// check checks a case of a manifest, the files it refers to have to be inside of the test folder
+func (tc ioTestCase) check(testDir string) error {
+	if !ioTestCaseName.MatchString(tc.Name) {
+		return fmt.Errorf("the name must only contain letters, digits, _, . and -")
+	}
+	if tc.Stdin != "" && tc.StdinFile != "" {
+		return fmt.Errorf("only one of stdin and stdin_file can be given")
+	}
+	if tc.Stdout != nil && tc.StdoutFile != "" {
+		return fmt.Errorf("only one of stdout and stdout_file can be given")
+	}
+	if tc.Stderr != nil && tc.StderrFile != "" {
+		return fmt.Errorf("only one of stderr and stderr_file can be given")
+	}
+	if !tc.expectsStdout() && !tc.expectsStderr() && tc.ExitCode == nil {
+		return fmt.Errorf("one of stdout, stdout_file, stderr, stderr_file and exit_code is required")
+	}
+	for _, file := range []string{tc.StdinFile, tc.StdoutFile, tc.StderrFile} {
+		if file == "" {
+			continue
+		}
+		if _, reason := uploadPath(file); reason != "" {
+			return fmt.Errorf("%s is not a file of the test folder: %s", file, reason)
+		}
+		if !fileExists(filepath.Join(testDir, filepath.FromSlash(file))) {
+			return fmt.Errorf("%s not found", file)
+		}
+	}
+	if tc.Timeout < 0 || (tc.Weight != nil && *tc.Weight < 0) {
+		return fmt.Errorf("timeout and weight must not be negative")
+	}
+	return nil
+}
+
+// expectsStdout tells if the output of the program is compared
+func (tc ioTestCase) expectsStdout() bool {
+	return tc.Stdout != nil || tc.StdoutFile != ""
+}
+
+// expectsStderr tells if the error output of the program is compared
+func (tc ioTestCase) expectsStderr() bool {
+	return tc.Stderr != nil || tc.StderrFile != ""
+}
+
+// weight returns the points of the case
+func (tc ioTestCase) weight() float64 {
+	if tc.Weight == nil {
+		return 1
+	}
+	return *tc.Weight
+}
+
+// environment returns the environment variables of the case in the form KEY=value
+func (tc ioTestCase) environment() []string {
+	env := make([]string, 0, len(tc.Env))
+	for key, value := range tc.Env {
+		env = append(env, key+"="+value)
+	}
+	sort.Strings(env)
+	return env
+}
+
+// input returns the input of the case to show it to students
+func (tc ioTestCase) input(testDir string) string {
+	if tc.StdinFile == "" {
+		if tc.Stdin == "" {
+			return "No input"
+		}
+		return tc.Stdin
+	}
+	content, err := readFile(filepath.Join(testDir, filepath.FromSlash(tc.StdinFile)))
+	if err != nil {
+		return "No input"
+	}
+	return string(content)
+}
+
+// present removes the input and the output of hidden cases from their result
+func (tc ioTestCase) present(test Test) Test {
+	if !tc.Hidden {
+		return test
+	}
+	hidden := Test{
+		Name:           test.Name,
+		Success:        test.Success,
+		Timeout:        test.Timeout,
+		MemoryExceeded: test.MemoryExceeded,
+		Weight:         test.Weight,
+		Hidden:         true,
+	}
+	// which expectations failed is shown, but not the expected and actual values
+	for _, mismatch := range test.Mismatches {
+		hidden.Mismatches = append(hidden.Mismatches, Mismatch{Check: mismatch.Check})
+	}
+	if !test.Success {
+		hidden.Error = "The hidden test case failed"
+	}
+	return hidden
+}
+
+// expectedFile returns the file with the expected output and a function removing temporary files
+func (tc ioTestCase) expectedFile(testDir string) (string, func(), error) {
+	return expectationFile(testDir, tc.Stdout, tc.StdoutFile)
+}
+
+// expectedStderrFile returns the file with the expected error output and a function removing temporary files
+func (tc ioTestCase) expectedStderrFile(testDir string) (string, func(), error) {
+	return expectationFile(testDir, tc.Stderr, tc.StderrFile)
+}
+
+// expectationFile returns the file of the test folder or, for an inline expectation, a temporary file with its content.
+// The temporary file is outside of the run folder, where the programs of other cases cannot read it.
+func expectationFile(testDir string, inline *string, file string) (string, func(), error) {
+	if inline == nil {
+		return filepath.Join(testDir, filepath.FromSlash(file)), func() {}, nil
+	}
+	f, err := ioutil.TempFile("", "rte-expected-")
+	if err != nil {
+		return "", nil, err
+	}
+	cleanup := func() { os.Remove(f.Name()) }
+	_, err = f.WriteString(*inline)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		cleanup()
+		return "", nil, err
+	}
+	return f.Name(), cleanup, nil
+}
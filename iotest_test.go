@@ -0,0 +1,79 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLoadIOTestManifest(t *testing.T) {
+	cases := []struct {
+		name     string
+		file     string
+		manifest string
+		want     string // the weights of the cases or the error
+	}{
+		{"yaml weights", "iotests.yaml", "cases:\n  - {name: a, stdout: x, weight: 2}\n  - {name: b, stdout: x, weight: 0}\n  - {name: c, stdout: x}\n",
+			"a=2 b=0 c=1"},
+		{"json weights", "iotests.json", `{"cases": [{"name": "a", "stdout": "x", "weight": 0.5}, {"name": "b", "stdout": "x", "weight": 0}, {"name": "c", "stdout": "x"}]}`,
+			"a=0.5 b=0 c=1"},
+		{"json fields", "iotests.json", `{"cases": [{"name": "a", "stdin_file": "in.txt", "stdout": "", "exit_code": 2, "args": ["-v"], "env": {"LANG": "C"}, "hidden": true}]}`,
+			"a=1"},
+		{"json unknown field", "iotests.json", `{"cases": [{"name": "a", "stdout": "x", "wieght": 2}]}`,
+			`Invalid iotests.json: json: unknown field "wieght"`},
+		{"json yaml syntax", "iotests.json", "cases:\n  - {name: a, stdout: x}\n",
+			"Invalid iotests.json: invalid character 'c' looking for beginning of value"},
+		{"json trailing data", "iotests.json", `{"cases": []} {"cases": []}`,
+			"Invalid iotests.json: unexpected data after the manifest"},
+		{"yaml unknown field", "iotests.yaml", "cases:\n  - {name: a, stdout: x, wieght: 2}\n",
+			"Invalid iotests.yaml: yaml: unmarshal errors:\n  line 2: field wieght not found in type main.ioTestCase"},
+		{"negative weight", "iotests.yaml", "cases:\n  - {name: a, stdout: x, weight: -1}\n",
+			"Invalid case 1 (a) in iotests.yaml: timeout and weight must not be negative"},
+	}
+	for _, c := range cases {
+		dir := t.TempDir()
+		if err := ioutil.WriteFile(filepath.Join(dir, c.file), []byte(c.manifest), 0644); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, "in.txt"), []byte("input"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		var got string
+		tcs, err := loadIOTestCases(dir)
+		if err != nil {
+			got = err.Error()
+		} else {
+			weights := make([]string, len(tcs))
+			for i, tc := range tcs {
+				weights[i] = fmt.Sprintf("%s=%v", tc.Name, tc.weight())
+			}
+			got = strings.Join(weights, " ")
+		}
+		if got != c.want {
+			t.Errorf("%s: got %q, want %q", c.name, got, c.want)
+		}
+	}
+}
+
+func TestIOTestRunnerWeightZero(t *testing.T) {
+	useSandbox(t, &fakeSandbox{run: fakeProgram})
+	// a practice case which passes, but does not count
+	result := IOTestRunner{}.executeTest(ioTestExecution(t, `cases:
+  - name: practice
+    stdin: "hello\n"
+    stdout: "HELLO\n"
+    weight: 0
+  - name: graded
+    stdin: "hello\n"
+    stdout: "WORLD\n"
+    weight: 2
+`))
+	if result.Score != 0 || result.MaxScore != 2 {
+		t.Errorf("score %v of %v, want 0 of 2", result.Score, result.MaxScore)
+	}
+	if len(result.Tests) != 2 || result.Tests[0].Weight == nil || *result.Tests[0].Weight != 0 {
+		t.Errorf("tests %+v, want the weight 0 of the practice case", result.Tests)
+	}
+}
@@ -3,7 +3,6 @@ package main
 import (
 	"fmt"
 	"io/ioutil"
-	"os/exec"
 	"strings"
 )
 
@@ -14,19 +13,9 @@ func (c CompilerProviderC) compile(execution Execution) error {
 	if err != nil {
 		return fmt.Errorf("Test not found: %s", err)
 	}
-	arguments, err := dockerArguments(execution.RunDir, execution.ID)
-	if err != nil {
-		return fmt.Errorf("Could not get docker arguments: %s", err)
-	}
-
-	// Docker command
-	arguments = append(arguments, *docker_image_c) // program name first
-	// TODO add restrictions (e.g. memory, cpu, ...)
-
-	// javac in Docker container
-	arguments = append(arguments, "clang", "-Wall", "-Werror", "-fsanitize=address", "-fsanitize=undefined", "-g")
+	// clang in Docker container
+	arguments := []string{"clang", "-Wall", "-Werror", "-fsanitize=address", "-fsanitize=undefined", "-g"}
 
-	arguments = append(arguments)
 	for _, f := range files {
 		name := f.Name()
 		if strings.HasSuffix(name, ".c") {
@@ -34,22 +23,14 @@ func (c CompilerProviderC) compile(execution Execution) error {
 		}
 	}
 
-	// TODO timeout?
-	if debug {
-		Debug.Printf("args = %v\n", arguments)
-	}
-	cmd := exec.Command("docker")
-	cmd.Args = arguments
-	cmd.Dir = execution.RunDir
-	out, err := cmd.CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("Error compiling:\n%s", string(out))
-	}
-	return nil
+	return runCompiler(execution, *docker_image_c, nil, arguments...)
 }
 
-func executeC(execution Execution, inFile string, paramFile string, outFile string, errFile string) (err error) {
-	dockerArgs := []string{"-e", "ASAN_OPTIONS=detect_leaks=1"}
+func executeC(execution Execution, tc ioTestCase, outFile string, errFile string) (res SandboxResult, err error) {
 	// 'stdbuf -oL' disables buffering, so that all output ends up in the output file, even if there is an error
-	return executeProgram(execution, inFile, paramFile, outFile, errFile, dockerArgs, *docker_image_c, "stdbuf", "-o0", "./a.out")
+	return executeProgram(execution, tc, outFile, errFile, SandboxCommand{
+		Image:   *docker_image_c,
+		Command: []string{"stdbuf", "-o0", "./a.out"},
+		Env:     []string{"ASAN_OPTIONS=detect_leaks=1"},
+	})
 }
@@ -1,20 +1,28 @@
 package main
 
 import (
-	"context"
 	"fmt"
 	"io/ioutil"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strconv"
 	"strings"
-	"syscall"
 	"time"
 
 	xmlquery "github.com/antchfx/xquery/xml"
 )
 
+// dotnetEnv lets dotnet run as non-root user on the read-only root file system of the default security profile:
+// the home folder is in the writable tmpfs /tmp and the packages come from the cache warmed up in the image
+var dotnetEnv = []string{
+	"HOME=/tmp",
+	"DOTNET_CLI_HOME=/tmp",
+	"NUGET_PACKAGES=/usr/share/nuget/packages",
+	"DOTNET_CLI_TELEMETRY_OPTOUT=1",
+	"DOTNET_SKIP_FIRST_TIME_EXPERIENCE=1",
+	"DOTNET_NOLOGO=1",
+}
+
 type CompilerProviderFsharp struct{}
 
 func (c CompilerProviderFsharp) compile(execution Execution) error {
@@ -32,28 +40,8 @@ func (c CompilerProviderFsharp) compile(execution Execution) error {
 		}
 	}
 
-	arguments, err := dockerArguments(execution.RunDir, execution.ID)
-	if err != nil {
-		return fmt.Errorf("Could not get docker arguments: %s", err)
-	}
-
-	arguments = append(arguments, *docker_image_fsharp)
-
 	// dotnet in Docker container
-	arguments = append(arguments, "dotnet", "build")
-
-	// TODO timeout?
-	if debug {
-		Debug.Printf("args = %v\n", arguments)
-	}
-	cmd := exec.Command("docker")
-	cmd.Args = arguments
-	cmd.Dir = execution.RunDir
-	out, err := cmd.CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("Error compiling:\n%s", string(out))
-	}
-	return nil
+	return runCompilerEnv(execution, *docker_image_fsharp, nil, dotnetEnv, "dotnet", "build")
 }
 
 type XUnitTestRunner struct {
@@ -69,6 +57,7 @@ func (t XUnitTestRunner) executeTest(execution Execution) TestResult {
 			ID:           execution.ID,
 			Compiled:     false,
 			CompileError: fmt.Sprintf("Could not read test dir\n%s", err),
+			Error:        &ApiError{Code: ErrInternal, Message: err.Error(), Phase: PhaseTest},
 		}
 	}
 
@@ -84,6 +73,7 @@ func (t XUnitTestRunner) executeTest(execution Execution) TestResult {
 					ID:           execution.ID,
 					Compiled:     false,
 					CompileError: fmt.Sprintf("Could not copy file %s\n%s", name, err),
+					Error:        &ApiError{Code: ErrInternal, Message: err.Error(), Phase: PhaseTest},
 				}
 			}
 		}
@@ -93,9 +83,11 @@ func (t XUnitTestRunner) executeTest(execution Execution) TestResult {
 	if compileError != nil {
 		junitIncompatibilityCount.WithLabelValues(execution.Test).Inc()
 		return TestResult{
-			ID:           execution.ID,
-			Compiled:     false,
-			CompileError: fmt.Sprintf("Error compiling test cases  (maybe wrong name of submitted class)\n%s", compileError.Error()),
+			ID:             execution.ID,
+			Compiled:       false,
+			CompileError:   fmt.Sprintf("Error compiling test cases  (maybe wrong name of submitted class)\n%s", compileError.Error()),
+			CompileTimeout: isCompileTimeout(compileError),
+			Error:          testCompileApiError(compileError),
 		}
 	}
 	return executeXUnit(execution)
@@ -113,27 +105,22 @@ func executeXUnit(execution Execution) TestResult {
 		timeout = 30
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeout)*time.Second)
-	defer func() {
-		exec.Command("docker", "stop", testid).Run()
-		cancel()
-	}()
-
-	// Docker command
-	arguments, err := dockerArguments(execution.RunDir, testid)
+	code, err := codeMount(execution.RunDir)
 	if err != nil {
 		return internalErrorResult(execution, fmt.Sprintf("Could not get docker arguments: %s", err))
 	}
 
-	// execute in Java environment
-	arguments = append(arguments, *docker_image_fsharp)
-
-	// call JUnit runner
-	arguments = append(arguments, "dotnet", "test", "--blame", "-p:ParallelizeTestCollections=false", "--logger", "trx;LogFileName=Results.trx")
-
-	cmd := exec.CommandContext(ctx, "docker")
-	cmd.Args = arguments
-	cmd.Dir = absRunDir
+	// call xUnit runner in F# environment
+	sandboxCmd := SandboxCommand{
+		Name:     testid,
+		Image:    *docker_image_fsharp,
+		Command:  []string{"dotnet", "test", "--blame", "-p:ParallelizeTestCollections=false", "--logger", "trx;LogFileName=Results.trx"},
+		WorkDir:  "/code",
+		Mounts:   []Mount{code},
+		Env:      dotnetEnv,
+		Timeout:  time.Duration(timeout) * time.Second,
+		Security: execution.securityProfile(),
+	}
 
 	outLogFile := filepath.Join(absRunDir, "xunit.out.log")
 	outFileHandle, err := os.Create(outLogFile)
@@ -149,38 +136,25 @@ func executeXUnit(execution Execution) TestResult {
 	}
 	defer errFileHandle.Close()
 
-	cmd.Stdout = LimitWriter(outFileHandle, maxFileSize)
-	cmd.Stderr = LimitWriter(errFileHandle, maxFileSize)
+	sandboxCmd.Stdout = outFileHandle
+	sandboxCmd.StdoutLimit = maxFileSize
+	sandboxCmd.Stderr = errFileHandle
+	sandboxCmd.StderrLimit = maxFileSize
 	startTime := time.Now()
-	err = cmd.Run()
-	// executing JUnit might result in exit code 1 because of failed tests
-	cancel()
+	// executing xUnit might result in exit code 1 because of failed tests
+	res, err := sandbox.Run(sandboxCmd)
 	duration := time.Since(startTime)
 	testExecutionTimeHistogram.Observe(duration.Seconds())
 	if debug {
 		Debug.Printf("Duration of XUnit test execution: %s", duration)
 	}
 	if err != nil {
-		if exiterr, ok := err.(*exec.ExitError); ok {
-			if status, ok := exiterr.Sys().(syscall.WaitStatus); ok {
-				if status.ExitStatus() == -1 { // killed
-					message := appendOutput(outFileHandle, errFileHandle, outLogFile, errLogFile, "Timeout")
-					return TestResult{
-						ID:            execution.ID,
-						Compiled:      true,
-						TestsExecuted: 1,
-						TestsFailed:   1,
-						Tests: []Test{
-							{
-								Name:    "Testfälle",
-								Success: false,
-								Error:   message,
-							},
-						},
-					}
-				}
-			}
-		}
+		message := appendOutput(outFileHandle, errFileHandle, outLogFile, errLogFile, fmt.Sprintf("Could not execute xUnit: %s", err))
+		return internalErrorResult(execution, message)
+	}
+	if res.TimedOut || res.OOMKilled {
+		message := appendOutput(outFileHandle, errFileHandle, outLogFile, errLogFile, sandboxLimitMessage(res))
+		return sandboxLimitResult(execution, res, message)
 	}
 
 	message := appendOutput(outFileHandle, errFileHandle, outLogFile, errLogFile, "")
@@ -247,6 +221,7 @@ func executeXUnit(execution Execution) TestResult {
 			}
 		}
 		tests = append(tests, test)
+		execution.reportTest(test)
 	}
 
 	testSummary := xmlquery.FindOne(doc, "//ResultSummary/Counters")
@@ -267,6 +242,7 @@ func executeXUnit(execution Execution) TestResult {
 				Error:   n.InnerText(),
 			}
 			tests = append(tests, test)
+			execution.reportTest(test)
 			failedTests++
 			testsExecuted++
 		}
@@ -1,14 +1,11 @@
 package main
 
 import (
-	"context"
 	"fmt"
 	"io/ioutil"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
-	"syscall"
 	"time"
 
 	xmlquery "github.com/antchfx/xquery/xml"
@@ -29,23 +26,15 @@ func (c CompilerProviderJava) compile(execution Execution) error {
 	libraries[0] = "."
 	libraries[1] = "/jars/" + junitStandaloneJar
 
-	// Docker command
-	arguments, err := dockerArguments(execution.RunDir, execution.ID)
-	if err != nil {
-		return fmt.Errorf("Could not get docker arguments: %s", err)
-	}
-	arguments = append(arguments, "-v", filepath.Join(baseDir, junitStandaloneJar)+":/jars/"+junitStandaloneJar+":ro") // program name first
-	// TODO add restrictions (e.g. memory, cpu, ...)
+	mounts := []Mount{{Source: filepath.Join(baseDir, junitStandaloneJar), Target: "/jars/" + junitStandaloneJar, ReadOnly: true}}
 
 	if stat, err := os.Stat(absLibPath); err == nil && stat.IsDir() {
-		arguments = append(arguments, "-v", absLibPath+":/libs:ro")
+		mounts = append(mounts, Mount{Source: absLibPath, Target: "/libs", ReadOnly: true})
 		libraries = append(libraries, "/libs/*")
 	}
 
-	arguments = append(arguments, *docker_image_java)
-
 	// javac in Docker container
-	arguments = append(arguments, "javac", "-d", ".", "-cp", strings.Join(libraries, ":"))
+	arguments := []string{"javac", "-d", ".", "-cp", strings.Join(libraries, ":")}
 
 	arguments = append(arguments, "-encoding", "utf-8")
 
@@ -56,18 +45,7 @@ func (c CompilerProviderJava) compile(execution Execution) error {
 	}
 	arguments = append(arguments, javaFiles...)
 
-	// TODO timeout?
-	if debug {
-		Debug.Printf("args = %v\n", arguments)
-	}
-	cmd := exec.Command("docker")
-	cmd.Args = arguments
-	cmd.Dir = execution.RunDir
-	out, err := cmd.CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("Error compiling:\n%s", string(out))
-	}
-	return nil
+	return runCompiler(execution, *docker_image_java, mounts, arguments...)
 }
 
 func collectFilesWithExtension(base string, extension string) ([]string, error) {
@@ -88,37 +66,40 @@ func collectFilesWithExtension(base string, extension string) ([]string, error)
 	return result, nil
 }
 
-func executeJava(execution Execution, inFile string, paramFile string, outFile string, errFile string) (err error) {
+func executeJava(execution Execution, tc ioTestCase, outFile string, errFile string) (res SandboxResult, err error) {
 	absLibPath, err := filepath.Abs(filepath.Join(execution.TestDir, libDir))
 	if err != nil {
-		return fmt.Errorf("Internal Error: Could not create absolute path of lib folder")
+		return SandboxResult{}, fmt.Errorf("Internal Error: Could not create absolute path of lib folder")
 	}
 
 	absMainFile, err := filepath.Abs(filepath.Join(execution.RunDir, execution.Config.MainIs+".class"))
 	if err != nil {
-		return fmt.Errorf("Internal Error: Could not create absolute path of main file")
+		return SandboxResult{}, fmt.Errorf("Internal Error: Could not create absolute path of main file")
 	}
 
 	if finfo, err := os.Stat(absMainFile); err != nil || finfo.IsDir() {
-		return fmt.Errorf("Could not find %s (rename your program accordingly and try again)", execution.Config.MainIs+".java")
+		return SandboxResult{}, fmt.Errorf("Could not find %s (rename your program accordingly and try again)", execution.Config.MainIs+".java")
 	}
 	maxMem := execution.Config.MaxMem
 	if maxMem == 0 {
 		maxMem = 100
 	}
 
-	arguments := make([]string, 0)
 	libraries := make([]string, 0)
 
 	libraries = append(libraries, ".")
-	arguments = append(arguments, "-v", filepath.Join(baseDir, junitStandaloneJar)+":/jars/"+junitStandaloneJar+":ro")
+	mounts := []Mount{{Source: filepath.Join(baseDir, junitStandaloneJar), Target: "/jars/" + junitStandaloneJar, ReadOnly: true}}
 
 	if stat, err := os.Stat(absLibPath); err == nil && stat.IsDir() {
-		arguments = append(arguments, "-v", absLibPath+":/libs:ro")
+		mounts = append(mounts, Mount{Source: absLibPath, Target: "/libs", ReadOnly: true})
 		libraries = append(libraries, "/libs/*")
 	}
 
-	return executeProgram(execution, inFile, paramFile, outFile, errFile, arguments, *docker_image_java, "java", "-cp", strings.Join(libraries, ":"), fmt.Sprintf("-Xmx%dm", maxMem), execution.Config.MainIs)
+	return executeProgram(execution, tc, outFile, errFile, SandboxCommand{
+		Image:   *docker_image_java,
+		Command: []string{"java", "-cp", strings.Join(libraries, ":"), fmt.Sprintf("-Xmx%dm", maxMem), execution.Config.MainIs},
+		Mounts:  mounts,
+	})
 }
 
 func executeJUnit(execution Execution) TestResult {
@@ -137,37 +118,31 @@ func executeJUnit(execution Execution) TestResult {
 		timeout = 10
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeout)*time.Second)
-	defer func() {
-		exec.Command("docker", "stop", testid).Run()
-		cancel()
-	}()
-
 	libraries := make([]string, 1)
 	libraries[0] = "/jars/" + junitStandaloneJar
 
-	// Docker command
-	arguments, err := dockerArguments(execution.RunDir, testid)
+	code, err := codeMount(execution.RunDir)
 	if err != nil {
 		return internalErrorResult(execution, fmt.Sprintf("Could not get docker arguments: %s", err))
 	}
-	arguments = append(arguments, "-v", filepath.Join(baseDir, junitStandaloneJar)+":/jars/"+junitStandaloneJar+":ro")
+	mounts := []Mount{code, {Source: filepath.Join(baseDir, junitStandaloneJar), Target: "/jars/" + junitStandaloneJar, ReadOnly: true}}
 
 	if stat, err := os.Stat(absLibPath); err == nil && stat.IsDir() {
-		arguments = append(arguments, "-v", absLibPath+":/libs:ro")
+		mounts = append(mounts, Mount{Source: absLibPath, Target: "/libs", ReadOnly: true})
 		libraries = append(libraries, "/libs/*")
 	}
 
-	// execute in Java environment
-	arguments = append(arguments, *docker_image_java)
-
 	// call JUnit runner
 	libraries = append(libraries, ".")
-	arguments = append(arguments, "java", "-jar", "/jars/"+junitStandaloneJar, "-cp", ".", "--scan-classpath=.", "--reports-dir=reports", "--config=junit.platform.output.capture.stderr=true", "--config=junit.platform.output.capture.stdout=true")
-
-	cmd := exec.CommandContext(ctx, "docker")
-	cmd.Args = arguments
-	cmd.Dir = absRunDir
+	sandboxCmd := SandboxCommand{
+		Name:     testid,
+		Image:    *docker_image_java, // execute in Java environment
+		Command:  []string{"java", "-jar", "/jars/" + junitStandaloneJar, "-cp", ".", "--scan-classpath=.", "--reports-dir=reports", "--config=junit.platform.output.capture.stderr=true", "--config=junit.platform.output.capture.stdout=true"},
+		WorkDir:  "/code",
+		Mounts:   mounts,
+		Timeout:  time.Duration(timeout) * time.Second,
+		Security: execution.securityProfile(),
+	}
 
 	outLogFile := filepath.Join(absRunDir, "junit.out.log")
 	outFileHandle, err := os.Create(outLogFile)
@@ -183,39 +158,25 @@ func executeJUnit(execution Execution) TestResult {
 	}
 	defer errFileHandle.Close()
 
-	cmd.Stdout = LimitWriter(outFileHandle, maxFileSize)
-	cmd.Stderr = LimitWriter(errFileHandle, maxFileSize)
+	sandboxCmd.Stdout = outFileHandle
+	sandboxCmd.StdoutLimit = maxFileSize
+	sandboxCmd.Stderr = errFileHandle
+	sandboxCmd.StderrLimit = maxFileSize
 	startTime := time.Now()
-	err = cmd.Run()
 	// executing JUnit might result in exit code 1 because of failed tests
-	cancel()
+	res, err := sandbox.Run(sandboxCmd)
 	duration := time.Since(startTime)
 	testExecutionTimeHistogram.Observe(duration.Seconds())
 	if debug {
 		Debug.Printf("Duration of JUnit test execution: %s", duration)
 	}
 	if err != nil {
-		if exiterr, ok := err.(*exec.ExitError); ok {
-			if status, ok := exiterr.Sys().(syscall.WaitStatus); ok {
-				if status.ExitStatus() == -1 { // killed
-					message := appendOutput(outFileHandle, errFileHandle, outLogFile, errLogFile, "Timeout")
-					return TestResult{
-						ID:            execution.ID,
-						Compiled:      true,
-						TestsExecuted: 1,
-						TestsFailed:   1,
-						Tests: []Test{
-							{
-								Name:    "Testfälle",
-								Success: false,
-								Error:   message,
-							},
-						},
-					}
-				}
-			}
-		}
-
+		message := appendOutput(outFileHandle, errFileHandle, outLogFile, errLogFile, fmt.Sprintf("Could not execute JUnit: %s", err))
+		return internalErrorResult(execution, message)
+	}
+	if res.TimedOut || res.OOMKilled {
+		message := appendOutput(outFileHandle, errFileHandle, outLogFile, errLogFile, sandboxLimitMessage(res))
+		return sandboxLimitResult(execution, res, message)
 	}
 
 	message := appendOutput(outFileHandle, errFileHandle, outLogFile, errLogFile, "")
@@ -230,7 +191,7 @@ func executeJUnit(execution Execution) TestResult {
 		message := "Could not parse result of JUnit execution.\n\n\n" + message
 		return internalErrorResult(execution, message)
 	}
-	parseTestResults(doc, &failureCount, &tests)
+	parseTestResults(execution, doc, &failureCount, &tests)
 
 	reportFile2, err := os.Open(filepath.Join(absRunDir, "reports", "TEST-junit-vintage.xml"))
 	// Parse XML document.
@@ -239,7 +200,7 @@ func executeJUnit(execution Execution) TestResult {
 		message := "Could not parse result of JUnit execution.\n\n\n" + message
 		return internalErrorResult(execution, message)
 	}
-	parseTestResults(doc2, &failureCount, &tests)
+	parseTestResults(execution, doc2, &failureCount, &tests)
 
 	return TestResult{
 		ID:            execution.ID,
@@ -250,7 +211,7 @@ func executeJUnit(execution Execution) TestResult {
 	}
 }
 
-func parseTestResults(doc *xmlquery.Node, failureCount *int, tests *[]Test) {
+func parseTestResults(execution Execution, doc *xmlquery.Node, failureCount *int, tests *[]Test) {
 	for _, n := range xmlquery.Find(doc, "//testcase") {
 		failures := xmlquery.Find(n, "/failure")
 		errors := xmlquery.Find(n, "/error")
@@ -279,6 +240,7 @@ func parseTestResults(doc *xmlquery.Node, failureCount *int, tests *[]Test) {
 			}
 		}
 		*tests = append(*tests, test)
+		execution.reportTest(test)
 	}
 }
 
@@ -308,9 +270,11 @@ func (t JUnitTestRunner) executeTest(execution Execution) TestResult {
 	if compileError != nil {
 		junitIncompatibilityCount.WithLabelValues(execution.Test).Inc()
 		return TestResult{
-			ID:           execution.ID,
-			Compiled:     false,
-			CompileError: fmt.Sprintf("Error compiling test cases  (maybe wrong name of submitted class)\n%s", compileError.Error()),
+			ID:             execution.ID,
+			Compiled:       false,
+			CompileError:   fmt.Sprintf("Error compiling test cases  (maybe wrong name of submitted class)\n%s", compileError.Error()),
+			CompileTimeout: isCompileTimeout(compileError),
+			Error:          testCompileApiError(compileError),
 		}
 	}
 
@@ -1,13 +1,11 @@
 package main
 
 import (
-	"context"
 	"fmt"
 	"os"
-	"os/exec"
 	"path/filepath"
+	"strconv"
 	"strings"
-	"syscall"
 	"time"
 )
 
@@ -70,29 +68,23 @@ func executeMatlabTest(execution Execution) TestResult {
 		timeout = 10
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeout)*time.Second)
-	defer func() {
-		exec.Command("docker", "stop", testid).Run()
-		cancel()
-	}()
-
-	// Docker command
-	arguments, err := dockerArguments(execution.RunDir, testid)
+	code, err := codeMount(execution.RunDir)
 	if err != nil {
 		return internalErrorResult(execution, fmt.Sprintf("Could not get docker arguments: %s", err))
 	}
 
-	// execute in Matlab environment
-	arguments = append(arguments, *docker_image_matlab)
-
-	// call Pytest runner
-	arguments = append(arguments, "/usr/local/MATLAB/R2018b/bin/matlab", "-nodisplay", "-sd", "/code", "-r", "disp("+execution.Config.MainIs+");exit")
-
-	cmd := exec.CommandContext(ctx, "docker")
-	cmd.Args = arguments
-	cmd.Dir = absRunDir
+	// call test function in Matlab environment
+	sandboxCmd := SandboxCommand{
+		Name:     testid,
+		Image:    *docker_image_matlab,
+		Command:  []string{"/usr/local/MATLAB/R2018b/bin/matlab", "-nodisplay", "-sd", "/code", "-r", "disp(" + execution.Config.MainIs + ");exit"},
+		WorkDir:  "/code",
+		Mounts:   []Mount{code},
+		Timeout:  time.Duration(timeout) * time.Second,
+		Security: execution.securityProfile(),
+	}
 	// Test-Funktion aufrufen:
-	//cmd.Stdin = strings.NewReader("disp("+execution.Config.MainIs + ");exit")
+	//sandboxCmd.Stdin = strings.NewReader("disp("+execution.Config.MainIs + ");exit")
 
 	outLogFile := filepath.Join(absRunDir, "matlab.out.log")
 	outFileHandle, err := os.Create(outLogFile)
@@ -108,41 +100,29 @@ func executeMatlabTest(execution Execution) TestResult {
 	}
 	defer errFileHandle.Close()
 
-	cmd.Stdout = LimitWriter(outFileHandle, maxFileSize)
-	cmd.Stderr = LimitWriter(errFileHandle, maxFileSize)
+	sandboxCmd.Stdout = outFileHandle
+	sandboxCmd.StdoutLimit = maxFileSize
+	sandboxCmd.Stderr = errFileHandle
+	sandboxCmd.StderrLimit = maxFileSize
 	startTime := time.Now()
-	err = cmd.Run()
-	// executing JUnit might result in exit code 1 because of failed tests
-	cancel()
+	res, err := sandbox.Run(sandboxCmd)
 	duration := time.Since(startTime)
 	testExecutionTimeHistogram.Observe(duration.Seconds())
 	if debug {
 		Debug.Printf("Duration of JUnit test execution: %s", duration)
 	}
 	if err != nil {
-		if exiterr, ok := err.(*exec.ExitError); ok {
-			if status, ok := exiterr.Sys().(syscall.WaitStatus); ok {
-				errorMsg := "Failed with exit code " + string(status.ExitStatus())
-				if status.ExitStatus() == -1 {
-					errorMsg = "Timeout"
-				}
-				message := appendOutput(outFileHandle, errFileHandle, outLogFile, errLogFile, errorMsg)
-
-				return TestResult{
-					ID:            execution.ID,
-					Compiled:      true,
-					TestsExecuted: 1,
-					TestsFailed:   1,
-					Tests: []Test{
-						{
-							Name:    "Testfälle",
-							Success: false,
-							Error:   message,
-						},
-					},
-				}
-			}
+		message := appendOutput(outFileHandle, errFileHandle, outLogFile, errLogFile, fmt.Sprintf("Could not execute Matlab: %s", err))
+		return internalErrorResult(execution, message)
+	}
+	if res.TimedOut || res.OOMKilled || res.ExitCode != 0 {
+		errorMsg := "Failed with exit code " + strconv.Itoa(res.ExitCode)
+		if res.TimedOut || res.OOMKilled {
+			errorMsg = sandboxLimitMessage(res)
 		}
+		message := appendOutput(outFileHandle, errFileHandle, outLogFile, errLogFile, errorMsg)
+
+		return sandboxLimitResult(execution, res, message)
 	}
 
 	stderr, _ := readFileToString(errLogFile)
@@ -1,14 +1,11 @@
 package main
 
 import (
-	"context"
 	"fmt"
 	"io/ioutil"
 	"os"
-	"os/exec"
 	"path/filepath"
 	"strings"
-	"syscall"
 	"time"
 
 	xmlquery "github.com/antchfx/xquery/xml"
@@ -27,20 +24,13 @@ func (c CompilerProviderPython) compile(execution Execution) error {
 		return fmt.Errorf("Test not found: %s", err)
 	}
 
-	// Docker command
-	arguments, err := dockerArguments(execution.RunDir, execution.ID)
-	if err != nil {
-		return fmt.Errorf("Could not get docker arguments: %s", err)
-	}
-
+	var mounts []Mount
 	if stat, err := os.Stat(absLibPath); err == nil && stat.IsDir() {
-		arguments = append(arguments, "-v", absLibPath+":/libs:ro")
+		mounts = append(mounts, Mount{Source: absLibPath, Target: "/libs", ReadOnly: true})
 	}
 
-	arguments = append(arguments, *docker_image_python)
-
 	// run python compile in Docker container
-	arguments = append(arguments, "python3", "-m", "py_compile")
+	arguments := []string{"python3", "-m", "py_compile"}
 	// add python files from current directory
 	for _, f := range files {
 		name := f.Name()
@@ -49,25 +39,14 @@ func (c CompilerProviderPython) compile(execution Execution) error {
 		}
 	}
 
-	// TODO timeout?
-	if debug {
-		Debug.Printf("args = %v\n", arguments)
-	}
-	cmd := exec.Command("docker")
-	cmd.Args = arguments
-	cmd.Dir = execution.RunDir
-	out, err := cmd.CombinedOutput()
-	if err != nil {
-		return fmt.Errorf("Error compiling:\n%s", string(out))
-	}
-	return nil
+	return runCompiler(execution, *docker_image_python, mounts, arguments...)
 }
 
-func executePython(execution Execution, inFile string, paramFile string, outFile string, errFile string) (err error) {
+func executePython(execution Execution, tc ioTestCase, outFile string, errFile string) (res SandboxResult, err error) {
 
 	files, err := ioutil.ReadDir(execution.RunDir)
 	if err != nil {
-		return fmt.Errorf("Internal Error: Could not read Test files")
+		return SandboxResult{}, fmt.Errorf("Internal Error: Could not read Test files")
 	}
 	mainFile := ""
 	if len(execution.Config.MainIs) > 0 {
@@ -80,26 +59,22 @@ func executePython(execution Execution, inFile string, paramFile string, outFile
 			}
 		}
 		if len(mainFile) == 0 {
-			return fmt.Errorf("Keine Python Datei gefunden!")
+			return SandboxResult{}, fmt.Errorf("Keine Python Datei gefunden!")
 		}
 	}
 
 	absMainFile, err := filepath.Abs(filepath.Join(execution.RunDir, mainFile))
 	if err != nil {
-		return fmt.Errorf("Internal Error: Could not create absolute path of main file")
+		return SandboxResult{}, fmt.Errorf("Internal Error: Could not create absolute path of main file")
 	}
 
 	if finfo, err := os.Stat(absMainFile); err != nil || finfo.IsDir() {
-		return fmt.Errorf("Could not find %s (rename your program accordingly and try again)", mainFile)
+		return SandboxResult{}, fmt.Errorf("Could not find %s (rename your program accordingly and try again)", mainFile)
 	}
-	maxMem := execution.Config.MaxMem
-	if maxMem == 0 {
-		maxMem = 100
-	}
-
-	arguments := make([]string, 0)
-
-	return executeProgram(execution, inFile, paramFile, outFile, errFile, arguments, *docker_image_python, "python3", mainFile)
+	return executeProgram(execution, tc, outFile, errFile, SandboxCommand{
+		Image:   *docker_image_python,
+		Command: []string{"python3", mainFile},
+	})
 }
 
 func executePytest(execution Execution) TestResult {
@@ -114,27 +89,21 @@ func executePytest(execution Execution) TestResult {
 		timeout = 10
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeout)*time.Second)
-	defer func() {
-		exec.Command("docker", "stop", testid).Run()
-		cancel()
-	}()
-
-	// Docker command
-	arguments, err := dockerArguments(execution.RunDir, testid)
+	code, err := codeMount(execution.RunDir)
 	if err != nil {
 		return internalErrorResult(execution, fmt.Sprintf("Could not get docker arguments: %s", err))
 	}
 
-	// execute in Python environment
-	arguments = append(arguments, *docker_image_python)
-
-	// call Pytest runner
-	arguments = append(arguments, "python3", "-m", "pytest", "-o", "junit_family=xunit1", "-v", "--junitxml=./test-result.xml", "--doctest-glob='*.md'", "--doctest-modules")
-
-	cmd := exec.CommandContext(ctx, "docker")
-	cmd.Args = arguments
-	cmd.Dir = absRunDir
+	// call Pytest runner in Python environment
+	sandboxCmd := SandboxCommand{
+		Name:     testid,
+		Image:    *docker_image_python,
+		Command:  []string{"python3", "-m", "pytest", "-o", "junit_family=xunit1", "-v", "--junitxml=./test-result.xml", "--doctest-glob='*.md'", "--doctest-modules"},
+		WorkDir:  "/code",
+		Mounts:   []Mount{code},
+		Timeout:  time.Duration(timeout) * time.Second,
+		Security: execution.securityProfile(),
+	}
 
 	outLogFile := filepath.Join(absRunDir, "junit.out.log")
 	outFileHandle, err := os.Create(outLogFile)
@@ -150,39 +119,25 @@ func executePytest(execution Execution) TestResult {
 	}
 	defer errFileHandle.Close()
 
-	cmd.Stdout = LimitWriter(outFileHandle, maxFileSize)
-	cmd.Stderr = LimitWriter(errFileHandle, maxFileSize)
+	sandboxCmd.Stdout = outFileHandle
+	sandboxCmd.StdoutLimit = maxFileSize
+	sandboxCmd.Stderr = errFileHandle
+	sandboxCmd.StderrLimit = maxFileSize
 	startTime := time.Now()
-	err = cmd.Run()
-	// executing JUnit might result in exit code 1 because of failed tests
-	cancel()
+	// executing pytest might result in exit code 1 because of failed tests
+	res, err := sandbox.Run(sandboxCmd)
 	duration := time.Since(startTime)
 	testExecutionTimeHistogram.Observe(duration.Seconds())
 	if debug {
 		Debug.Printf("Duration of JUnit test execution: %s", duration)
 	}
 	if err != nil {
-		if exiterr, ok := err.(*exec.ExitError); ok {
-			if status, ok := exiterr.Sys().(syscall.WaitStatus); ok {
-				if status.ExitStatus() == -1 { // killed
-					message := appendOutput(outFileHandle, errFileHandle, outLogFile, errLogFile, "Timeout")
-					return TestResult{
-						ID:            execution.ID,
-						Compiled:      true,
-						TestsExecuted: 1,
-						TestsFailed:   1,
-						Tests: []Test{
-							{
-								Name:    "Testfälle",
-								Success: false,
-								Error:   message,
-							},
-						},
-					}
-				}
-			}
-		}
-
+		message := appendOutput(outFileHandle, errFileHandle, outLogFile, errLogFile, fmt.Sprintf("Could not execute pytest: %s", err))
+		return internalErrorResult(execution, message)
+	}
+	if res.TimedOut || res.OOMKilled {
+		message := appendOutput(outFileHandle, errFileHandle, outLogFile, errLogFile, sandboxLimitMessage(res))
+		return sandboxLimitResult(execution, res, message)
 	}
 
 	message := appendOutput(outFileHandle, errFileHandle, outLogFile, errLogFile, "")
@@ -225,6 +180,7 @@ func executePytest(execution Execution) TestResult {
 			test.Error = errorMessage
 		}
 		tests = append(tests, test)
+		execution.reportTest(test)
 	}
 
 	return TestResult{
@@ -0,0 +1,653 @@
+package main
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+const (
+	// scope of the Assignment and Grade Services needed to send scores
+	ltiScoreScope = "https://purl.imsglobal.org/spec/lti-ags/scope/score"
+	// custom parameter with the test folders the user may test, separated by commas
+	ltiScopesParameter = "rte_scopes"
+	// prefix of the context roles of LTI 1.3, e.g. membership#Instructor
+	ltiMembershipRoles = "http://purl.imsglobal.org/vocab/lis/v2/membership"
+)
+
+// ltiInstructorRoles are the roles of users who see the runs of all users
+var ltiInstructorRoles = map[string]bool{
+	ltiMembershipRoles + "#Instructor":                                        true,
+	ltiMembershipRoles + "#Administrator":                                     true,
+	ltiMembershipRoles + "#ContentDeveloper":                                  true,
+	"http://purl.imsglobal.org/vocab/lis/v2/institution/person#Administrator": true,
+	"http://purl.imsglobal.org/vocab/lis/v2/system/person#Administrator":      true,
+}
+
+// isInstructor tells if one of the roles of a token is an instructor role or a sub-role of Instructor, e.g. a teaching assistant
+func isInstructor(roles []string) bool {
+	for _, role := range roles {
+		if ltiInstructorRoles[role] || strings.HasPrefix(role, ltiMembershipRoles+"/Instructor#") {
+			return true
+		}
+	}
+	return false
+}
+
+// LtiPlatform is a learning management system (e.g. Moodle or ILIAS) which sends signed tokens to RTE
+type LtiPlatform struct {
+	// Name identifies the platform in logs and metrics
+	Name     string
+	Issuer   string
+	ClientID string
+	// JWKSFile contains the public keys of the platform as JSON web key set, alternatively the keys can be given in Keys
+	JWKSFile string       `json:",omitempty"`
+	Keys     *jsonWebKeys `json:",omitempty"`
+	// Scopes limits the test folders which tokens of the platform can give access to, no scopes mean no limit
+	Scopes []string `json:",omitempty"`
+	// TokenURL is the OAuth 2 token endpoint of the platform, used to send grades
+	TokenURL string `json:",omitempty"`
+	// ToolKeyFile is the PEM encoded private key of RTE which signs the requests for access tokens
+	ToolKeyFile string `json:",omitempty"`
+	ToolKeyID   string `json:",omitempty"`
+
+	publicKeys map[string]*rsa.PublicKey
+	toolKey    *rsa.PrivateKey
+}
+
+// LtiConfig is the content of the file given by the lti flag
+type LtiConfig struct {
+	Platforms []*LtiPlatform
+}
+
+// ltiConfig is nil if LTI is not configured
+var ltiConfig *LtiConfig
+
+type jsonWebKey struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid,omitempty"`
+	Alg string `json:"alg,omitempty"`
+	Use string `json:"use,omitempty"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+type jsonWebKeys struct {
+	Keys []jsonWebKey `json:"keys"`
+}
+
+func (k jsonWebKey) publicKey() (*rsa.PublicKey, error) {
+	if k.Kty != "RSA" {
+		return nil, fmt.Errorf("Unsupported key type %s", k.Kty)
+	}
+	n, err := base64.RawURLEncoding.DecodeString(k.N)
+	if err != nil {
+		return nil, err
+	}
+	e, err := base64.RawURLEncoding.DecodeString(k.E)
+	if err != nil {
+		return nil, err
+	}
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(n), E: int(new(big.Int).SetBytes(e).Int64())}, nil
+}
+
+func newJsonWebKey(kid string, key *rsa.PublicKey) jsonWebKey {
+	return jsonWebKey{
+		Kty: "RSA",
+		Kid: kid,
+		Alg: "RS256",
+		Use: "sig",
+		N:   base64.RawURLEncoding.EncodeToString(key.N.Bytes()),
+		E:   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(key.E)).Bytes()),
+	}
+}
+
+func loadLtiConfig(file string) (*LtiConfig, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	var config LtiConfig
+	if err := json.Unmarshal(data, &config); err != nil {
+		return nil, fmt.Errorf("Could not read LTI configuration %s: %s", file, err)
+	}
+	for _, platform := range config.Platforms {
+		if err := platform.loadKeys(); err != nil {
+			return nil, fmt.Errorf("LTI platform %s: %s", platform.Name, err)
+		}
+	}
+	return &config, nil
+}
+
+func (p *LtiPlatform) loadKeys() error {
+	if p.Name == "" || p.Issuer == "" || p.ClientID == "" {
+		return fmt.Errorf("Name, Issuer and ClientID are required")
+	}
+	keys := p.Keys
+	if p.JWKSFile != "" {
+		data, err := ioutil.ReadFile(p.JWKSFile)
+		if err != nil {
+			return err
+		}
+		keys = &jsonWebKeys{}
+		if err := json.Unmarshal(data, keys); err != nil {
+			return fmt.Errorf("Could not read key set %s: %s", p.JWKSFile, err)
+		}
+	}
+	if keys == nil || len(keys.Keys) == 0 {
+		return fmt.Errorf("No public keys given")
+	}
+	p.publicKeys = make(map[string]*rsa.PublicKey)
+	for _, k := range keys.Keys {
+		key, err := k.publicKey()
+		if err != nil {
+			return fmt.Errorf("Invalid key %s: %s", k.Kid, err)
+		}
+		p.publicKeys[k.Kid] = key
+	}
+	if p.ToolKeyFile != "" {
+		key, err := loadRsaPrivateKey(p.ToolKeyFile)
+		if err != nil {
+			return err
+		}
+		p.toolKey = key
+	}
+	return nil
+}
+
+func loadRsaPrivateKey(file string) (*rsa.PrivateKey, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+	block, _ := pem.Decode(data)
+	if block == nil {
+		return nil, fmt.Errorf("No PEM data found in %s", file)
+	}
+	if key, err := x509.ParsePKCS1PrivateKey(block.Bytes); err == nil {
+		return key, nil
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return nil, fmt.Errorf("Could not parse private key %s: %s", file, err)
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return nil, fmt.Errorf("%s is not an RSA key", file)
+	}
+	return rsaKey, nil
+}
+
+// audience is a single string or a list of strings
+type audience []string
+
+func (a *audience) UnmarshalJSON(data []byte) error {
+	var single string
+	if err := json.Unmarshal(data, &single); err == nil {
+		*a = audience{single}
+		return nil
+	}
+	var list []string
+	if err := json.Unmarshal(data, &list); err != nil {
+		return err
+	}
+	*a = list
+	return nil
+}
+
+func (a audience) contains(s string) bool {
+	for _, aud := range a {
+		if aud == s {
+			return true
+		}
+	}
+	return false
+}
+
+type ltiContext struct {
+	ID    string `json:"id"`
+	Label string `json:"label,omitempty"`
+	Title string `json:"title,omitempty"`
+}
+
+type agsEndpoint struct {
+	Scope     []string `json:"scope"`
+	LineItems string   `json:"lineitems,omitempty"`
+	LineItem  string   `json:"lineitem,omitempty"`
+}
+
+type ltiClaims struct {
+	Issuer    string                 `json:"iss"`
+	Subject   string                 `json:"sub"`
+	Audience  audience               `json:"aud"`
+	Expires   int64                  `json:"exp"`
+	NotBefore int64                  `json:"nbf,omitempty"`
+	IssuedAt  int64                  `json:"iat"`
+	Nonce     string                 `json:"nonce"`
+	Context   *ltiContext            `json:"https://purl.imsglobal.org/spec/lti/claim/context,omitempty"`
+	Roles     []string               `json:"https://purl.imsglobal.org/spec/lti/claim/roles,omitempty"`
+	Custom    map[string]interface{} `json:"https://purl.imsglobal.org/spec/lti/claim/custom,omitempty"`
+	Endpoint  *agsEndpoint           `json:"https://purl.imsglobal.org/spec/lti-ags/claim/endpoint,omitempty"`
+}
+
+type jwtHeader struct {
+	Alg string `json:"alg"`
+	Kid string `json:"kid,omitempty"`
+	Typ string `json:"typ,omitempty"`
+}
+
+// signJWT creates a token signed with RS256
+func signJWT(kid string, claims interface{}, key *rsa.PrivateKey) (string, error) {
+	header, err := json.Marshal(jwtHeader{Alg: "RS256", Kid: kid, Typ: "JWT"})
+	if err != nil {
+		return "", err
+	}
+	payload, err := json.Marshal(claims)
+	if err != nil {
+		return "", err
+	}
+	signingInput := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(payload)
+	hash := sha256.Sum256([]byte(signingInput))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, key, crypto.SHA256, hash[:])
+	if err != nil {
+		return "", err
+	}
+	return signingInput + "." + base64.RawURLEncoding.EncodeToString(signature), nil
+}
+
+// verifyJWT checks the RS256 signature of the token and decodes its payload into claims.
+// The key is selected by the key id in the header of the token.
+func verifyJWT(token string, key func(header jwtHeader, payload []byte) (*rsa.PublicKey, error), claims interface{}) error {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return fmt.Errorf("Malformed token")
+	}
+	headerData, err := base64.RawURLEncoding.DecodeString(parts[0])
+	if err != nil {
+		return fmt.Errorf("Malformed token header: %s", err)
+	}
+	var header jwtHeader
+	if err := json.Unmarshal(headerData, &header); err != nil {
+		return fmt.Errorf("Malformed token header: %s", err)
+	}
+	if header.Alg != "RS256" {
+		return fmt.Errorf("Unsupported algorithm %s", header.Alg)
+	}
+	payload, err := base64.RawURLEncoding.DecodeString(parts[1])
+	if err != nil {
+		return fmt.Errorf("Malformed token payload: %s", err)
+	}
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return fmt.Errorf("Malformed token signature: %s", err)
+	}
+	publicKey, err := key(header, payload)
+	if err != nil {
+		return err
+	}
+	hash := sha256.Sum256([]byte(parts[0] + "." + parts[1]))
+	if err := rsa.VerifyPKCS1v15(publicKey, crypto.SHA256, hash[:], signature); err != nil {
+		return fmt.Errorf("Invalid signature")
+	}
+	return json.Unmarshal(payload, claims)
+}
+
+// tolerated difference between the clocks of RTE and the platforms
+const ltiClockSkew = time.Minute
+
+func (c *ltiClaims) checkTimes(now time.Time) error {
+	if c.Expires == 0 || now.After(time.Unix(c.Expires, 0).Add(ltiClockSkew)) {
+		return fmt.Errorf("Token expired")
+	}
+	if c.NotBefore != 0 && now.Before(time.Unix(c.NotBefore, 0).Add(-ltiClockSkew)) {
+		return fmt.Errorf("Token not valid yet")
+	}
+	if c.IssuedAt != 0 && now.Before(time.Unix(c.IssuedAt, 0).Add(-ltiClockSkew)) {
+		return fmt.Errorf("Token issued in the future")
+	}
+	return nil
+}
+
+// ltiLaunch contains the information of a token needed to send the grade of a run back to the platform
+type ltiLaunch struct {
+	platform *LtiPlatform
+	user     string
+	context  *ltiContext
+	endpoint *agsEndpoint
+	nonce    string
+	expires  time.Time
+}
+
+// ltiNonces are the nonces of the tokens which started a run, kept until the tokens expire
+var ltiNonces = struct {
+	sync.Mutex
+	expires map[string]time.Time
+}{expires: make(map[string]time.Time)}
+
+// useNonce records that the token of the launch started a run, false if it already started one.
+// A captured token can thus not be replayed to start runs and send their grades.
+func (launch *ltiLaunch) useNonce() bool {
+	ltiNonces.Lock()
+	defer ltiNonces.Unlock()
+	now := time.Now()
+	for nonce, expires := range ltiNonces.expires {
+		if now.After(expires) {
+			delete(ltiNonces.expires, nonce)
+		}
+	}
+	key := launch.platform.Issuer + " " + launch.nonce
+	if _, ok := ltiNonces.expires[key]; ok {
+		return false
+	}
+	// expired tokens are rejected anyway
+	ltiNonces.expires[key] = launch.expires.Add(ltiClockSkew)
+	return true
+}
+
+// ltiCaller verifies a token of a platform and returns the caller described by its claims
+func ltiCaller(token string) (Caller, error) {
+	var platform *LtiPlatform
+	var claims ltiClaims
+	err := verifyJWT(token, func(header jwtHeader, payload []byte) (*rsa.PublicKey, error) {
+		var unverified ltiClaims
+		if err := json.Unmarshal(payload, &unverified); err != nil {
+			return nil, fmt.Errorf("Malformed token payload: %s", err)
+		}
+		for _, p := range ltiConfig.Platforms {
+			if p.Issuer == unverified.Issuer && unverified.Audience.contains(p.ClientID) {
+				platform = p
+				break
+			}
+		}
+		if platform == nil {
+			return nil, fmt.Errorf("Unknown issuer %s", unverified.Issuer)
+		}
+		key, ok := platform.publicKeys[header.Kid]
+		if !ok {
+			return nil, fmt.Errorf("Unknown key %s of issuer %s", header.Kid, platform.Issuer)
+		}
+		return key, nil
+	}, &claims)
+	if err != nil {
+		return Caller{}, err
+	}
+	if err := claims.checkTimes(time.Now()); err != nil {
+		return Caller{}, err
+	}
+	if claims.Subject == "" {
+		return Caller{}, fmt.Errorf("Token without subject")
+	}
+	if claims.Nonce == "" {
+		return Caller{}, fmt.Errorf("Token without nonce")
+	}
+
+	// the token gives access to the test folders in the custom parameter, as far as the platform allows
+	platformCaller := Caller{Scopes: platform.Scopes, Admin: len(platform.Scopes) == 0}
+	var scopes []string
+	if value, ok := claims.Custom[ltiScopesParameter]; ok {
+		for _, scope := range strings.Split(fmt.Sprint(value), ",") {
+			scope = strings.TrimSpace(scope)
+			if scope != "" && platformCaller.canAccess(scope) {
+				scopes = append(scopes, scope)
+			}
+		}
+	}
+
+	return Caller{
+		Name:       platform.Name,
+		User:       claims.Subject,
+		Scopes:     scopes,
+		Instructor: isInstructor(claims.Roles),
+		lti: &ltiLaunch{
+			platform: platform,
+			user:     claims.Subject,
+			context:  claims.Context,
+			endpoint: claims.Endpoint,
+			nonce:    claims.Nonce,
+			expires:  time.Unix(claims.Expires, 0),
+		},
+	}, nil
+}
+
+// bearerToken returns the token of the Authorization header
+func bearerToken(r *http.Request) string {
+	auth := r.Header.Get("Authorization")
+	if len(auth) > 7 && strings.EqualFold(auth[:7], "Bearer ") {
+		return strings.TrimSpace(auth[7:])
+	}
+	return ""
+}
+
+type accessToken struct {
+	token   string
+	expires time.Time
+}
+
+var ltiAccessTokens = struct {
+	sync.Mutex
+	tokens map[*LtiPlatform]accessToken
+}{tokens: make(map[*LtiPlatform]accessToken)}
+
+var ltiHttpClient = &http.Client{Timeout: 30 * time.Second}
+
+// accessToken requests an OAuth 2 access token for sending scores using the client credentials grant with a signed assertion
+// The lock is not held during the request, so that a slow platform does not block the other requests.
+func (p *LtiPlatform) accessToken() (string, error) {
+	ltiAccessTokens.Lock()
+	cached, ok := ltiAccessTokens.tokens[p]
+	ltiAccessTokens.Unlock()
+	if ok && time.Now().Before(cached.expires) {
+		return cached.token, nil
+	}
+	if p.TokenURL == "" || p.toolKey == nil {
+		return "", fmt.Errorf("TokenURL and ToolKeyFile are required to send grades")
+	}
+
+	now := time.Now()
+	assertion, err := signJWT(p.ToolKeyID, map[string]interface{}{
+		"iss": p.ClientID,
+		"sub": p.ClientID,
+		"aud": p.TokenURL,
+		"iat": now.Unix(),
+		"exp": now.Add(5 * time.Minute).Unix(),
+		"jti": uuid.NewV4().String(),
+	}, p.toolKey)
+	if err != nil {
+		return "", err
+	}
+	resp, err := ltiHttpClient.PostForm(p.TokenURL, url.Values{
+		"grant_type":            {"client_credentials"},
+		"client_assertion_type": {"urn:ietf:params:oauth:client-assertion-type:jwt-bearer"},
+		"client_assertion":      {assertion},
+		"scope":                 {ltiScoreScope},
+	})
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return "", fmt.Errorf("Token request failed: %s %s", resp.Status, string(body))
+	}
+	var token struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&token); err != nil {
+		return "", err
+	}
+	// renew the token a bit before it expires
+	ltiAccessTokens.Lock()
+	ltiAccessTokens.tokens[p] = accessToken{token: token.AccessToken, expires: now.Add(time.Duration(token.ExpiresIn)*time.Second - time.Minute)}
+	ltiAccessTokens.Unlock()
+	return token.AccessToken, nil
+}
+
+type agsScore struct {
+	UserID           string  `json:"userId"`
+	ScoreGiven       float64 `json:"scoreGiven"`
+	ScoreMaximum     float64 `json:"scoreMaximum"`
+	Comment          string  `json:"comment,omitempty"`
+	ActivityProgress string  `json:"activityProgress"`
+	GradingProgress  string  `json:"gradingProgress"`
+	Timestamp        string  `json:"timestamp"`
+}
+
+// ltiSentScores are the highest scores sent for a user and a line item, as part of the maximum
+var ltiSentScores = struct {
+	sync.Mutex
+	scores map[string]float64
+}{scores: make(map[string]float64)}
+
+func (launch *ltiLaunch) scoreKey() string {
+	return launch.endpoint.LineItem + " " + launch.user
+}
+
+// raisesScore tells if the score is higher than the scores sent before for the user and the line item.
+// A later run with fewer passed tests, e.g. with a compile error, does not lower the grade at the platform.
+func (launch *ltiLaunch) raisesScore(score agsScore) bool {
+	ltiSentScores.Lock()
+	defer ltiSentScores.Unlock()
+	sent, ok := ltiSentScores.scores[launch.scoreKey()]
+	return !ok || score.ScoreGiven/score.ScoreMaximum > sent
+}
+
+// scoreSent records the score sent for the user and the line item
+func (launch *ltiLaunch) scoreSent(score agsScore) {
+	ltiSentScores.Lock()
+	defer ltiSentScores.Unlock()
+	key, fraction := launch.scoreKey(), score.ScoreGiven/score.ScoreMaximum
+	if sent, ok := ltiSentScores.scores[key]; !ok || fraction > sent {
+		ltiSentScores.scores[key] = fraction
+	}
+}
+
+// canSendGrade checks if the platform allows sending scores for the launch
+func (launch *ltiLaunch) canSendGrade() bool {
+	if launch.endpoint == nil || launch.endpoint.LineItem == "" {
+		return false
+	}
+	for _, scope := range launch.endpoint.Scope {
+		if scope == ltiScoreScope {
+			return true
+		}
+	}
+	return false
+}
+
+// sendLtiGrade sends the number of passed tests, or their points if the tests have weights, as score to the line item of the launch.
+// The score is only sent if it is higher than the scores sent before, it returns if the score was sent.
+func sendLtiGrade(launch *ltiLaunch, result *RteResult) (bool, error) {
+	if !launch.canSendGrade() {
+		return false, nil
+	}
+	testResult := result.TestResult
+	score := agsScore{
+		UserID:           launch.user,
+		ScoreGiven:       float64(testResult.TestsExecuted - testResult.TestsFailed),
+		ScoreMaximum:     float64(testResult.TestsExecuted),
+		ActivityProgress: "Completed",
+		GradingProgress:  "FullyGraded",
+		Timestamp:        time.Now().Format(time.RFC3339),
+	}
+	if testResult.MaxScore > 0 {
+		score.ScoreGiven = testResult.Score
+		score.ScoreMaximum = testResult.MaxScore
+	}
+	if !testResult.Compiled {
+		score.Comment = "Compilation failed"
+	}
+	if score.ScoreMaximum == 0 {
+		// no test was executed, e.g. because of a compile error
+		score.ScoreMaximum = 1
+	}
+	if !launch.raisesScore(score) {
+		return false, nil
+	}
+	data, err := json.Marshal(score)
+	if err != nil {
+		return false, err
+	}
+
+	scoresUrl, err := url.Parse(launch.endpoint.LineItem)
+	if err != nil {
+		return false, fmt.Errorf("Invalid line item %s: %s", launch.endpoint.LineItem, err)
+	}
+	scoresUrl.Path = strings.TrimSuffix(scoresUrl.Path, "/") + "/scores"
+
+	token, err := launch.platform.accessToken()
+	if err != nil {
+		return false, err
+	}
+	req, err := http.NewRequest("POST", scoresUrl.String(), bytes.NewReader(data))
+	if err != nil {
+		return false, err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+	req.Header.Set("Content-Type", "application/vnd.ims.lis.v1.score+json")
+	resp, err := ltiHttpClient.Do(req)
+	if err != nil {
+		return false, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode >= 300 {
+		body, _ := ioutil.ReadAll(resp.Body)
+		return false, fmt.Errorf("Sending score failed: %s %s", resp.Status, string(body))
+	}
+	launch.scoreSent(score)
+	return true, nil
+}
+
+// sendLtiGradeOfExecution sends the grade in the background, if the execution was started with an LTI launch
+func sendLtiGradeOfExecution(execution Execution, result *RteResult) {
+	if execution.Lti == nil {
+		return
+	}
+	go func() {
+		sent, err := sendLtiGrade(execution.Lti, result)
+		if err != nil {
+			ltiScoreCounter.WithLabelValues(execution.Lti.platform.Name, "error").Inc()
+			LogError("lti", "Could not send grade of run %s to %s: %s", execution.ID, execution.Lti.platform.Name, err)
+			return
+		}
+		if sent {
+			ltiScoreCounter.WithLabelValues(execution.Lti.platform.Name, "sent").Inc()
+		} else if execution.Lti.canSendGrade() {
+			ltiScoreCounter.WithLabelValues(execution.Lti.platform.Name, "not_raised").Inc()
+		}
+	}()
+}
+
+func writePrivateKey(file string, key *rsa.PrivateKey) error {
+	data := pem.EncodeToMemory(&pem.Block{Type: "RSA PRIVATE KEY", Bytes: x509.MarshalPKCS1PrivateKey(key)})
+	return ioutil.WriteFile(file, data, 0600)
+}
+
+// loadOrCreatePrivateKey loads the key from the file or creates a new key, if the file does not exist
+func loadOrCreatePrivateKey(file string) (*rsa.PrivateKey, error) {
+	if _, err := os.Stat(file); err == nil {
+		return loadRsaPrivateKey(file)
+	}
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		return nil, err
+	}
+	return key, writePrivateKey(file, key)
+}
@@ -0,0 +1,211 @@
+package main
+
+import (
+	"crypto/rsa"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	uuid "github.com/satori/go.uuid"
+)
+
+const (
+	ltiDevClientID    = "rte-dev"
+	ltiDevPlatformKid = "platform-dev"
+	ltiDevToolKid     = "rte-dev"
+	ltiDevAccessToken = "dev-access-token"
+)
+
+// runLtiDevPlatform starts a stand-in LMS for testing the LTI integration of RTE without Moodle or ILIAS.
+// It writes the keys and an LTI configuration for RTE into dir. GET /launch?user=<user>&scopes=<test folders>&roles=<roles>
+// returns a signed token for the Authorization header of RTE, the scores sent by RTE are listed by GET /lineitems/<id>/scores.
+func runLtiDevPlatform(address string, dir string) error {
+	baseUrl := "http://" + address
+	if strings.HasPrefix(address, ":") {
+		baseUrl = "http://localhost" + address
+	}
+	platform, configFile, err := newLtiDevPlatform(baseUrl, dir)
+	if err != nil {
+		return err
+	}
+	Info.Printf("Stand-in LMS listening on %s, start RTE with -lti %s\n", baseUrl, configFile)
+	return http.ListenAndServe(address, platform.handler())
+}
+
+// newLtiDevPlatform creates a stand-in LMS reachable at baseUrl with its keys in dir and returns the file of the LTI
+// configuration for RTE
+func newLtiDevPlatform(baseUrl string, dir string) (*ltiDevPlatform, string, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, "", err
+	}
+	platformKey, err := loadOrCreatePrivateKey(filepath.Join(dir, "platform.pem"))
+	if err != nil {
+		return nil, "", err
+	}
+	toolKey, err := loadOrCreatePrivateKey(filepath.Join(dir, "tool.pem"))
+	if err != nil {
+		return nil, "", err
+	}
+
+	jwksFile := filepath.Join(dir, "jwks.json")
+	jwks, err := json.MarshalIndent(jsonWebKeys{Keys: []jsonWebKey{newJsonWebKey(ltiDevPlatformKid, &platformKey.PublicKey)}}, "", "  ")
+	if err != nil {
+		return nil, "", err
+	}
+	if err := ioutil.WriteFile(jwksFile, jwks, 0644); err != nil {
+		return nil, "", err
+	}
+	configFile := filepath.Join(dir, "lti.json")
+	config, err := json.MarshalIndent(LtiConfig{Platforms: []*LtiPlatform{{
+		Name:        "dev",
+		Issuer:      baseUrl,
+		ClientID:    ltiDevClientID,
+		JWKSFile:    jwksFile,
+		TokenURL:    baseUrl + "/token",
+		ToolKeyFile: filepath.Join(dir, "tool.pem"),
+		ToolKeyID:   ltiDevToolKid,
+	}}}, "", "  ")
+	if err != nil {
+		return nil, "", err
+	}
+	if err := ioutil.WriteFile(configFile, config, 0644); err != nil {
+		return nil, "", err
+	}
+
+	return &ltiDevPlatform{
+		baseUrl:     baseUrl,
+		platformKey: platformKey,
+		toolKey:     &toolKey.PublicKey,
+		scores:      make(map[string][]json.RawMessage),
+	}, configFile, nil
+}
+
+func (p *ltiDevPlatform) handler() http.Handler {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/launch", p.handleLaunch)
+	mux.HandleFunc("/token", p.handleToken)
+	mux.HandleFunc("/lineitems/", p.handleScores)
+	return mux
+}
+
+type ltiDevPlatform struct {
+	baseUrl     string
+	platformKey *rsa.PrivateKey
+	toolKey     *rsa.PublicKey
+
+	mutex  sync.Mutex
+	scores map[string][]json.RawMessage
+}
+
+func (p *ltiDevPlatform) handleLaunch(w http.ResponseWriter, r *http.Request) {
+	user := r.URL.Query().Get("user")
+	if user == "" {
+		user = "student"
+	}
+	lineItem := r.URL.Query().Get("lineitem")
+	if lineItem == "" {
+		lineItem = "1"
+	}
+	// context roles by their short name, e.g. Learner or Instructor
+	roles := make([]string, 0)
+	for _, role := range strings.Split(r.URL.Query().Get("roles"), ",") {
+		if role = strings.TrimSpace(role); role != "" {
+			roles = append(roles, ltiMembershipRoles+"#"+role)
+		}
+	}
+	if len(roles) == 0 {
+		roles = append(roles, ltiMembershipRoles+"#Learner")
+	}
+	now := time.Now()
+	token, err := signJWT(ltiDevPlatformKid, map[string]interface{}{
+		"iss":   p.baseUrl,
+		"sub":   user,
+		"aud":   ltiDevClientID,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+		"nonce": uuid.NewV4().String(),
+		"https://purl.imsglobal.org/spec/lti/claim/message_type": "LtiResourceLinkRequest",
+		"https://purl.imsglobal.org/spec/lti/claim/version":      "1.3.0",
+		"https://purl.imsglobal.org/spec/lti/claim/context":      ltiContext{ID: "dev-course", Label: "DEV"},
+		"https://purl.imsglobal.org/spec/lti/claim/roles":        roles,
+		"https://purl.imsglobal.org/spec/lti/claim/custom": map[string]string{
+			ltiScopesParameter: r.URL.Query().Get("scopes"),
+		},
+		"https://purl.imsglobal.org/spec/lti-ags/claim/endpoint": agsEndpoint{
+			Scope:     []string{ltiScoreScope},
+			LineItems: p.baseUrl + "/lineitems",
+			LineItem:  p.baseUrl + "/lineitems/" + lineItem,
+		},
+	}, p.platformKey)
+	if err != nil {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(err.Error()))
+		return
+	}
+	fmt.Fprintln(w, token)
+}
+
+func (p *ltiDevPlatform) handleToken(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	var claims struct {
+		Issuer   string   `json:"iss"`
+		Audience audience `json:"aud"`
+	}
+	err := verifyJWT(r.FormValue("client_assertion"), func(header jwtHeader, payload []byte) (*rsa.PublicKey, error) {
+		return p.toolKey, nil
+	}, &claims)
+	if err == nil && (claims.Issuer != ltiDevClientID || !claims.Audience.contains(p.baseUrl+"/token")) {
+		err = fmt.Errorf("Wrong issuer or audience")
+	}
+	if err != nil || r.FormValue("grant_type") != "client_credentials" {
+		Info.Printf("Rejected token request: %v\n", err)
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(map[string]interface{}{
+		"access_token": ltiDevAccessToken,
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"scope":        r.FormValue("scope"),
+	})
+}
+
+func (p *ltiDevPlatform) handleScores(w http.ResponseWriter, r *http.Request) {
+	lineItem := strings.TrimSuffix(strings.TrimPrefix(r.URL.Path, "/lineitems/"), "/scores")
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+	switch r.Method {
+	case "POST":
+		if bearerToken(r) != ltiDevAccessToken {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		score, err := ioutil.ReadAll(r.Body)
+		if err != nil || !json.Valid(score) {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		Info.Printf("Received score for line item %s: %s\n", lineItem, score)
+		p.scores[lineItem] = append(p.scores[lineItem], score)
+		w.WriteHeader(http.StatusNoContent)
+	case "GET":
+		w.Header().Set("Content-Type", "application/json")
+		scores := p.scores[lineItem]
+		if scores == nil {
+			scores = []json.RawMessage{}
+		}
+		json.NewEncoder(w).Encode(scores)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// useLtiDevPlatform starts the stand-in LMS and configures it as the only LTI platform for the duration of the test
+func useLtiDevPlatform(t *testing.T) *httptest.Server {
+	server := httptest.NewUnstartedServer(nil)
+	platform, configFile, err := newLtiDevPlatform("http://"+server.Listener.Addr().String(), t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	server.Config.Handler = platform.handler()
+	server.Start()
+	t.Cleanup(server.Close)
+
+	previous := ltiConfig
+	ltiConfig, err = loadLtiConfig(configFile)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { ltiConfig = previous })
+	return server
+}
+
+// ltiToken launches the user with the context roles at the stand-in LMS and returns the token
+func ltiToken(t *testing.T, server *httptest.Server, user string, roles string) string {
+	resp, err := http.Get(server.URL + "/launch?scopes=course&user=" + user + "&roles=" + roles)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	token, err := ioutil.ReadAll(resp.Body)
+	if err != nil || resp.StatusCode != http.StatusOK {
+		t.Fatalf("launch of %s failed: %d %s %v", user, resp.StatusCode, token, err)
+	}
+	return strings.TrimSpace(string(token))
+}
+
+func TestIsInstructor(t *testing.T) {
+	cases := []struct {
+		roles []string
+		want  bool
+	}{
+		{nil, false},
+		{[]string{ltiMembershipRoles + "#Learner"}, false},
+		{[]string{ltiMembershipRoles + "#Learner", ltiMembershipRoles + "#Instructor"}, true},
+		{[]string{ltiMembershipRoles + "/Instructor#TeachingAssistant"}, true},
+		{[]string{ltiMembershipRoles + "/Learner#Learner"}, false},
+		{[]string{"http://purl.imsglobal.org/vocab/lis/v2/institution/person#Administrator"}, true},
+		{[]string{"http://purl.imsglobal.org/vocab/lis/v2/institution/person#Student"}, false},
+		// short role names of LTI 1.1 are not accepted
+		{[]string{"Instructor"}, false},
+	}
+	for _, c := range cases {
+		if got := isInstructor(c.roles); got != c.want {
+			t.Errorf("isInstructor(%v) = %v, want %v", c.roles, got, c.want)
+		}
+	}
+}
+
+func TestLtiResultsOnlyOwnRuns(t *testing.T) {
+	server := useLtiDevPlatform(t)
+	useCatalog(t, pythonIOTest("course/io"))
+	store, err := openFsRunStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := runStore
+	runStore = store
+	t.Cleanup(func() { runStore = previous })
+
+	alice := testRecord("alice-1", "course/io", 1)
+	alice.Caller, alice.User = "dev", "alice"
+	bob := testRecord("bob-1", "course/io", 2)
+	bob.Caller, bob.User = "dev", "bob"
+	// a run with an API key of another caller, whose user is not an LTI user
+	api := testRecord("api-1", "course/io", 3)
+	api.Caller, api.User = "moodle", "alice"
+	for _, record := range []RunRecord{alice, bob, api} {
+		if err := store.save(record); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// a submission still in memory
+	submissions.add(&Submission{ID: "bob-2", Test: "course/io", Status: SubmissionRunning, caller: "dev", user: "bob"})
+	t.Cleanup(func() { submissions.remove("bob-2") })
+
+	tokens := map[string]string{
+		"alice":      ltiToken(t, server, "alice", ""),
+		"bob":        ltiToken(t, server, "bob", "Learner"),
+		"instructor": ltiToken(t, server, "teacher", "Instructor"),
+		"assistant":  ltiToken(t, server, "assistant", "Learner,Mentor"),
+	}
+
+	cases := []struct {
+		user   string
+		path   string
+		status int
+		want   string
+	}{
+		{"alice", "/results?test=course/io", http.StatusOK, "alice-1"},
+		{"bob", "/results?test=course/io", http.StatusOK, "bob-1"},
+		{"instructor", "/results?test=course/io", http.StatusOK, "alice-1 bob-1 api-1"},
+		{"assistant", "/results?test=course/io", http.StatusOK, ""},
+		{"alice", "/results?test=course/io&limit=1", http.StatusOK, "alice-1"},
+		{"alice", "/results?test=course/io&before=api-1", http.StatusBadRequest, ""},
+		{"instructor", "/results?test=course/io&before=api-1", http.StatusOK, "alice-1 bob-1"},
+		{"alice", "/results/alice-1", http.StatusOK, "alice-1"},
+		{"alice", "/results/bob-1", http.StatusNotFound, ""},
+		{"alice", "/results/api-1", http.StatusNotFound, ""},
+		{"instructor", "/results/bob-1", http.StatusOK, "bob-1"},
+		{"alice", "/submissions/alice-1", http.StatusOK, "alice-1"},
+		{"alice", "/submissions/bob-1", http.StatusNotFound, ""},
+		{"alice", "/submissions/bob-2", http.StatusNotFound, ""},
+		{"bob", "/submissions/bob-2", http.StatusOK, "bob-2"},
+		{"instructor", "/submissions/bob-2", http.StatusOK, "bob-2"},
+	}
+	for _, c := range cases {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("GET", c.path, nil)
+		r.Header.Set("Authorization", "Bearer "+tokens[c.user])
+		if strings.HasPrefix(c.path, "/results") {
+			handleResults(w, r)
+		} else {
+			handleSubmission(w, r)
+		}
+		if w.Code != c.status {
+			t.Errorf("%s %s: status %d, want %d: %s", c.user, c.path, w.Code, c.status, w.Body.String())
+			continue
+		}
+		if c.status != http.StatusOK {
+			continue
+		}
+		var got string
+		if strings.HasPrefix(c.path, "/results?") {
+			var records []RunRecord
+			if err := json.Unmarshal(w.Body.Bytes(), &records); err != nil {
+				t.Fatal(err)
+			}
+			got = recordIds(records)
+		} else {
+			var run struct{ ID string }
+			if err := json.Unmarshal(w.Body.Bytes(), &run); err != nil {
+				t.Fatal(err)
+			}
+			got = run.ID
+		}
+		if got != c.want {
+			t.Errorf("%s %s: runs %q, want %q", c.user, c.path, got, c.want)
+		}
+	}
+}
+
+func TestLtiRunRecordUser(t *testing.T) {
+	server := useLtiDevPlatform(t)
+	caller, err := ltiCaller(ltiToken(t, server, "alice", "Learner"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if caller.Instructor {
+		t.Errorf("learner is an instructor")
+	}
+	record := newRunRecord(Execution{ID: "1", Test: "course/io", Caller: caller.Name, Lti: caller.lti})
+	if record.Caller != "dev" || record.User != "alice" {
+		t.Errorf("run of %q and %q, want dev and alice", record.Caller, record.User)
+	}
+	if record := newRunRecord(Execution{ID: "2", Test: "course/io", Caller: "moodle"}); record.User != "" {
+		t.Errorf("run with an API key has the user %q", record.User)
+	}
+}
+
+func TestLtiTokenReplay(t *testing.T) {
+	server := useLtiDevPlatform(t)
+	token := ltiToken(t, server, "alice", "Learner")
+	cases := []struct {
+		phase  string
+		status int
+	}{
+		{"upload", http.StatusOK},
+		// the token cannot start another run, but still read the results
+		{"upload", http.StatusForbidden},
+		{"listing", http.StatusOK},
+	}
+	for i, c := range cases {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", "/v2/submissions", nil)
+		r.Header.Set("Authorization", "Bearer "+token)
+		if _, ok := authenticate(w, r, c.phase); ok != (c.status == http.StatusOK) || w.Code != c.status {
+			t.Errorf("request %d in phase %s: status %d, want %d: %s", i+1, c.phase, w.Code, c.status, w.Body.String())
+		}
+	}
+	// another launch of the same user has a new nonce
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("POST", "/v2/submissions", nil)
+	r.Header.Set("Authorization", "Bearer "+ltiToken(t, server, "alice", "Learner"))
+	if _, ok := authenticate(w, r, "upload"); !ok {
+		t.Errorf("token of a new launch rejected: %s", w.Body.String())
+	}
+}
+
+func TestSendLtiGradeOnlyHigher(t *testing.T) {
+	server := useLtiDevPlatform(t)
+	caller, err := ltiCaller(ltiToken(t, server, "alice", "Learner"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	results := []struct {
+		result TestResult
+		sent   bool
+	}{
+		{TestResult{Compiled: true, TestsExecuted: 4, TestsFailed: 2}, true},
+		// a compile error does not overwrite the grade
+		{TestResult{Compiled: false}, false},
+		{TestResult{Compiled: true, TestsExecuted: 4, TestsFailed: 3}, false},
+		{TestResult{Compiled: true, TestsExecuted: 4, TestsFailed: 2}, false},
+		{TestResult{Compiled: true, TestsExecuted: 4, TestsFailed: 0}, true},
+	}
+	for i, r := range results {
+		sent, err := sendLtiGrade(caller.lti, &RteResult{TestResult: r.result})
+		if err != nil || sent != r.sent {
+			t.Errorf("result %d: sent %v, %v, want %v", i+1, sent, err, r.sent)
+		}
+	}
+
+	resp, err := http.Get(server.URL + "/lineitems/1/scores")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	var scores []agsScore
+	if err := json.NewDecoder(resp.Body).Decode(&scores); err != nil {
+		t.Fatal(err)
+	}
+	if len(scores) != 2 || scores[0].ScoreGiven != 2 || scores[1].ScoreGiven != 4 {
+		t.Errorf("scores %+v, want 2 and 4 of 4", scores)
+	}
+}
@@ -2,14 +2,12 @@ package main
 
 import (
 	"bytes"
-	"context"
 	"encoding/xml"
 	"fmt"
 	"io/ioutil"
 	"os"
-	"os/exec"
 	"path/filepath"
-	"syscall"
+	"strings"
 	"time"
 )
 
@@ -30,6 +28,10 @@ type ClocResult struct {
 }
 
 func clocMetric(timeout int, runid string, absRunDir string, maxMem int, runDir string, test string, testConfig TestConfig) []ClocResult {
+	if len(testConfig.AllowedFiles) == 0 {
+		// there is no file to measure
+		return nil
+	}
 	testFile := testConfig.AllowedFiles[0] //Pick single filename in config AllowedFiles
 	//run cloc analysis
 	err := runCloc(timeout, runid, absRunDir, maxMem, runDir, testFile)
@@ -49,21 +51,16 @@ func clocMetric(timeout int, runid string, absRunDir string, maxMem int, runDir
 }
 
 func runCloc(timeout int, runid string, absRunDir string, maxMem int, runDir string, testFile string) (err error) {
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeout)*time.Second)
-	defer func() {
-		exec.Command("docker", "stop", runid).Run()
-		cancel()
-	}()
-
-	arguments := make([]string, 0)
-
-	// Docker command
-	arguments = append(arguments, "docker", "run", "--name", runid, "-i", "--rm", "-v", absRunDir+":/code", "-m", fmt.Sprintf("%dM", maxMem))
-
-	arguments = append(arguments, *docker_image_cloc, "--quiet", "--xml", "/code/"+testFile, "exclude-dir=bin,obj,TestResults", "--by-file")
-	cmd := exec.CommandContext(ctx, "docker")
-	cmd.Dir = runDir
-	cmd.Args = arguments
+	mounts := []Mount{{Source: absRunDir, Target: "/code"}}
+	sandboxCmd := SandboxCommand{
+		Name:    runid,
+		Image:   *docker_image_cloc,
+		Command: []string{"--quiet", "--xml", "/code/" + testFile, "exclude-dir=bin,obj,TestResults", "--by-file"},
+		Mounts:  mounts,
+		Stdin:   strings.NewReader(""),
+		MaxMem:  maxMem,
+		Timeout: time.Duration(timeout) * time.Second,
+	}
 
 	//push xml file in respective runs folder
 	outFilePath := filepath.Join(runDir, "metric_cloc.xml")
@@ -80,18 +77,20 @@ func runCloc(timeout int, runid string, absRunDir string, maxMem int, runDir str
 			return
 		}
 	}()
-	cmd.Stdout = LimitWriter(outFileHandle, maxFileSize)
+	sandboxCmd.Stdout = outFileHandle
+	sandboxCmd.StdoutLimit = maxFileSize
 	errBuffer := new(bytes.Buffer)
-	cmd.Stderr = errBuffer
-
-	//execute docker
-	if err = cmd.Run(); err != nil {
-		if exiterr, ok := err.(*exec.ExitError); ok {
-			if status, ok := exiterr.Sys().(syscall.WaitStatus); ok {
-				if status.ExitStatus() == -1 { // killed
-					err = fmt.Errorf("timeout")
-				}
-			}
+	sandboxCmd.Stderr = errBuffer
+
+	//execute in sandbox
+	res, err := sandbox.Run(sandboxCmd)
+	if err != nil {
+		return
+	}
+	if res.TimedOut || res.ExitCode != 0 {
+		err = fmt.Errorf("exit status %d", res.ExitCode)
+		if res.TimedOut {
+			err = fmt.Errorf("timeout")
 		}
 		if errBuffer.Len() > 0 {
 			err = fmt.Errorf(errBuffer.String())
@@ -53,14 +53,19 @@ func metricService() {
 }
 
 func handleMetricRequest() {
-	execution := <-metricChannel
+	execution := metricQueue.pop()
 	defer func() {
 		if err := recover(); err != nil {
 			fmt.Printf("Error in metric execution: %+v\n", execution)
 			fmt.Println("Recovered from error", err)
 			fmt.Println(errors.Wrap(err, 2).ErrorStack())
+			// the waiting request still needs an answer
+			execution.report(ProgressEvent{Type: EventCloc})
+			execution.ClocChan <- nil
 		}
 	}()
 	fmt.Printf("Executing metric: %+v\n", execution)
-	execution.ClocChan <- metric(execution)
+	clocResults := metric(execution)
+	execution.report(ProgressEvent{Type: EventCloc, Cloc: clocResults})
+	execution.ClocChan <- clocResults
 }
@@ -5,11 +5,12 @@ import (
 )
 
 var (
-	accessCounter = prometheus.NewCounter(
+	accessCounter = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "rte_access_total",
 			Help: "Total number of accesses to the service",
 		},
+		[]string{"key", "phase"},
 	)
 	compileErrorCounter = prometheus.NewCounter(
 		prometheus.CounterOpts{
@@ -17,6 +18,12 @@ var (
 			Help: "Total number of test runs that had compile errors",
 		},
 	)
+	compileTimeoutCounter = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "rte_compile_timeout_total",
+			Help: "Total number of test runs where the compilation timed out",
+		},
+	)
 	testCount = prometheus.NewCounterVec(
 		prometheus.CounterOpts{
 			Name: "rte_test_execution_count",
@@ -45,6 +52,55 @@ var (
 		},
 		[]string{"phase"},
 	)
+	queueDepthGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "rte_queue_depth",
+			Help: "Number of executions waiting for a stage of the pipeline",
+		},
+		[]string{"stage", "priority"},
+	)
+	queueWaitHistogram = prometheus.NewHistogramVec(
+		prometheus.HistogramOpts{
+			Name:    "rte_queue_wait_seconds",
+			Help:    "Time executions waited for a stage of the pipeline in seconds",
+			Buckets: []float64{0.1, 0.5, 1.0, 5.0, 15.0, 30.0, 60.0, 120.0, 300.0},
+		},
+		[]string{"stage"},
+	)
+	queueRejectedCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "rte_queue_rejected_total",
+			Help: "Number of executions rejected because the queue was full",
+		},
+		[]string{"stage"},
+	)
+	rateLimitedCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "rte_rate_limited_total",
+			Help: "Number of requests rejected because of a rate limit",
+		},
+		[]string{"scope", "course"},
+	)
+	ltiScoreCounter = prometheus.NewCounterVec(
+		prometheus.CounterOpts{
+			Name: "rte_lti_scores_total",
+			Help: "Number of scores sent to LTI platforms",
+		},
+		[]string{"platform", "result"},
+	)
+	catalogTestsGauge = prometheus.NewGaugeVec(
+		prometheus.GaugeOpts{
+			Name: "rte_catalog_tests",
+			Help: "Number of tests in the catalog by the state of their configuration",
+		},
+		[]string{"state"},
+	)
+	catalogReloadCounter = prometheus.NewCounter(
+		prometheus.CounterOpts{
+			Name: "rte_catalog_reloads_total",
+			Help: "Number of times the configurations of all tests were loaded",
+		},
+	)
 	testExecutionTimeHistogram = prometheus.NewHistogram(
 		prometheus.HistogramOpts{
 			Name:    "rte_test_execution_time",
@@ -57,12 +113,17 @@ var (
 func InitMonitoring() {
 	prometheus.MustRegister(accessCounter)
 	prometheus.MustRegister(compileErrorCounter)
+	prometheus.MustRegister(compileTimeoutCounter)
+	prometheus.MustRegister(queueDepthGauge, queueWaitHistogram, queueRejectedCounter)
+	prometheus.MustRegister(rateLimitedCounter)
+	prometheus.MustRegister(ltiScoreCounter)
+	prometheus.MustRegister(catalogTestsGauge, catalogReloadCounter)
 	prometheus.MustRegister(testCount, testFailCount)
 	prometheus.MustRegister(junitIncompatibilityCount)
 	prometheus.MustRegister(errorCounter)
 	prometheus.MustRegister(testExecutionTimeHistogram)
 
-	for _, phase := range []string{"startup", "upload", "create", "listing", "compile", "test"} {
+	for _, phase := range []string{"startup", "upload", "create", "listing", "compile", "test", "catalog"} {
 		errorCounter.WithLabelValues(phase).Add(0)
 	}
 }
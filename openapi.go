@@ -0,0 +1,324 @@
+package main
+
+import (
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+// openApiEnums lists the values of types which are sent as strings with a fixed set of values
+var openApiEnums = map[reflect.Type]func() []string{
+	reflect.TypeOf(Compiler(0)): func() []string {
+		return sortedKeys(_CompilerNameToValue)
+	},
+	reflect.TypeOf(TestType(0)): func() []string {
+		return sortedKeys(_TestTypeNameToValue)
+	},
+	reflect.TypeOf(CompareMode(0)): func() []string {
+		return sortedKeys(_CompareModeNameToValue)
+	},
+	reflect.TypeOf(SubmissionStatus("")): func() []string {
+		return []string{string(SubmissionQueued), string(SubmissionRunning), string(SubmissionDone), string(SubmissionFailed)}
+	},
+	reflect.TypeOf(ApiErrorCode("")): func() []string {
+		codes := []ApiErrorCode{
+			ErrMethodNotAllowed, ErrUnauthorized, ErrMissingParameter, ErrInvalidParameter, ErrNotFound, ErrTestNotFound,
+			ErrInvalidTestConfig, ErrMissingFiles, ErrIllegalFiles, ErrUploadFailed, ErrInvalidArchive,
+			ErrUploadTooLarge, ErrTooManyFiles, ErrGitFailed, ErrRateLimited,
+			ErrTooManyRuns, ErrQueueFull, ErrStorage, ErrInternal, ErrCompileError, ErrCompileTimeout, ErrTestCompileError,
+		}
+		values := make([]string, len(codes))
+		for i, code := range codes {
+			values[i] = string(code)
+		}
+		return values
+	},
+}
+
+func sortedKeys(m interface{}) []string {
+	var keys []string
+	for _, key := range reflect.ValueOf(m).MapKeys() {
+		keys = append(keys, key.String())
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// openApiSchemas collects the schemas of the Go types used by the API
+type openApiSchemas map[string]interface{}
+
+// jsonField returns the name of a struct field in JSON, an empty name if the field is not encoded
+func jsonField(field reflect.StructField) (name string, omitempty bool) {
+	if field.PkgPath != "" {
+		return "", false
+	}
+	tag := field.Tag.Get("json")
+	if tag == "-" {
+		return "", false
+	}
+	parts := strings.Split(tag, ",")
+	name = parts[0]
+	if name == "" {
+		name = field.Name
+	}
+	for _, option := range parts[1:] {
+		if option == "omitempty" {
+			omitempty = true
+		}
+	}
+	return name, omitempty
+}
+
+// schema returns the schema of the type, structs are added to the components and referenced
+func (s openApiSchemas) schema(t reflect.Type) map[string]interface{} {
+	if values, ok := openApiEnums[t]; ok {
+		return map[string]interface{}{"type": "string", "enum": values()}
+	}
+	if t == reflect.TypeOf(time.Time{}) {
+		return map[string]interface{}{"type": "string", "format": "date-time"}
+	}
+	switch t.Kind() {
+	case reflect.Ptr:
+		return s.schema(t.Elem())
+	case reflect.Interface:
+		return map[string]interface{}{}
+	case reflect.Bool:
+		return map[string]interface{}{"type": "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return map[string]interface{}{"type": "integer"}
+	case reflect.Float32, reflect.Float64:
+		return map[string]interface{}{"type": "number"}
+	case reflect.String:
+		return map[string]interface{}{"type": "string"}
+	case reflect.Slice, reflect.Array:
+		return map[string]interface{}{"type": "array", "items": s.schema(t.Elem())}
+	case reflect.Map:
+		return map[string]interface{}{"type": "object", "additionalProperties": s.schema(t.Elem())}
+	case reflect.Struct:
+		ref := map[string]interface{}{"$ref": "#/components/schemas/" + t.Name()}
+		if _, ok := s[t.Name()]; ok {
+			return ref
+		}
+		// register the name first, so that recursive types terminate
+		s[t.Name()] = nil
+		properties := make(map[string]interface{})
+		var required []string
+		for i := 0; i < t.NumField(); i++ {
+			field := t.Field(i)
+			name, omitempty := jsonField(field)
+			if name == "" {
+				continue
+			}
+			properties[name] = s.schema(field.Type)
+			kind := field.Type.Kind()
+			if !omitempty && kind != reflect.Ptr && kind != reflect.Slice && kind != reflect.Map && kind != reflect.Interface {
+				required = append(required, name)
+			}
+		}
+		schema := map[string]interface{}{"type": "object", "properties": properties}
+		if len(required) > 0 {
+			schema["required"] = required
+		}
+		s[t.Name()] = schema
+		return ref
+	}
+	return map[string]interface{}{}
+}
+
+func (s openApiSchemas) content(mediaType string, v interface{}) map[string]interface{} {
+	return map[string]interface{}{
+		mediaType: map[string]interface{}{"schema": s.schema(reflect.TypeOf(v))},
+	}
+}
+
+func (s openApiSchemas) response(description string, v interface{}) map[string]interface{} {
+	return map[string]interface{}{"description": description, "content": s.content("application/json", v)}
+}
+
+func pathParameter(name string, description string) map[string]interface{} {
+	return map[string]interface{}{
+		"name": name, "in": "path", "required": true, "description": description,
+		"schema": map[string]interface{}{"type": "string"},
+	}
+}
+
+// openApiDocument describes the /v2 API as OpenAPI 3 document. The schemas are generated from the Go types of the responses.
+func openApiDocument() map[string]interface{} {
+	schemas := openApiSchemas{}
+	errorResponse := schemas.response("Error, see the code for the reason", ErrorResponse{})
+	submission := schemas.response("The submission", Submission{})
+	submissionID := pathParameter("id", "ID of the submission")
+
+	paths := map[string]interface{}{
+		"/tests": map[string]interface{}{
+			"get": map[string]interface{}{
+				"summary":     "List the tests the caller has access to",
+				"operationId": "listTests",
+				"responses": map[string]interface{}{
+					"200":     schemas.response("The tests", TestList{}),
+					"default": errorResponse,
+				},
+			},
+		},
+		"/tests/{test}": map[string]interface{}{
+			"get": map[string]interface{}{
+				"summary":     "Describe a test, e.g. the files students have to submit",
+				"operationId": "getTest",
+				"parameters":  []interface{}{pathParameter("test", "Path of the test, which may contain slashes")},
+				"responses": map[string]interface{}{
+					"200":     schemas.response("The test", TestInfo{}),
+					"default": errorResponse,
+				},
+			},
+		},
+		"/tests/{test}/template.zip": map[string]interface{}{
+			"get": map[string]interface{}{
+				"summary":     "Download the template files of a test, which are not hidden",
+				"operationId": "getTestTemplate",
+				"parameters":  []interface{}{pathParameter("test", "Path of the test, which may contain slashes")},
+				"responses": map[string]interface{}{
+					"200": map[string]interface{}{
+						"description": "Zip archive of the template files",
+						"content": map[string]interface{}{
+							"application/zip": map[string]interface{}{"schema": map[string]interface{}{"type": "string", "format": "binary"}},
+						},
+					},
+					"default": errorResponse,
+				},
+			},
+		},
+		"/submissions": map[string]interface{}{
+			"post": map[string]interface{}{
+				"summary":     "Submit files for a test",
+				"operationId": "createSubmission",
+				"parameters": []interface{}{map[string]interface{}{
+					"name": "wait", "in": "query", "description": "Respond when the result is available",
+					"schema": map[string]interface{}{"type": "boolean"},
+				}},
+				"requestBody": map[string]interface{}{
+					"required": true,
+					"content": map[string]interface{}{
+						"application/json": map[string]interface{}{"schema": schemas.schema(reflect.TypeOf(SubmissionRequest{}))},
+						"multipart/form-data": map[string]interface{}{"schema": map[string]interface{}{
+							"type":     "object",
+							"required": []string{"test"},
+							"properties": map[string]interface{}{
+								"test":     map[string]interface{}{"type": "string"},
+								"priority": map[string]interface{}{"type": "string", "enum": priorityNames[:]},
+								"user":     map[string]interface{}{"type": "string"},
+								"files": map[string]interface{}{
+									"type":  "array",
+									"items": map[string]interface{}{"type": "string", "format": "binary"},
+								},
+								"archive":    map[string]interface{}{"type": "string", "format": "binary"},
+								"git_url":    map[string]interface{}{"type": "string"},
+								"git_ref":    map[string]interface{}{"type": "string"},
+								"git_bundle": map[string]interface{}{"type": "string", "format": "binary"},
+							},
+						}},
+					},
+				},
+				"responses": map[string]interface{}{
+					"200":     schemas.response("The finished submission (wait=true)", Submission{}),
+					"202":     schemas.response("The submission was queued", Submission{}),
+					"default": errorResponse,
+				},
+			},
+		},
+		"/submissions/{id}": map[string]interface{}{
+			"get": map[string]interface{}{
+				"summary":     "Get the status and result of a submission",
+				"operationId": "getSubmission",
+				"parameters":  []interface{}{submissionID},
+				"responses": map[string]interface{}{
+					"200":     submission,
+					"default": errorResponse,
+				},
+			},
+		},
+		"/submissions/{id}/events": map[string]interface{}{
+			"get": map[string]interface{}{
+				"summary":     "Stream the progress of a submission as server-sent events",
+				"operationId": "getSubmissionEvents",
+				"parameters":  []interface{}{submissionID},
+				"responses": map[string]interface{}{
+					"200": map[string]interface{}{
+						"description": "Server-sent events, the data of each event is a progress event",
+						"content":     schemas.content("text/event-stream", ProgressEvent{}),
+					},
+					"default": errorResponse,
+				},
+			},
+		},
+		"/results": map[string]interface{}{
+			"get": map[string]interface{}{
+				"summary":     "List the newest stored runs of a test",
+				"operationId": "listResults",
+				"parameters": []interface{}{
+					map[string]interface{}{
+						"name": "test", "in": "query", "required": true,
+						"schema": map[string]interface{}{"type": "string"},
+					},
+					map[string]interface{}{
+						"name": "limit", "in": "query",
+						"description": "Maximum number of runs",
+						"schema":      map[string]interface{}{"type": "integer", "minimum": 1, "maximum": maxResultsLimit, "default": defaultResultsLimit},
+					},
+					map[string]interface{}{
+						"name": "before", "in": "query",
+						"description": "Only return runs created before the run with this id, e.g. the first run of the previous page",
+						"schema":      map[string]interface{}{"type": "string"},
+					},
+				},
+				"responses": map[string]interface{}{
+					"200":     schemas.response("The runs, ordered by their creation time", []RunRecord{}),
+					"default": errorResponse,
+				},
+			},
+		},
+		"/results/{id}": map[string]interface{}{
+			"get": map[string]interface{}{
+				"summary":     "Get a stored run",
+				"operationId": "getResult",
+				"parameters":  []interface{}{pathParameter("id", "ID of the run")},
+				"responses": map[string]interface{}{
+					"200":     schemas.response("The run", RunRecord{}),
+					"default": errorResponse,
+				},
+			},
+		},
+		"/admin/tests": map[string]interface{}{
+			"get": map[string]interface{}{
+				"summary":     "List all tests with the problems of their configuration (admins only)",
+				"operationId": "listCatalog",
+				"responses": map[string]interface{}{
+					"200":     schemas.response("The tests of the catalog", CatalogStatus{}),
+					"default": errorResponse,
+				},
+			},
+		},
+	}
+
+	return map[string]interface{}{
+		"openapi": "3.0.3",
+		"info": map[string]interface{}{
+			"title":   "Remote Test Executor",
+			"version": strings.TrimPrefix(apiVersionPrefix, "/v"),
+		},
+		"servers": []interface{}{map[string]interface{}{"url": *contextPath + apiVersionPrefix}},
+		"paths":   paths,
+		"components": map[string]interface{}{
+			"schemas": schemas,
+			"securitySchemes": map[string]interface{}{
+				"apiKey": map[string]interface{}{"type": "apiKey", "in": "header", "name": "ApiKey"},
+				"lti":    map[string]interface{}{"type": "http", "scheme": "bearer", "bearerFormat": "JWT"},
+			},
+		},
+		"security": []interface{}{
+			map[string]interface{}{"apiKey": []string{}},
+			map[string]interface{}{"lti": []string{}},
+		},
+	}
+}
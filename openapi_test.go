@@ -0,0 +1,30 @@
+package main
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestOpenApiEnums(t *testing.T) {
+	enums := map[reflect.Type]interface{}{
+		reflect.TypeOf(Compiler(0)):    _CompilerNameToValue,
+		reflect.TypeOf(TestType(0)):    _TestTypeNameToValue,
+		reflect.TypeOf(CompareMode(0)): _CompareModeNameToValue,
+	}
+	for enum, names := range enums {
+		schema := openApiSchemas{}.schema(enum)
+		if got, want := strings.Join(schema["enum"].([]string), " "), strings.Join(sortedKeys(names), " "); schema["type"] != "string" || got != want {
+			t.Errorf("schema of %s: %v, want the strings %s", enum, schema, want)
+		}
+	}
+
+	// the enums are encoded as their names in the document, e.g. in the configuration of stored runs
+	schemas := openApiSchemas{}
+	schemas.schema(reflect.TypeOf(RunRecord{}))
+	config, _ := json.Marshal(schemas["TestConfig"])
+	if !strings.Contains(string(config), `"CompareMode":{"enum":["`) {
+		t.Errorf("CompareMode of TestConfig is not an enum: %s", config)
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Types of progress events sent while an execution moves through the pipeline
+const (
+	EventQueued       = "queued"
+	EventCompiling    = "compiling"
+	EventCompiled     = "compiled"
+	EventCompileError = "compile_error"
+	EventTesting      = "testing"
+	EventTest         = "test"
+	EventAnalysis     = "analysis"
+	EventCloc         = "cloc"
+	EventDone         = "done"
+)
+
+// ProgressEvent describes a step of an execution in the pipeline
+type ProgressEvent struct {
+	Type     string         `json:"type"`
+	Time     time.Time      `json:"time"`
+	Message  string         `json:"message,omitempty"`
+	Test     *Test          `json:"test,omitempty"`
+	Warnings []FileWarnings `json:"warnings,omitempty"`
+	Cloc     []ClocResult   `json:"cloc,omitempty"`
+	Result   *RteResult     `json:"result,omitempty"`
+}
+
+// progressStream records the progress events of one execution and notifies listeners about new events
+type progressStream struct {
+	sync.Mutex
+	events   []ProgressEvent
+	changed  chan struct{}
+	finished bool
+}
+
+func newProgressStream() *progressStream {
+	return &progressStream{changed: make(chan struct{})}
+}
+
+func (s *progressStream) publish(event ProgressEvent) {
+	s.Lock()
+	defer s.Unlock()
+	if s.finished {
+		return
+	}
+	event.Time = time.Now()
+	s.events = append(s.events, event)
+	s.finished = event.Type == EventDone
+	close(s.changed)
+	s.changed = make(chan struct{})
+}
+
+// eventsSince returns all events starting at the given index and a channel which is closed when new events arrive
+func (s *progressStream) eventsSince(index int) (events []ProgressEvent, changed <-chan struct{}, finished bool) {
+	s.Lock()
+	defer s.Unlock()
+	if index < len(s.events) {
+		events = append(events, s.events[index:]...)
+	}
+	return events, s.changed, s.finished
+}
+
+// wait blocks until the stream is finished. It returns false if done is closed before.
+func (s *progressStream) wait(done <-chan struct{}) bool {
+	next := 0
+	for {
+		events, changed, finished := s.eventsSince(next)
+		next += len(events)
+		if finished {
+			return true
+		}
+		select {
+		case <-changed:
+		case <-done:
+			return false
+		}
+	}
+}
+
+// report publishes a progress event, if somebody is interested in the progress of the execution
+func (execution *Execution) report(event ProgressEvent) {
+	if execution.Progress != nil {
+		execution.Progress.publish(event)
+	}
+}
+
+// reportTest publishes the result of a single test case
+func (execution *Execution) reportTest(test Test) {
+	execution.report(ProgressEvent{Type: EventTest, Test: &test})
+}
+
+// handleSubmissionEvents streams the progress of a submission as server-sent events
+func handleSubmissionEvents(w http.ResponseWriter, r *http.Request, caller Caller, id string) {
+	submission, ok := submissions.get(id)
+	if !ok || submission.progress == nil || !submission.visibleTo(caller) {
+		notFound(w, "Submission not found")
+		return
+	}
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		writeError(w, http.StatusInternalServerError, ApiError{Code: ErrInternal, Message: "Streaming is not supported", Phase: PhaseRequest})
+		LogError("listing", "Streaming not supported by response writer")
+		return
+	}
+
+	// continue after the last event the client has seen when reconnecting
+	next := 0
+	if lastEventID, err := strconv.Atoi(r.Header.Get("Last-Event-ID")); err == nil {
+		next = lastEventID + 1
+	}
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.WriteHeader(http.StatusOK)
+	flusher.Flush()
+
+	for {
+		events, changed, finished := submission.progress.eventsSince(next)
+		for _, event := range events {
+			data, err := json.Marshal(event)
+			if err != nil {
+				LogError("listing", "Could not encode progress event: %s", err)
+				return
+			}
+			fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", next, event.Type, data)
+			next++
+		}
+		flusher.Flush()
+		if finished {
+			return
+		}
+		select {
+		case <-changed:
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
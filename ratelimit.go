@@ -0,0 +1,272 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// RateLimit limits the test runs of a user or course, zero values mean no limit
+type RateLimit struct {
+	// RequestsPerMinute is the rate in which the token bucket is refilled
+	RequestsPerMinute float64 `json:",omitempty"`
+	// Burst is the size of the token bucket, i.e. the number of requests allowed at once (default 1)
+	Burst int `json:",omitempty"`
+	// MaxConcurrent is the maximum number of runs which are queued or running at the same time
+	MaxConcurrent int `json:",omitempty"`
+}
+
+// LimitsConfig is the content of the file given by the limits flag
+type LimitsConfig struct {
+	// User limits each caller
+	User RateLimit
+	// Course limits all callers of a course (the top-level folder of a test) together
+	Course RateLimit
+	// Courses replaces the course limits for single courses
+	Courses map[string]RateLimit `json:",omitempty"`
+}
+
+func loadLimitsConfig(file string) (LimitsConfig, error) {
+	var config LimitsConfig
+	f, err := os.Open(file)
+	if err != nil {
+		return config, err
+	}
+	defer f.Close()
+	if err := json.NewDecoder(f).Decode(&config); err != nil {
+		return config, fmt.Errorf("Could not read limits %s: %s", file, err)
+	}
+	return config, nil
+}
+
+// RateLimitError is returned with status 429 if a limit is exceeded, the fields with JSON names are the details of the error
+type RateLimitError struct {
+	Code    ApiErrorCode `json:"-"`
+	Message string       `json:"-"`
+	// Scope is "user" or "course"
+	Scope string    `json:"scope"`
+	Key   string    `json:"key"`
+	Limit RateLimit `json:"limit"`
+	// RetryAfter is the number of seconds until the next request is allowed, 0 if unknown
+	RetryAfter int `json:"retry_after,omitempty"`
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+}
+
+func (limit RateLimit) burst() float64 {
+	if limit.Burst <= 0 {
+		return 1
+	}
+	return float64(limit.Burst)
+}
+
+// refill adds the tokens for the time since the last refill
+func (b *tokenBucket) refill(limit RateLimit, now time.Time) {
+	b.tokens = math.Min(limit.burst(), b.tokens+now.Sub(b.last).Minutes()*limit.RequestsPerMinute)
+	b.last = now
+}
+
+// waitTime returns the time until the next token is available
+func (b *tokenBucket) waitTime(limit RateLimit) time.Duration {
+	if b.tokens >= 1 {
+		return 0
+	}
+	return time.Duration((1 - b.tokens) / limit.RequestsPerMinute * float64(time.Minute))
+}
+
+// rateLimiter tracks the requests and running test runs of users and courses
+type rateLimiter struct {
+	sync.Mutex
+	config  LimitsConfig
+	buckets map[string]*tokenBucket
+	running map[string]int
+	// keys of the runs holding a concurrency slot
+	runs map[string][]string
+}
+
+var rateLimits = newRateLimiter(LimitsConfig{})
+
+func newRateLimiter(config LimitsConfig) *rateLimiter {
+	return &rateLimiter{
+		config:  config,
+		buckets: make(map[string]*tokenBucket),
+		running: make(map[string]int),
+		runs:    make(map[string][]string),
+	}
+}
+
+type limitCheck struct {
+	scope string
+	key   string
+	limit RateLimit
+}
+
+func (l *rateLimiter) courseLimit(course string) RateLimit {
+	if limit, ok := l.config.Courses[course]; ok {
+		return limit
+	}
+	return l.config.Course
+}
+
+func (l *rateLimiter) checks(user string, course string) []limitCheck {
+	return []limitCheck{
+		{scope: "user", key: user, limit: l.config.User},
+		{scope: "course", key: course, limit: l.courseLimit(course)},
+	}
+}
+
+// acquire checks the limits of the user and course and takes a token and a concurrency slot for the run.
+// The slot is kept until release is called with the id of the run.
+func (l *rateLimiter) acquire(id string, user string, course string) *RateLimitError {
+	l.Lock()
+	defer l.Unlock()
+	now := time.Now()
+	checks := l.checks(user, course)
+
+	// check all limits first, so that nothing is taken if one of them is exceeded
+	for _, c := range checks {
+		name := c.scope + ":" + c.key
+		if c.limit.MaxConcurrent > 0 && l.running[name] >= c.limit.MaxConcurrent {
+			return &RateLimitError{
+				Code:    ErrTooManyRuns,
+				Message: fmt.Sprintf("Only %d test runs of this %s are allowed at the same time, please wait for the results of the previous runs.", c.limit.MaxConcurrent, c.scope),
+				Scope:   c.scope,
+				Key:     c.key,
+				Limit:   c.limit,
+			}
+		}
+		if c.limit.RequestsPerMinute > 0 {
+			bucket, ok := l.buckets[name]
+			if !ok {
+				bucket = &tokenBucket{tokens: c.limit.burst(), last: now}
+				l.buckets[name] = bucket
+			}
+			bucket.refill(c.limit, now)
+			if wait := bucket.waitTime(c.limit); wait > 0 {
+				return &RateLimitError{
+					Code:       ErrRateLimited,
+					Message:    fmt.Sprintf("Too many test runs of this %s, please try again in %d seconds.", c.scope, int(math.Ceil(wait.Seconds()))),
+					Scope:      c.scope,
+					Key:        c.key,
+					Limit:      c.limit,
+					RetryAfter: int(math.Ceil(wait.Seconds())),
+				}
+			}
+		}
+	}
+
+	for _, c := range checks {
+		name := c.scope + ":" + c.key
+		if bucket, ok := l.buckets[name]; ok && c.limit.RequestsPerMinute > 0 {
+			bucket.tokens--
+		}
+		if c.limit.MaxConcurrent > 0 {
+			l.running[name]++
+			l.runs[id] = append(l.runs[id], name)
+		}
+	}
+	return nil
+}
+
+// release frees the concurrency slots of a finished run
+func (l *rateLimiter) release(id string) {
+	l.Lock()
+	defer l.Unlock()
+	for _, name := range l.runs[id] {
+		l.running[name]--
+		if l.running[name] <= 0 {
+			delete(l.running, name)
+		}
+	}
+	delete(l.runs, id)
+}
+
+// removeFullBuckets forgets the buckets which are full again, they are created again on the next request
+func (l *rateLimiter) removeFullBuckets() {
+	l.Lock()
+	defer l.Unlock()
+	now := time.Now()
+	for name, bucket := range l.buckets {
+		limit := l.config.User
+		if strings.HasPrefix(name, "course:") {
+			limit = l.courseLimit(strings.TrimPrefix(name, "course:"))
+		}
+		bucket.refill(limit, now)
+		if bucket.tokens >= limit.burst() {
+			delete(l.buckets, name)
+		}
+	}
+}
+
+// rateLimitCleanupService periodically removes unused token buckets from memory
+func rateLimitCleanupService() {
+	for {
+		time.Sleep(time.Minute)
+		rateLimits.removeFullBuckets()
+	}
+}
+
+// callerID identifies the user of a request for rate limiting.
+// Frontends can pass the user with the X-Rte-User header or the user field of the submission, otherwise the key or the address of the client is used.
+func callerID(r *http.Request, caller Caller, user string) string {
+	if caller.User != "" {
+		return caller.Name + "/" + caller.User
+	}
+	if header := r.Header.Get("X-Rte-User"); header != "" {
+		user = header
+	}
+	if user != "" {
+		if caller.Anonymous {
+			return user
+		}
+		// users of different keys are different users
+		return caller.Name + "/" + user
+	}
+	if !caller.Anonymous {
+		return caller.Name
+	}
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// courseOf returns the course of a test, i.e. its top-level folder
+func courseOf(testref string) string {
+	return strings.SplitN(filepath.ToSlash(testref), "/", 2)[0]
+}
+
+// checkRateLimits takes the limits for a new run of the test.
+// If a limit is exceeded, a 429 response is written and false is returned.
+func checkRateLimits(w http.ResponseWriter, r *http.Request, caller Caller, user string, id string, testref string) bool {
+	user = callerID(r, caller, user)
+	course := courseOf(testref)
+	limitErr := rateLimits.acquire(id, user, course)
+	if limitErr == nil {
+		return true
+	}
+	rateLimitedCounter.WithLabelValues(limitErr.Scope, course).Inc()
+	LogError("upload", "Rate limit of %s %s exceeded: %s", limitErr.Scope, limitErr.Key, limitErr.Code)
+	if limitErr.RetryAfter > 0 {
+		w.Header().Set("Retry-After", strconv.Itoa(limitErr.RetryAfter))
+	}
+	writeError(w, http.StatusTooManyRequests, ApiError{
+		Code:    limitErr.Code,
+		Message: limitErr.Message,
+		Details: limitErr,
+		Phase:   PhaseQueue,
+	})
+	return false
+}
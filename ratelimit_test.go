@@ -0,0 +1,54 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/client_golang/prometheus/testutil"
+)
+
+func TestRateLimitsOnlyForAccessibleTests(t *testing.T) {
+	useCatalog(t, pythonIOTest("course/io"))
+	previous := rateLimits
+	rateLimits = newRateLimiter(LimitsConfig{Course: RateLimit{RequestsPerMinute: 1, Burst: 1}})
+	t.Cleanup(func() { rateLimits = previous })
+
+	student := Caller{Name: "student", Scopes: []string{"course"}}
+	other := Caller{Name: "other", Scopes: []string{"other"}}
+	cases := []struct {
+		name   string
+		caller Caller
+		test   string
+		status int
+	}{
+		// unknown tests and tests of other courses do not take a token of the course
+		{"unknown test", student, "course/missing", http.StatusNotFound},
+		{"unknown course", student, "evil-1/x", http.StatusNotFound},
+		{"other course", other, "course/io", http.StatusNotFound},
+		{"first run", student, "course/io", http.StatusOK},
+		{"second run", student, "course/io", http.StatusTooManyRequests},
+	}
+	for _, c := range cases {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", "/test", nil)
+		execution, ok := prepareExecution(w, r, c.caller, submission(c.test))
+		status := w.Code
+		if ok {
+			status = http.StatusOK
+			rateLimits.release(execution.ID)
+		}
+		if status != c.status {
+			t.Errorf("%s: status %d, want %d: %s", c.name, status, c.status, w.Body.String())
+		}
+	}
+
+	if n := testutil.ToFloat64(rateLimitedCounter.WithLabelValues("course", "course")); n != 1 {
+		t.Errorf("%v rejected runs of the course counted, want 1", n)
+	}
+	for _, course := range []string{"evil-1", "course/missing"} {
+		if _, ok := rateLimits.buckets["course:"+course]; ok {
+			t.Errorf("the limits of the unknown course %s were taken", course)
+		}
+	}
+}
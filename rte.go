@@ -1,20 +1,20 @@
 package main
 
 import (
+	"encoding/base64"
 	"encoding/json"
 	"encoding/xml"
 	"flag"
 	"fmt"
-	"io"
 	"io/ioutil"
+	"mime/multipart"
 	"net/http"
 	"os"
 	"path/filepath"
-	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
-	"github.com/mattn/go-zglob"
 	"github.com/prometheus/client_golang/prometheus/promhttp"
 	uuid "github.com/satori/go.uuid"
 )
@@ -31,33 +31,62 @@ var resourcedir = "resources"
 // Template files are like resource files, but do not overwrite user files
 var templateDir = "template"
 var libDir = "lib"
-var apiKey string = "etywsNj7W2GnszdpewwzZqndMypv9wcq"
 
 type RteResult struct {
 	TestResult   TestResult     `json:"test_result"`
 	FileWarnings []FileWarnings `json:"file_warnings,omitempty"`
 	ClocResults  []ClocResult   `json:"cloc_result"`
+	// Commit is the hash of the submitted commit of a Git repository
+	Commit string `json:"commit,omitempty"`
 }
 
 type Test struct {
-	Name     string `json:"name"`
-	Success  bool   `json:"success"`
-	Error    string `json:"error,omitempty"`
+	Name           string `json:"name"`
+	Success        bool   `json:"success"`
+	Error          string `json:"error,omitempty"`
+	Expected       string `json:"expected,omitempty"`
+	Output         string `json:"output,omitempty"`
+	Timeout        bool   `json:"timeout,omitempty"`
+	MemoryExceeded bool   `json:"memory_exceeded,omitempty"`
+	// Weight is the number of points of an IO test case, if its manifest gives one
+	Weight *float64 `json:"weight,omitempty"`
+	// Hidden test cases do not show their input, expected and actual output
+	Hidden bool `json:"hidden,omitempty"`
+	// ExitCode is the exit status of the program of an IO test case
+	ExitCode *int `json:"exit_code,omitempty"`
+	// Mismatches are the expectations of an IO test case the program did not meet
+	Mismatches []Mismatch `json:"mismatches,omitempty"`
+}
+
+// Mismatch is a failed expectation of an IO test case.
+// For stdout, the expected and actual output are in Expected and Output of the Test.
+type Mismatch struct {
+	// Check is stdout, stderr or exit_code
+	Check    string `json:"check"`
 	Expected string `json:"expected,omitempty"`
-	Output   string `json:"output,omitempty"`
+	Actual   string `json:"actual,omitempty"`
+	// Diff shows the differing lines of stdout and stderr
+	Diff *OutputDiff `json:"diff,omitempty"`
 }
 
 // TestResult represents the result of executing a test on some input
 type TestResult struct {
-	ID            string   `json:"id"`
-	Compiled      bool     `json:"compiled"`
-	CompileError  string   `json:"compile_error,omitempty"`
-	InternalError string   `json:"internal_error,omitempty"`
-	Tests         []Test   `json:"tests"`
-	TestsExecuted int      `json:"tests_executed"`
-	TestsFailed   int      `json:"tests_failed"`
-	MissingFiles  []string `json:"missing_files"`
-	IllegalFiles  []string `json:"illegal_files"`
+	ID             string   `json:"id"`
+	Compiled       bool     `json:"compiled"`
+	CompileError   string   `json:"compile_error,omitempty"`
+	CompileTimeout bool     `json:"compile_timeout,omitempty"`
+	InternalError  string   `json:"internal_error,omitempty"`
+	Tests          []Test   `json:"tests"`
+	TestsExecuted  int      `json:"tests_executed"`
+	TestsFailed    int      `json:"tests_failed"`
+	MissingFiles   []string `json:"missing_files"`
+	IllegalFiles   []string `json:"illegal_files"`
+	// Score and MaxScore are the points of the passed and of all test cases, if the cases have weights
+	Score    float64 `json:"score,omitempty"`
+	MaxScore float64 `json:"max_score,omitempty"`
+
+	// Error has the code of a compile or internal error, using the same schema as error responses
+	Error *ApiError `json:"error,omitempty"`
 }
 
 // Execution represents an execution of a test as it is channeled through the system
@@ -70,22 +99,41 @@ type Execution struct {
 	ResChan      chan TestResult
 	AnalysisChan chan []FileWarnings
 	ClocChan     chan []ClocResult
+	Progress     *progressStream
+	Uploads      []UploadedFile
+	Priority     Priority
+	Caller       string // name of the API key which started the execution
+	Lti          *ltiLaunch
+	Commit       string     // hash of the commit if the files were submitted as Git repository
+	ioSession    *ioSession // container shared by the cases of an IO test, if -io_session is set
+	// Started is closed when a compile service starts working on the execution
+	Started chan struct{}
 }
 
 // TestConfig represents the configuration of a test (for JSON marchalling)
 type TestConfig struct {
-	Compiler         Compiler
-	TestType         TestType
-	MainIs           string   `json:",omitempty"`
-	Timeout          int      `json:",omitempty"`
-	MaxMem           int      `json:",omitempty"`
-	AnalysisTimeout  int      `json:",omitempty"`
-	AnalysisMaxMem   int      `json:",omitempty"`
-	CompareTool      string   `json:",omitempty"`
-	CompareToolArgs  []string `json:",omitempty"`
-	RequiredFiles    []string `json:",omitempty"`
-	AllowedFiles     []string `json:",omitempty"`
-	UploadsDirectory string   `json:",omitempty"`
+	Compiler            Compiler
+	TestType            TestType
+	MainIs              string           `json:",omitempty"`
+	Timeout             int              `json:",omitempty"`
+	MaxMem              int              `json:",omitempty"`
+	AnalysisTimeout     int              `json:",omitempty"`
+	AnalysisMaxMem      int              `json:",omitempty"`
+	CompileTimeout      int              `json:",omitempty"`
+	CompileMaxMem       int              `json:",omitempty"`
+	CompareTool         string           `json:",omitempty"`
+	CompareToolArgs     []string         `json:",omitempty"`
+	CompareMode         CompareMode      `json:",omitempty"`
+	CompareAbsTolerance float64          `json:",omitempty"`
+	CompareRelTolerance float64          `json:",omitempty"`
+	RequiredFiles       []string         `json:",omitempty"`
+	AllowedFiles        []string         `json:",omitempty"`
+	UploadsDirectory    string           `json:",omitempty"`
+	Security            *SecurityProfile `json:",omitempty"`
+	HiddenTemplateFiles []string         `json:",omitempty"`
+	MaxUploadBytes      int64            `json:",omitempty"`
+	MaxFiles            int              `json:",omitempty"`
+	Parallelism         int              `json:",omitempty"`
 }
 
 type FileWarnings struct {
@@ -104,11 +152,6 @@ type Warning struct {
 	Message   string   `xml:",chardata" json:"message,omitempty"`
 }
 
-var compileChannel = make(chan Execution)
-var testChannel = make(chan Execution)
-var analysisChannel = make(chan Execution)
-var metricChannel = make(chan Execution)
-
 func (exec *Execution) getTestDir() string {
 	return filepath.Join(testdataDir, filepath.Clean(exec.Test))
 }
@@ -118,13 +161,8 @@ func returnRteResult(w http.ResponseWriter, res *RteResult) {
 	enc.Encode(res)
 }
 
-func returnTestResult(w http.ResponseWriter, res *TestResult) {
-	enc := json.NewEncoder(w)
-	rteResult := RteResult{
-		TestResult: *res,
-	}
-	enc.Encode(rteResult)
-}
+// redactedHeaders contain credentials, their values are not shown by formatRequest
+var redactedHeaders = map[string]bool{"apikey": true, "authorization": true, "cookie": true}
 
 // formatRequest generates ascii representation of a request
 func formatRequest(r *http.Request) string {
@@ -142,6 +180,9 @@ func formatRequest(r *http.Request) string {
 	for name, headers := range r.Header {
 		name = strings.ToLower(name)
 		for _, h := range headers {
+			if redactedHeaders[name] {
+				h = "[redacted]"
+			}
 			request = append(request, fmt.Sprintf("%v: %v", name, h))
 		}
 	}
@@ -164,6 +205,9 @@ func FormValueFlexible(r *http.Request, key string) string {
 	if vs := r.Form[key]; len(vs) > 0 {
 		return vs[0]
 	}
+	if r.MultipartForm == nil {
+		return ""
+	}
 	if vs := r.MultipartForm.File[key]; vs != nil {
 		file, err := vs[0].Open()
 		if err != nil {
@@ -184,239 +228,358 @@ func handleTest(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 	if r.Method != "POST" {
-		w.WriteHeader(http.StatusNotFound)
+		rejectMethod(w, r, "POST")
 		LogError("upload", "Rejected POST request from %s", r.RemoteAddr)
 		return
 	}
 
-	accessCounter.Inc()
-	println("handleTest ######################################################")
-	println(formatRequest(r))
-	testid := uuid.NewV4()
+	if debug {
+		Debug.Printf("handleTest\n%s", formatRequest(r))
+	}
 
-	if apiKey != "" {
-		sentApiKey := r.Header.Get("ApiKey")
-		if sentApiKey != apiKey {
-			w.WriteHeader(http.StatusForbidden)
-			LogError("upload", "Invalid or missing ApiKey")
-			return
-		}
+	caller, ok := authenticate(w, r, "upload")
+	if !ok {
+		return
 	}
 
-	r.ParseMultipartForm(maxMemory)
-	testref := filepath.Clean(FormValueFlexible(r, "test"))
-	if testref == "" {
-		w.WriteHeader(http.StatusBadRequest)
-		fmt.Fprintf(w, "Parameter 'test' required!")
-		LogError("upload", "Missing parameter 'test'")
+	request, ok := parseFormSubmission(w, r)
+	if !ok {
 		return
 	}
-	testdir := filepath.Join(testdataDir, testref)
-	if stat, err := os.Stat(testdir); err != nil || !stat.IsDir() {
-		w.WriteHeader(http.StatusNotFound)
-		fmt.Fprintf(w, "Test not found!\n")
-		LogError("upload", "Test not found: %s", testref)
+	execution, ok := prepareExecution(w, r, caller, request)
+	if !ok {
 		return
 	}
 
-	configfile, err := os.Open(filepath.Join(testdir, "config.json"))
-	if err != nil {
-		w.WriteHeader(http.StatusNotFound)
-		fmt.Fprintf(w, "Config for test not found: %s\n", testdir)
-		LogError("upload", "Test is missing config file: %s", testref)
+	rteResult := RteResult{Commit: execution.Commit}
+	record := newRunRecord(execution)
+
+	// send test execution into the pipeline
+	if !compileQueue.push(execution) {
+		rejectOverloaded(w, execution)
 		return
 	}
-	defer configfile.Close()
-	dec := json.NewDecoder(configfile)
-	var testConfig TestConfig
-	err = dec.Decode(&testConfig)
-	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		fmt.Fprintf(w, "Error reading test configuration: %s (%s)\n", testdir, err)
-		LogError("upload", "Error in test configuration; %s (%s)", testdir, err)
-		return
+	storeRun(record)
+	<-execution.Started
+	record.start()
+	storeRun(record)
+	if execution.AnalysisChan != nil {
+		rteResult.FileWarnings = <-execution.AnalysisChan
 	}
+	rteResult.TestResult = <-execution.ResChan
+	returnRteResult(w, &rteResult)
+	rteResult.ClocResults = <-execution.ClocChan
+	returnRteResult(w, &rteResult)
+	finishRun(execution, &record, &rteResult)
+}
 
-	rundir := filepath.Join(testrunDir, testid.String())
-	err = os.MkdirAll(rundir, 0777)
+// finishRun stores the result of an execution and releases the resources it holds
+func finishRun(execution Execution, record *RunRecord, result *RteResult) {
+	record.finish(result)
+	storeRun(*record)
+	rateLimits.release(execution.ID)
+	sendLtiGradeOfExecution(execution, result)
+}
+
+// SubmittedFile is a file of a submission
+type SubmittedFile struct {
+	// Name is the path of the file relative to the uploads directory of the test
+	Name    string `json:"name"`
+	Content string `json:"content"`
+	// Encoding is "base64" for binary content, text is sent without encoding
+	Encoding string `json:"encoding,omitempty"`
+}
+
+func (f SubmittedFile) bytes() ([]byte, error) {
+	switch f.Encoding {
+	case "":
+		return []byte(f.Content), nil
+	case "base64":
+		return base64.StdEncoding.DecodeString(f.Content)
+	default:
+		return nil, fmt.Errorf("Unknown encoding of file %s: %s", f.Name, f.Encoding)
+	}
+}
+
+// SubmissionRequest is a submission of files for a test
+type SubmissionRequest struct {
+	Test string `json:"test"`
+	// Priority is "high", "normal" (default) or "low"
+	Priority string `json:"priority,omitempty"`
+	// User is the user submitting the files, used for rate limiting
+	User  string          `json:"user,omitempty"`
+	Files []SubmittedFile `json:"files"`
+	// Archive is a zip or tar.gz archive, its files are submitted with their paths inside the archive
+	Archive *SubmittedFile `json:"archive,omitempty"`
+	// Git is a repository, the files of the commit are submitted
+	Git *GitSource `json:"git,omitempty"`
+}
+
+// readFormFile reads an uploaded file of a multipart form
+func readFormFile(header *multipart.FileHeader) (SubmittedFile, error) {
+	file, err := header.Open()
 	if err != nil {
-		w.WriteHeader(http.StatusInternalServerError)
-		w.Write([]byte(err.Error()))
-		LogError("upload", "Could not create test folder: %s", rundir)
-		return
+		return SubmittedFile{}, err
 	}
-	uploadFolder := filepath.Join(rundir, testConfig.UploadsDirectory)
-	err = os.MkdirAll(uploadFolder, os.ModePerm)
+	defer file.Close()
+	content, err := ioutil.ReadAll(file)
+	if err != nil {
+		return SubmittedFile{}, err
+	}
+	return SubmittedFile{Name: header.Filename, Content: string(content)}, nil
+}
 
-	numfilesStr := FormValueFlexible(r, "numfiles")
+// readFormSources reads the archive and the Git repository of a submission from the fields archive, git_url, git_ref and git_bundle of a form
+func readFormSources(r *http.Request, request *SubmissionRequest) error {
+	if r.MultipartForm != nil && len(r.MultipartForm.File["archive"]) > 0 {
+		archive, err := readFormFile(r.MultipartForm.File["archive"][0])
+		if err != nil {
+			return err
+		}
+		request.Archive = &archive
+	}
+	if url := r.FormValue("git_url"); url != "" {
+		request.Git = &GitSource{URL: url}
+	}
+	if r.MultipartForm != nil && len(r.MultipartForm.File["git_bundle"]) > 0 {
+		bundle, err := readFormFile(r.MultipartForm.File["git_bundle"][0])
+		if err != nil {
+			return err
+		}
+		request.Git = &GitSource{Bundle: &bundle}
+	}
+	if request.Git != nil {
+		request.Git.Ref = r.FormValue("git_ref")
+	}
+	return nil
+}
 
-	if len(numfilesStr) > 0 {
+// parseFormSubmission reads a submission from the form fields of /test and /submissions, which contain either
+// the files file0 to file<numfiles-1>, a single file with the fields code and filename, a zip or tar.gz file archive
+// or a Git repository.
+// If the form is invalid, the response is written and false is returned.
+func parseFormSubmission(w http.ResponseWriter, r *http.Request) (SubmissionRequest, bool) {
+	limitRequestBody(w, r)
+	// other errors are ignored, the missing fields are reported below
+	if err := r.ParseMultipartForm(maxMemory); isRequestTooLarge(err) {
+		writeRequestTooLarge(w)
+		return SubmissionRequest{}, false
+	}
+	request := SubmissionRequest{
+		Test:     FormValueFlexible(r, "test"),
+		Priority: FormValueFlexible(r, "priority"),
+		User:     FormValueFlexible(r, "user"),
+	}
+
+	if err := readFormSources(r, &request); err != nil {
+		writeError(w, http.StatusBadRequest, ApiError{Code: ErrUploadFailed, Message: err.Error(), Phase: PhaseUpload})
+		LogError("upload", "Error reading archive from request: %s", err)
+		return request, false
+	}
 
-		numfiles, err := strconv.Atoi(numfilesStr)
+	numfilesStr := FormValueFlexible(r, "numfiles")
+	if len(numfilesStr) == 0 {
+		if (request.Archive != nil || request.Git != nil) && FormValueFlexible(r, "filename") == "" {
+			return request, true
+		}
+		request.Files = []SubmittedFile{{Name: FormValueFlexible(r, "filename"), Content: FormValueFlexible(r, "code")}}
+		return request, true
+	}
+	numfiles, err := strconv.Atoi(numfilesStr)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ApiError{
+			Code:    ErrInvalidParameter,
+			Message: err.Error(),
+			Details: map[string]string{"parameter": "numfiles"},
+			Phase:   PhaseRequest,
+		})
+		LogError("upload", "Error parsing number of files: %s", err)
+		return request, false
+	}
+	for i := 0; i < numfiles; i++ {
+		_, header, err := r.FormFile(fmt.Sprintf("file%d", i))
+		var file SubmittedFile
+		if err == nil {
+			file, err = readFormFile(header)
+		}
 		if err != nil {
-			w.WriteHeader(http.StatusBadRequest)
-			w.Write([]byte(err.Error()))
-			LogError("upload", "Error parsing number of files: %s", err)
-			return
+			writeError(w, http.StatusBadRequest, ApiError{Code: ErrUploadFailed, Message: err.Error(), Phase: PhaseUpload})
+			LogError("upload", "Error reading file from request: %s", err)
+			return request, false
 		}
+		request.Files = append(request.Files, file)
+	}
+	return request, true
+}
 
-		//check for required and allowed files
-		if len(testConfig.AllowedFiles) > 0 || len(testConfig.RequiredFiles) > 0 {
-			//create list of file names
-			files := make([]string, numfiles)
-			for i := 0; i < numfiles; i++ {
-				_, header, err := r.FormFile(fmt.Sprintf("file%d", i))
-				if err != nil {
-					w.WriteHeader(http.StatusInternalServerError)
-					w.Write([]byte(err.Error()))
-					LogError("upload", "Error reading file from request: %s", err)
-					return
-				}
-				files[i] = header.Filename
-			}
+// prepareExecution reads the test configuration and writes the files of a submission into a new run directory.
+// If the submission cannot be executed, the response is written and false is returned.
+func prepareExecution(w http.ResponseWriter, r *http.Request, caller Caller, request SubmissionRequest) (execution Execution, ok bool) {
+	testid := uuid.NewV4()
 
-			//check if all required files are uploaded
-			if len(testConfig.RequiredFiles) > 0 {
-				var missingFiles []string
-				for _, required := range testConfig.RequiredFiles {
-					missing := true
-					for _, file := range files {
-						if required == file {
-							missing = false
-							break
-						}
-					}
-					if missing {
-						missingFiles = append(missingFiles, required)
-					}
-				}
-				if len(missingFiles) > 0 {
-					res := TestResult{
-						ID:           testid.String(),
-						Compiled:     false,
-						MissingFiles: missingFiles,
-					}
-					returnTestResult(w, &res)
-					return
-				}
-			}
-			//check if all files match a regexp
-			if len(testConfig.AllowedFiles) > 0 {
-				var regex []*regexp.Regexp
-				var illegalFiles []string
-				for _, allowed := range testConfig.AllowedFiles {
-					r, err := regexp.Compile(allowed)
-					if err != nil {
-						w.WriteHeader(http.StatusInternalServerError)
-						w.Write([]byte(err.Error()))
-						LogError("matching", "Error parsing regular expression %s in test %s", allowed, testref)
-						return
-					}
-					regex = append(regex, r)
-				}
-				for _, file := range files {
-					matches := false
-					for _, r := range regex {
-						if r.MatchString(file) {
-							matches = true
-							break
-						}
-					}
-					if !matches {
-						illegalFiles = append(illegalFiles, file)
-						fmt.Printf("File %s not allowed for test %s\n", file, testref)
-					}
-				}
-				if len(illegalFiles) > 0 {
-					res := TestResult{
-						ID:           testid.String(),
-						Compiled:     false,
-						IllegalFiles: illegalFiles,
-					}
-					returnTestResult(w, &res)
-					return
-				}
-			}
+	testref := request.Test
+	if testref == "" {
+		writeError(w, http.StatusBadRequest, ApiError{
+			Code:    ErrMissingParameter,
+			Message: "Parameter 'test' required",
+			Details: map[string]string{"parameter": "test"},
+			Phase:   PhaseRequest,
+		})
+		LogError("upload", "Missing parameter 'test'")
+		return Execution{}, false
+	}
+	testref = filepath.Clean(testref)
+	priority, err := parsePriority(request.Priority)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, ApiError{
+			Code:    ErrInvalidParameter,
+			Message: err.Error(),
+			Details: map[string]string{"parameter": "priority"},
+			Phase:   PhaseRequest,
+		})
+		LogError("upload", "%s", err)
+		return Execution{}, false
+	}
+	if granted := caller.priority(priority); granted != priority {
+		Info.Printf("Caller %s may not use the priority %s, using %s\n", caller.Name, priority, granted)
+		priority = granted
+	}
+	test, found := catalog.get(testref)
+	if !found || !caller.canAccess(testref) {
+		writeError(w, http.StatusNotFound, ApiError{
+			Code:    ErrTestNotFound,
+			Message: "Test not found",
+			Details: map[string]string{"test": testref},
+			Phase:   PhaseConfig,
+		})
+		LogError("upload", "Test not found: %s", testref)
+		return Execution{}, false
+	}
+	if !test.valid() {
+		writeInvalidTestConfig(w, test)
+		LogError("upload", "%s", TestConfigError{Test: testref, Problems: test.Problems})
+		return Execution{}, false
+	}
+	// the limits are only taken for existing tests, so that the courses of the limits and metrics are known
+	if !checkRateLimits(w, r, caller, request.User, testid.String(), test.Ref) {
+		return Execution{}, false
+	}
+	defer func() {
+		// the run only keeps its slot if it is executed
+		if !ok {
+			rateLimits.release(testid.String())
 		}
+	}()
+	testdir, testConfig := test.Dir, test.Config
 
+	if request.Archive != nil {
+		files, err := extractArchive(*request.Archive, defaultArchiveLimits())
 		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			w.Write([]byte(err.Error()))
-			LogError("upload", "Could not create upload folder %s: %s", uploadFolder, err)
-			return
+			writeError(w, http.StatusBadRequest, ApiError{Code: ErrInvalidArchive, Message: err.Error(), Details: err, Phase: PhaseUpload})
+			LogError("upload", "Could not extract archive %s: %s", request.Archive.Name, err)
+			return Execution{}, false
 		}
+		request.Files = append(request.Files, files...)
+	}
 
-		// copy files into run directory
-		for i := 0; i < numfiles; i++ {
-			file, header, err := r.FormFile(fmt.Sprintf("file%d", i))
-			if err != nil {
-				w.WriteHeader(http.StatusInternalServerError)
-				w.Write([]byte(err.Error()))
-				LogError("upload", "Error reading file from request: %s", err)
-				return
-			}
-			filename := header.Filename
-			relfilename := filepath.Join(uploadFolder, filename)
-			f, err := os.OpenFile(relfilename, os.O_WRONLY|os.O_CREATE, 0666)
-			if err != nil {
-				w.WriteHeader(http.StatusInternalServerError)
-				w.Write([]byte(err.Error()))
-				LogError("upload", "Could not open target file for writing: %s", relfilename)
-				return
+	var commit string
+	if request.Git != nil {
+		files, hash, err := fetchGitSource(*request.Git)
+		if err != nil {
+			status, apiErr := http.StatusInternalServerError, ApiError{Code: ErrInternal, Message: err.Error(), Phase: PhaseUpload}
+			if gitErr, ok := err.(GitError); ok {
+				status, apiErr = http.StatusUnprocessableEntity, ApiError{Code: ErrGitFailed, Message: err.Error(), Details: gitErr, Phase: PhaseUpload}
 			}
-			_, err = io.Copy(f, file)
-			f.Close()
-			file.Close()
+			writeError(w, status, apiErr)
+			LogError("upload", "Could not fetch Git repository for test %s: %s", testref, err)
+			return Execution{}, false
 		}
-	} else {
-		// copy code to test dir:
-		code := FormValueFlexible(r, "code")
-		filename := FormValueFlexible(r, "filename")
+		request.Files = append(request.Files, files...)
+		commit = hash
+	}
 
-		relfilename := filepath.Join(uploadFolder, filename) //this is the uploadfile
-		f, err := os.OpenFile(relfilename, os.O_WRONLY|os.O_CREATE, 0666)
-		if err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			w.Write([]byte(err.Error()))
-			LogError("upload", "Could not open target file for writing: %s", relfilename)
-			return
-		}
-		f.WriteString(code)
-		f.Close()
+	files, err := validateUploads(request.Files, testConfig, test.allowedFiles)
+	if result, ok := legacyUploadResult(testid.String(), err); ok && !isV2Request(r) {
+		returnRteResult(w, &RteResult{TestResult: result})
+		LogError("upload", "Rejected upload for test %s: %s", testref, err)
+		return Execution{}, false
+	}
+	if err != nil {
+		status, apiErr := uploadApiError(err)
+		writeError(w, status, apiErr)
+		LogError("upload", "Rejected upload for test %s: %s", testref, err)
+		return Execution{}, false
+	}
 
+	rundir := filepath.Join(testrunDir, testid.String())
+	err = os.MkdirAll(rundir, 0777)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, ApiError{Code: ErrInternal, Message: err.Error(), Phase: PhaseUpload})
+		LogError("upload", "Could not create test folder: %s", rundir)
+		return Execution{}, false
+	}
+	defer func() {
+		if !ok {
+			os.RemoveAll(rundir)
+		}
+	}()
+	uploadFolder := filepath.Join(rundir, testConfig.UploadsDirectory)
+	err = os.MkdirAll(uploadFolder, os.ModePerm)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, ApiError{Code: ErrInternal, Message: err.Error(), Phase: PhaseUpload})
+		LogError("upload", "Could not create upload folder %s: %s", uploadFolder, err)
+		return Execution{}, false
+	}
+
+	// copy files into run directory
+	for _, file := range files {
+		if err := writeUpload(uploadFolder, file); err != nil {
+			writeError(w, http.StatusInternalServerError, ApiError{
+				Code:    ErrUploadFailed,
+				Message: err.Error(),
+				Details: map[string]string{"file": file.Name},
+				Phase:   PhaseUpload,
+			})
+			LogError("upload", "Could not write file %s: %s", file.Name, err)
+			return Execution{}, false
+		}
 	}
 
-	rteResult := RteResult{}
+	uploads, err := hashUploads(rundir, uploadFolder)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, ApiError{Code: ErrInternal, Message: err.Error(), Phase: PhaseUpload})
+		LogError("upload", "Could not hash uploaded files: %s", err)
+		return Execution{}, false
+	}
+
+	execution = newExecution(testid.String(), rundir, testdir, testref, testConfig)
+	execution.Uploads = uploads
+	execution.Priority = priority
+	execution.Caller = caller.Name
+	execution.Lti = caller.lti
+	execution.Commit = commit
+	return execution, true
+}
 
-	// send test execution into the pipeline
-	resChan := make(chan TestResult)
-	clocResultChannel := make(chan []ClocResult)
+// newExecution creates an execution with the channels needed to receive its results from the pipeline
+func newExecution(id string, rundir string, testdir string, testref string, testConfig TestConfig) Execution {
 	execution := Execution{
-		ID:       testid.String(),
+		ID:       id,
 		RunDir:   rundir,
 		TestDir:  testdir,
 		Test:     testref,
 		Config:   testConfig,
-		ResChan:  resChan,
-		ClocChan: clocResultChannel,
+		ResChan:  make(chan TestResult),
+		ClocChan: make(chan []ClocResult),
+		Priority: PriorityNormal,
+		Started:  make(chan struct{}),
 	}
 
 	//run static analysis if rule file exists
-	analysisResultChannel := make(chan []FileWarnings)
 	if fileExists(filepath.Join(testdir, "pmd.xml")) || fileExists(filepath.Join(testdir, "checkstyle.xml")) {
-		execution.AnalysisChan = analysisResultChannel
-	} else {
-		close(analysisResultChannel)
+		execution.AnalysisChan = make(chan []FileWarnings)
 	}
-
-	compileChannel <- execution
-	rteResult.FileWarnings = <-analysisResultChannel
-	rteResult.TestResult = <-resChan
-	defer func() {
-		rteResult.ClocResults = <-clocResultChannel
-		returnRteResult(w, &rteResult)
-	}()
-	returnRteResult(w, &rteResult)
+	return execution
 }
 
 type ListResult struct {
@@ -426,36 +589,24 @@ type ListResult struct {
 
 func handleListTests(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "GET" {
-		w.WriteHeader(http.StatusNotFound)
+		rejectMethod(w, r, "GET")
 		LogError("listing", "Rejected POST request to list from %s", r.RemoteAddr)
 		return
 	}
 
-	if apiKey != "" {
-		sentApiKey := r.Header.Get("ApiKey")
-		if sentApiKey != apiKey {
-			w.WriteHeader(http.StatusForbidden)
-			LogError("listing", "Invalid or missing ApiKey")
-			return
-		}
+	caller, ok := authenticate(w, r, "listing")
+	if !ok {
+		return
 	}
 
-	configFiles, err := zglob.GlobFollowSymlinks(testdataDir + "/**/config.json") // using this instead of the builtin Glob which does not support '**'
+	fileNames, err := listTests(caller)
 	if err != nil {
-		handleError(w, err)
-		LogError("listing", "Could not find tests: %s", err)
+		// unlike /v2/tests, the errors of /listtests are not changed to the error schema for compatibility
+		enc := json.NewEncoder(w)
+		enc.Encode(ListResult{Success: false, Tests: []string{}})
+		LogError("listing", "Could not list tests: %s", err)
 		return
 	}
-	fileNames := make([]string, 0, len(configFiles))
-	for _, file := range configFiles {
-		test, err := filepath.Rel(testdataDir, filepath.Dir(file))
-		if err != nil {
-			handleError(w, err)
-			LogError("listing", "Could not create relative path for config file %s", file)
-			return
-		}
-		fileNames = append(fileNames, test)
-	}
 	res := ListResult{
 		Success: true,
 		Tests:   fileNames,
@@ -464,13 +615,19 @@ func handleListTests(w http.ResponseWriter, r *http.Request) {
 	enc.Encode(res)
 }
 
-func handleError(w http.ResponseWriter, err error) {
-	res := ListResult{
-		Success: false,
-		Tests:   []string{},
+// listTests returns the tests the caller has access to, tests with invalid configuration are left out
+func listTests(caller Caller) ([]string, error) {
+	tests := make([]string, 0)
+	for _, test := range catalog.list() {
+		if test.valid() && caller.canAccess(test.Ref) {
+			tests = append(tests, test.Ref)
+		}
 	}
-	enc := json.NewEncoder(w)
-	enc.Encode(res)
+	return tests, nil
+}
+
+func handleError(w http.ResponseWriter, err error) {
+	writeError(w, http.StatusInternalServerError, ApiError{Code: ErrInternal, Message: err.Error(), Phase: PhaseListing})
 }
 
 var (
@@ -482,6 +639,9 @@ var (
 	testSolutionFlag        = flag.Bool("testSolution", false, "Test the solutions stored in the test directory.")
 	testSolutionTestname    = flag.String("testName", "", "Testname of a specific solution to test. Use with 'testSolution'.")
 	contextPath             = flag.String("contextPath", "", "A prefix that is used for all URLs on the server.")
+	sandboxFlag             = flag.String("sandbox", "docker", "Sandbox used to compile and execute tests (docker, docker-cli, podman or local). The local sandbox runs everything on the host without isolation and is only meant for development.")
+	securityProfileFile     = flag.String("security_profile", "", "JSON file with the default security profile for sandboxed commands. Fields not given in the file keep their safe defaults.")
+	dockerSocket            = flag.String("docker_socket", "/var/run/docker.sock", "Unix socket of the Docker Engine API. Used by the docker sandbox.")
 	docker_image_python     = flag.String("docker_image_python", "softech-git.informatik.uni-kl.de:5050/stats/rte-go/pydev", "Image to use for Python tests.")
 	docker_image_matlab     = flag.String("docker_image_matlab", "matlab", "Image to use for Matlab tests.")
 	docker_image_fsharp     = flag.String("docker_image_fsharp", "softech-git.informatik.uni-kl.de:5050/stats/rte-go/fsharpdev", "Image to use for F# tests.")
@@ -494,6 +654,34 @@ var (
 	testrun_folder          = flag.String("testrun_folder", "runs", "Folder where individual test runs are stored. If this is not an absolute path it is interpreted relative to the basedir.")
 	tools_folder            = flag.String("tools_folder", "_tools", "Folder where individual test runs are stored. If this is not an absolute path it is interpreted relative to the testdata_folder.")
 	clean_testruns          = flag.Bool("clean_testruns", false, "Remove test run folders after executing tests.")
+	submissionRetention     = flag.Int("submission_retention", 60, "Minutes to keep the results of asynchronous submissions after they are finished.")
+	storeFlag               = flag.String("store", "bolt", "Store for the records and results of test runs (bolt, fs or none).")
+	storePath               = flag.String("store_path", "", "Database file (bolt) or folder (fs) of the store. Defaults to results.db or results in the basedir.")
+	storeRetention          = flag.Int("store_retention", 0, "Days to keep the records of finished test runs in the store. 0 keeps them forever.")
+	compileWorkers          = flag.Int("compile_workers", 10, "Number of submissions compiled in parallel.")
+	testWorkers             = flag.Int("test_workers", 10, "Number of submissions tested in parallel.")
+	analysisWorkers         = flag.Int("analysis_workers", 10, "Number of submissions analysed in parallel.")
+	metricWorkers           = flag.Int("metric_workers", 10, "Number of submissions measured with cloc in parallel.")
+	queueSize               = flag.Int("queue_size", 100, "Maximum number of submissions waiting to be compiled. Further submissions are rejected with 503. 0 means unlimited.")
+	queueRetryAfter         = flag.Int("queue_retry_after", 30, "Seconds sent in the Retry-After header when the queue is full.")
+	keysFile                = flag.String("keys", "", "JSON file with the API keys and their scopes. The file is reloaded on SIGHUP.")
+	ltiFile                 = flag.String("lti", "", "JSON file with the LTI 1.3 platforms whose signed tokens are accepted.")
+	ltiDevPlatformFlag      = flag.String("lti_dev_platform", "", "Start a stand-in LMS for testing the LTI integration on the given address (e.g. :3010) instead of RTE.")
+	limitsFile              = flag.String("limits", "", "JSON file with the rate limits and concurrent run limits of users and courses.")
+	requeueInterrupted      = flag.Bool("requeue_interrupted", false, "Execute runs interrupted by a restart again instead of marking them as failed.")
+	maxUploadBytesFlag      = flag.Int64("max_upload_bytes", 10*1024*1024, "Maximum size of the files of a submission. Tests can change it with MaxUploadBytes.")
+	maxFilesFlag            = flag.Int("max_files", 100, "Maximum number of files of a submission. Tests can change it with MaxFiles.")
+	maxRequestBytes         = flag.Int64("max_request_bytes", 32*1024*1024, "Maximum size of the body of a submission request, which must allow the largest MaxUploadBytes of the tests plus -archive_max_bytes (and the overhead of base64 in JSON). Larger requests are rejected with 413.")
+	archiveMaxBytes         = flag.Int64("archive_max_bytes", 10*1024*1024, "Maximum size of the extracted content of an uploaded zip or tar.gz archive.")
+	archiveMaxEntries       = flag.Int("archive_max_entries", 1000, "Maximum number of files in an uploaded zip or tar.gz archive.")
+	gitProtocols            = flag.String("git_protocols", "https", "Comma separated list of protocols allowed for submitted Git repositories, e.g. https,ssh,file.")
+	gitTimeout              = flag.Int("git_timeout", 60, "Maximum number of seconds for fetching a submitted Git repository.")
+	gitMaxBytes             = flag.Int64("git_max_bytes", 10*1024*1024, "Maximum size of the files of a submitted Git commit.")
+	gitMaxFetchBytes        = flag.Int64("git_max_fetch_bytes", 20*1024*1024, "Maximum size of the data fetched for a submitted Git repository, 0 for no limit.")
+	gitHosts                = flag.String("git_hosts", "", "Comma separated list of hosts from which Git repositories may be fetched with other protocols than file, e.g. github.com,.example.org for all its subdomains.")
+	watchTests              = flag.Bool("watch_tests", true, "Reload the configurations of the tests when files in the testdata folder change.")
+	ioParallelism           = flag.Int("io_parallelism", 1, "Number of cases of an IO test executed in parallel for a submission. Tests can change it with Parallelism.")
+	ioSessionFlag           = flag.Bool("io_session", false, "Execute all cases of an IO test in one container using exec instead of starting a container for each case. The cases share /tmp and see the processes of each other, they are not executed in parallel. The images need the timeout command.")
 )
 
 var debug = false
@@ -505,10 +693,7 @@ func main() {
 	flag.Parse()
 	debug = *debugFlag
 
-	apiKey = os.Getenv("RTE_API_KEY")
-	if debug {
-		Debug.Printf("Using API key: %s", apiKey)
-	}
+	apiKeys.adminKey = os.Getenv("RTE_API_KEY")
 
 	absBaseDir, err := filepath.Abs(*baseDirFlag)
 	if err != nil {
@@ -526,6 +711,11 @@ func main() {
 		testdataDir = filepath.Join(absBaseDir, *testdata_folder)
 	}
 	println("Setting testdataDir to ", testdataDir)
+	catalog.dir = testdataDir
+
+	if flag.Arg(0) == "validate" {
+		os.Exit(runValidate(flag.Args()[1:]))
+	}
 
 	if *testSolutionFlag {
 		err := testSolutions()
@@ -535,23 +725,73 @@ func main() {
 		return
 	}
 
+	if *ltiDevPlatformFlag != "" {
+		err := runLtiDevPlatform(*ltiDevPlatformFlag, filepath.Join(absBaseDir, "lti-dev"))
+		if err != nil {
+			panic(err)
+		}
+		return
+	}
+
 	Info.Printf("Remote Test Executor starting up...\n")
 
-	// start 10 compile services
-	for i := 0; i < 10; i++ {
-		go compileService()
+	sandbox, err = newSandbox(*sandboxFlag)
+	if err != nil {
+		panic(err)
 	}
-	// start 15 testing services
-	for i := 0; i < 10; i++ {
-		go testService()
+	if *securityProfileFile != "" {
+		if err := loadSecurityProfile(*securityProfileFile); err != nil {
+			panic(err)
+		}
 	}
-	// start 15 analysis services
-	for i := 0; i < 10; i++ {
-		go analysisService()
+
+	if *keysFile != "" {
+		keys, err := loadApiKeys(*keysFile)
+		if err != nil {
+			panic(err)
+		}
+		apiKeys.setKeys(keys)
+		go reloadApiKeysOnSignal(*keysFile)
+	}
+	if *ltiFile != "" {
+		ltiConfig, err = loadLtiConfig(*ltiFile)
+		if err != nil {
+			panic(err)
+		}
 	}
-	//start 10 metric services
-	for i := 0; i < 10; i++ {
-		go metricService()
+	if *limitsFile != "" {
+		limits, err := loadLimitsConfig(*limitsFile)
+		if err != nil {
+			panic(err)
+		}
+		rateLimits = newRateLimiter(limits)
+		go rateLimitCleanupService()
+	}
+
+	if err := catalog.load(); err != nil {
+		panic(err)
+	}
+	if *watchTests {
+		if err := catalog.watch(time.Second); err != nil {
+			LogError("startup", "Could not watch the tests, changes are only noticed after a restart: %s", err)
+		}
+	}
+
+	compileQueue.maxLen = *queueSize
+	startWorkers(*compileWorkers, compileService)
+	startWorkers(*testWorkers, testService)
+	startWorkers(*analysisWorkers, analysisService)
+	startWorkers(*metricWorkers, metricService)
+
+	runStore, err = openRunStore(*storeFlag, *storePath)
+	if err != nil {
+		panic(err)
+	}
+	if err := recoverRuns(*requeueInterrupted); err != nil {
+		LogError("startup", "Could not recover interrupted runs: %s", err)
+	}
+	if runStore != nil && *storeRetention > 0 {
+		go storeRetentionService(time.Duration(*storeRetention) * 24 * time.Hour)
 	}
 
 	if debug {
@@ -560,9 +800,35 @@ func main() {
 	http.HandleFunc(*contextPath+"/test", handleTest)
 
 	if debug {
-		Debug.Println("Registering /listtests hook")
+		Debug.Println("Registering /listtests and /tests hooks")
 	}
 	http.HandleFunc(*contextPath+"/listtests", handleListTests)
+	http.HandleFunc(*contextPath+"/tests/", handleTestInfo)
+
+	if debug {
+		Debug.Println("Registering /submissions hooks")
+	}
+	http.HandleFunc(*contextPath+"/submissions", handleSubmissions)
+	http.HandleFunc(*contextPath+"/submissions/", handleSubmission)
+	go submissionCleanupService(time.Duration(*submissionRetention) * time.Minute)
+
+	if debug {
+		Debug.Println("Registering /results hooks")
+	}
+	http.HandleFunc(*contextPath+"/results", handleResults)
+	http.HandleFunc(*contextPath+"/results/", handleResults)
+
+	if debug {
+		Debug.Println("Registering /v2 hooks")
+	}
+	http.HandleFunc(*contextPath+apiVersionPrefix+"/tests", handleV2Tests)
+	http.HandleFunc(*contextPath+apiVersionPrefix+"/tests/", handleTestInfo)
+	http.HandleFunc(*contextPath+apiVersionPrefix+"/submissions", handleV2Submissions)
+	http.HandleFunc(*contextPath+apiVersionPrefix+"/submissions/", handleSubmission)
+	http.HandleFunc(*contextPath+apiVersionPrefix+"/results", handleResults)
+	http.HandleFunc(*contextPath+apiVersionPrefix+"/results/", handleResults)
+	http.HandleFunc(*contextPath+apiVersionPrefix+"/openapi.json", handleOpenApi)
+	http.HandleFunc(*contextPath+apiVersionPrefix+"/admin/tests", handleAdminTests)
 
 	Info.Println("done")
 
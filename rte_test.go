@@ -0,0 +1,150 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+// pythonIOTest returns the files of a Python IO test with the submitted file main.py, to add them to a catalog
+func pythonIOTest(ref string) map[string]string {
+	return map[string]string{
+		ref + "/config.json": `{"Compiler":"PythonCompiler","TestType":"IOTest","MainIs":"main.py","AllowedFiles":["main.py"]}`,
+		ref + "/1.in.txt":    "hello\n",
+		ref + "/1.out.txt":   "hello\n",
+	}
+}
+
+// useCatalog creates the files (paths relative to the testdata folder) in a temporary testdata folder
+// and replaces the catalog, the folder of the tests and the folder of the runs for the duration of the test
+func useCatalog(t *testing.T, files ...map[string]string) {
+	dir := t.TempDir()
+	for _, f := range files {
+		for name, content := range f {
+			path := filepath.Join(dir, filepath.FromSlash(name))
+			if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := ioutil.WriteFile(path, []byte(content), 0644); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	previous, previousRuns := catalog, testrunDir
+	catalog = &testCatalog{dir: dir, tests: make(map[string]*catalogTest)}
+	if err := catalog.load(); err != nil {
+		t.Fatal(err)
+	}
+	testrunDir = t.TempDir()
+	useTestdata(t, dir)
+	t.Cleanup(func() { catalog, testrunDir = previous, previousRuns })
+}
+
+// submission creates a request submitting main.py to the test
+func submission(test string) SubmissionRequest {
+	return SubmissionRequest{Test: test, Files: []SubmittedFile{{Name: "main.py", Content: "print(input())\n"}}}
+}
+
+func TestMain(m *testing.M) {
+	InitLoggers(ioutil.Discard, ioutil.Discard)
+	os.Exit(m.Run())
+}
+
+func TestFormatRequestRedactsCredentials(t *testing.T) {
+	r := httptest.NewRequest("POST", "/test", strings.NewReader("test=py/io"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	r.Header.Set("ApiKey", "secret-key")
+	r.Header.Set("Authorization", "Bearer secret-token")
+	r.Header.Set("Cookie", "session=secret-cookie")
+	r.Header.Set("X-Rte-User", "student-1")
+
+	formatted := formatRequest(r)
+	for _, secret := range []string{"secret-key", "secret-token", "secret-cookie"} {
+		if strings.Contains(formatted, secret) {
+			t.Errorf("%s is not redacted:\n%s", secret, formatted)
+		}
+	}
+	for _, shown := range []string{"apikey: [redacted]", "x-rte-user: student-1", "test=py%2Fio"} {
+		if !strings.Contains(formatted, shown) {
+			t.Errorf("%s is missing:\n%s", shown, formatted)
+		}
+	}
+}
+
+func TestLegacyUploadErrors(t *testing.T) {
+	required := pythonIOTest("course/required")
+	required["course/required/config.json"] = `{"Compiler":"PythonCompiler","TestType":"IOTest","MainIs":"main.py","RequiredFiles":["main.py"]}`
+	useCatalog(t, pythonIOTest("course/io"), required)
+
+	cases := []struct {
+		name    string
+		path    string
+		test    string
+		file    string
+		status  int
+		missing string
+		illegal string
+		code    ApiErrorCode
+	}{
+		{"illegal", "/test", "course/io", "other.py", http.StatusOK, "", "other.py (does not match AllowedFiles)", ""},
+		{"traversal", "/test", "course/io", "../main.py", http.StatusOK, "", "../main.py (path outside of the upload folder)", ""},
+		{"missing", "/test", "course/required", "other.py", http.StatusOK, "main.py", "", ""},
+		{"submissions", "/submissions", "course/io", "other.py", http.StatusOK, "", "other.py (does not match AllowedFiles)", ""},
+		{"v2 illegal", "/v2/submissions", "course/io", "other.py", http.StatusUnprocessableEntity, "", "", ErrIllegalFiles},
+		{"v2 missing", "/v2/submissions", "course/required", "other.py", http.StatusUnprocessableEntity, "", "", ErrMissingFiles},
+	}
+	for _, c := range cases {
+		w := httptest.NewRecorder()
+		request := SubmissionRequest{Test: c.test, Files: []SubmittedFile{{Name: c.file, Content: "print(1)\n"}}}
+		if _, ok := prepareExecution(w, httptest.NewRequest("POST", c.path, nil), Caller{Admin: true}, request); ok {
+			t.Fatalf("%s: upload accepted", c.name)
+		}
+		if w.Code != c.status {
+			t.Errorf("%s: status %d, want %d: %s", c.name, w.Code, c.status, w.Body.String())
+			continue
+		}
+		if c.code != "" {
+			var response ErrorResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &response); err != nil || response.Error.Code != c.code {
+				t.Errorf("%s: error %s, want %s", c.name, w.Body.String(), c.code)
+			}
+			continue
+		}
+		var result RteResult
+		if err := json.Unmarshal(w.Body.Bytes(), &result); err != nil {
+			t.Fatal(err)
+		}
+		missing, illegal := strings.Join(result.TestResult.MissingFiles, ", "), strings.Join(result.TestResult.IllegalFiles, ", ")
+		if missing != c.missing || illegal != c.illegal || result.TestResult.Compiled {
+			t.Errorf("%s: missing %q and illegal %q, want %q and %q", c.name, missing, illegal, c.missing, c.illegal)
+		}
+	}
+}
+
+func TestListTests(t *testing.T) {
+	useCatalog(t, pythonIOTest("course/io"), pythonIOTest("other/io"))
+	cases := []struct {
+		caller Caller
+		want   string
+	}{
+		{Caller{Admin: true}, `{"Success":true,"Tests":["course/io","other/io"]}`},
+		{Caller{Name: "student", Scopes: []string{"course"}}, `{"Success":true,"Tests":["course/io"]}`},
+		// the older clients expect a list, even if it is empty
+		{Caller{Name: "guest", Scopes: []string{"none"}}, `{"Success":true,"Tests":[]}`},
+	}
+	for _, c := range cases {
+		tests, err := listTests(c.caller)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, _ := json.Marshal(ListResult{Success: true, Tests: tests})
+		if string(got) != c.want {
+			t.Errorf("%s: %s, want %s", c.caller.Name, got, c.want)
+		}
+	}
+}
@@ -0,0 +1,155 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"time"
+)
+
+// Mount makes a file or folder of the host available inside the sandbox
+type Mount struct {
+	Source   string // absolute path on the host
+	Target   string // absolute path inside the sandbox
+	ReadOnly bool
+}
+
+// SandboxCommand describes a command that is executed in a sandbox
+type SandboxCommand struct {
+	Name        string // unique name of the run (used as container name)
+	Image       string
+	Command     []string
+	WorkDir     string
+	Mounts      []Mount
+	Env         []string // environment variables in the form KEY=value
+	Stdin       io.Reader
+	Stdout      io.Writer
+	Stderr      io.Writer
+	StdoutLimit int64            // maximum number of bytes written to Stdout, 0 means unlimited
+	StderrLimit int64            // maximum number of bytes written to Stderr, 0 means unlimited
+	MaxMem      int              // memory limit in MB, 0 means unlimited
+	Timeout     time.Duration    // 0 means no timeout
+	Security    *SecurityProfile // nil means the default security profile
+}
+
+// SandboxResult describes how a command in a sandbox terminated
+type SandboxResult struct {
+	ExitCode  int
+	TimedOut  bool
+	OOMKilled bool // only reported by sandboxes which can inspect the container after it stopped
+}
+
+// Sandbox executes commands isolated from the host system.
+// An error is only returned if the command could not be executed, a non-zero exit code is reported in the result.
+type Sandbox interface {
+	Run(cmd SandboxCommand) (SandboxResult, error)
+}
+
+// SandboxSession is a container which is started once and executes several commands,
+// e.g. all cases of an IO test, so that the start-up of a container is only needed once.
+type SandboxSession interface {
+	// Exec executes the command in the container. Image, Mounts, MaxMem and Security of the command are
+	// the ones of the session, the other fields are used like by Sandbox.Run.
+	// The commands share the file system, including /tmp, and can see the processes of each other.
+	// If the command does not stop, the container is stopped and a SessionStoppedError is returned.
+	Exec(cmd SandboxCommand) (SandboxResult, error)
+	// Close stops and removes the container
+	Close() error
+}
+
+// SessionSandbox is a sandbox which can execute several commands in the same container
+type SessionSandbox interface {
+	Sandbox
+	// StartSession starts a container with the image, mounts and limits of the command, the command itself is not executed
+	StartSession(cmd SandboxCommand) (SandboxSession, error)
+}
+
+// sessionKeepAlive is the command of the container of a session, which waits for commands executed with exec
+var sessionKeepAlive = []string{"tail", "-f", "/dev/null"}
+
+// sessionKillAfter is the time the timeout command waits after the TERM signal, before it kills the command
+const sessionKillAfter = time.Second
+
+// sessionCommand limits the time of a command executed in a session with the timeout command of the image.
+// In contrast to a container, a process started by exec does not stop when the client is killed.
+func sessionCommand(cmd SandboxCommand) []string {
+	if cmd.Timeout <= 0 {
+		return cmd.Command
+	}
+	seconds := strconv.FormatFloat(cmd.Timeout.Seconds(), 'f', -1, 64)
+	killAfter := strconv.FormatFloat(sessionKillAfter.Seconds(), 'f', -1, 64)
+	return append([]string{"timeout", "-k", killAfter, seconds}, cmd.Command...)
+}
+
+// sessionResult creates the result of a command executed with sessionCommand.
+// timeout exits with 124, or 137 if the command had to be killed after sessionKillAfter.
+// A command killed by the kernel, because the container ran out of memory, also exits with 137,
+// oomKilled tells if the sandbox noticed this.
+func sessionResult(cmd SandboxCommand, exitCode int, duration time.Duration, oomKilled bool) SandboxResult {
+	if cmd.Timeout > 0 && ((exitCode == 124 && duration >= cmd.Timeout) || (exitCode == 137 && duration >= cmd.Timeout+sessionKillAfter)) {
+		return SandboxResult{ExitCode: -1, TimedOut: true}
+	}
+	if exitCode == 137 && oomKilled {
+		return SandboxResult{ExitCode: exitCode, OOMKilled: true}
+	}
+	return SandboxResult{ExitCode: exitCode}
+}
+
+// SessionStoppedError is returned by SandboxSession.Exec with a timed out result, if the command did not stop
+// after its timeout and the container of the session had to be stopped. The session cannot execute further commands.
+type SessionStoppedError struct {
+	Command string
+}
+
+func (e SessionStoppedError) Error() string {
+	return fmt.Sprintf("Command %s did not stop, the container of the session was stopped", e.Command)
+}
+
+// sessionGracePeriod is the time the client waits for a command after its timeout, before the session is given up
+const sessionGracePeriod = 5 * time.Second
+
+var sandbox Sandbox = ContainerCliSandbox{Binary: "docker"}
+
+// newSandbox creates the sandbox with the given name
+func newSandbox(name string) (Sandbox, error) {
+	switch name {
+	case "docker":
+		s := newDockerApiSandbox(*dockerSocket, testrunDir)
+		if err := s.removeStaleContainers(); err != nil {
+			return nil, fmt.Errorf("Could not connect to Docker Engine: %s", err)
+		}
+		return s, nil
+	case "docker-cli":
+		return ContainerCliSandbox{Binary: "docker"}, nil
+	case "podman":
+		return newPodmanSandbox(), nil
+	case "local":
+		return LocalSandbox{
+			Entrypoints: map[string][]string{
+				*docker_image_cloc:       {"cloc"},
+				*docker_image_checkstyle: {"checkstyle"},
+				*docker_image_pmd:        {"run.sh"},
+			},
+		}, nil
+	default:
+		return nil, fmt.Errorf("Unknown sandbox: %s", name)
+	}
+}
+
+// codeMount mounts the run directory into the /code folder of the sandbox
+func codeMount(runDir string) (Mount, error) {
+	absExecPath, err := filepath.Abs(runDir)
+	if err != nil {
+		return Mount{}, fmt.Errorf("Internal Error: Could not create absolute path of test folder")
+	}
+	return Mount{Source: absExecPath, Target: "/code"}, nil
+}
+
+// limitedOutput limits the number of bytes written to the given writer
+func limitedOutput(w io.Writer, limit int64) io.Writer {
+	if w == nil || limit <= 0 {
+		return w
+	}
+	return LimitWriter(w, limit)
+}
@@ -0,0 +1,221 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os/exec"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ContainerCliSandbox runs commands in containers using a docker compatible command line client
+type ContainerCliSandbox struct {
+	Binary    string
+	ExtraArgs []string // additional arguments for the run command
+}
+
+func (s ContainerCliSandbox) arguments(cmd SandboxCommand) []string {
+	arguments := make([]string, 0)
+	arguments = append(arguments, s.Binary, "run", "--name", cmd.Name, "--rm")
+	arguments = append(arguments, s.ExtraArgs...)
+	if cmd.Stdin != nil {
+		arguments = append(arguments, "-i")
+	}
+	for _, m := range cmd.Mounts {
+		volume := m.Source + ":" + m.Target
+		if m.ReadOnly {
+			volume += ":ro"
+		}
+		arguments = append(arguments, "-v", volume)
+	}
+	if cmd.WorkDir != "" {
+		arguments = append(arguments, "--workdir", cmd.WorkDir)
+	}
+	for _, e := range cmd.Env {
+		arguments = append(arguments, "-e", e)
+	}
+	if cmd.MaxMem > 0 {
+		arguments = append(arguments, "-m", fmt.Sprintf("%dM", cmd.MaxMem))
+	}
+	arguments = append(arguments, securityArguments(securityProfileOf(cmd))...)
+	arguments = append(arguments, cmd.Image)
+	arguments = append(arguments, cmd.Command...)
+	return arguments
+}
+
+// securityArguments converts a security profile into arguments for the run command
+func securityArguments(profile SecurityProfile) []string {
+	arguments := make([]string, 0)
+	if !isSet(profile.Network) {
+		arguments = append(arguments, "--network", "none")
+	}
+	if profile.User != "" {
+		arguments = append(arguments, "--user", profile.User)
+	}
+	if isSet(profile.ReadOnly) {
+		arguments = append(arguments, "--read-only")
+	}
+	for _, tmpfs := range profile.Tmpfs {
+		arguments = append(arguments, "--tmpfs", tmpfs)
+	}
+	if profile.PidsLimit > 0 {
+		arguments = append(arguments, "--pids-limit", strconv.Itoa(profile.PidsLimit))
+	}
+	if profile.Cpus > 0 {
+		arguments = append(arguments, "--cpus", strconv.FormatFloat(profile.Cpus, 'f', -1, 64))
+	}
+	if isSet(profile.DropCapabilities) {
+		arguments = append(arguments, "--cap-drop", "ALL")
+	}
+	if isSet(profile.NoNewPrivileges) {
+		arguments = append(arguments, "--security-opt", "no-new-privileges")
+	}
+	if profile.SeccompProfile != "" {
+		arguments = append(arguments, "--security-opt", "seccomp="+profile.SeccompProfile)
+	}
+	return arguments
+}
+
+func (s ContainerCliSandbox) Run(cmd SandboxCommand) (SandboxResult, error) {
+	ctx := context.Background()
+	if cmd.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cmd.Timeout)
+		defer cancel()
+	}
+	defer func() {
+		// killing the client does not stop the container
+		if ctx.Err() != nil {
+			err := exec.Command(s.Binary, "stop", cmd.Name).Run()
+			if err != nil {
+				println("Could not stop", cmd.Name, err.Error())
+			}
+		}
+	}()
+
+	arguments := s.arguments(cmd)
+	if debug {
+		Debug.Printf("args = %v\n", arguments)
+	}
+	c := exec.CommandContext(ctx, s.Binary)
+	c.Args = arguments
+	c.Stdin = cmd.Stdin
+	c.Stdout = limitedOutput(cmd.Stdout, cmd.StdoutLimit)
+	c.Stderr = limitedOutput(cmd.Stderr, cmd.StderrLimit)
+
+	startTime := time.Now()
+	err := c.Run()
+	if debug {
+		Debug.Printf("Duration of %s: %s", cmd.Name, time.Since(startTime))
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		return SandboxResult{ExitCode: -1, TimedOut: true}, nil
+	}
+	if err != nil {
+		if exiterr, ok := err.(*exec.ExitError); ok {
+			if status, ok := exiterr.Sys().(syscall.WaitStatus); ok {
+				return SandboxResult{ExitCode: status.ExitStatus()}, nil
+			}
+		}
+		return SandboxResult{}, err
+	}
+	return SandboxResult{}, nil
+}
+
+// cliSession is a container started by the command line client, whose commands are executed with exec
+type cliSession struct {
+	sandbox ContainerCliSandbox
+	name    string
+}
+
+// StartSession starts a detached container, which is removed when the session is closed
+func (s ContainerCliSandbox) StartSession(cmd SandboxCommand) (SandboxSession, error) {
+	cmd.Stdin = nil
+	cmd.Command = sessionKeepAlive
+	arguments := s.arguments(cmd)
+	// arguments start with the binary and the run command
+	arguments = append(arguments[:2], append([]string{"--detach"}, arguments[2:]...)...)
+	if debug {
+		Debug.Printf("args = %v\n", arguments)
+	}
+	c := exec.Command(s.Binary)
+	c.Args = arguments
+	if output, err := c.CombinedOutput(); err != nil {
+		return nil, fmt.Errorf("%s: %s", err, output)
+	}
+	return cliSession{sandbox: s, name: cmd.Name}, nil
+}
+
+func (s cliSession) Exec(cmd SandboxCommand) (SandboxResult, error) {
+	arguments := []string{s.sandbox.Binary, "exec"}
+	if cmd.Stdin != nil {
+		arguments = append(arguments, "-i")
+	}
+	if cmd.WorkDir != "" {
+		arguments = append(arguments, "--workdir", cmd.WorkDir)
+	}
+	for _, e := range cmd.Env {
+		arguments = append(arguments, "-e", e)
+	}
+	arguments = append(arguments, s.name)
+	arguments = append(arguments, sessionCommand(cmd)...)
+	if debug {
+		Debug.Printf("args = %v\n", arguments)
+	}
+
+	ctx := context.Background()
+	if cmd.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cmd.Timeout+sessionGracePeriod)
+		defer cancel()
+	}
+	c := exec.CommandContext(ctx, s.sandbox.Binary)
+	c.Args = arguments
+	c.Stdin = cmd.Stdin
+	c.Stdout = limitedOutput(cmd.Stdout, cmd.StdoutLimit)
+	c.Stderr = limitedOutput(cmd.Stderr, cmd.StderrLimit)
+
+	startTime := time.Now()
+	err := c.Run()
+	duration := time.Since(startTime)
+	if debug {
+		Debug.Printf("Duration of %s in %s: %s", cmd.Name, s.name, duration)
+	}
+	if ctx.Err() == context.DeadlineExceeded {
+		// the timeout command did not stop the process, the container is stopped to end it
+		LogError("test", "Command %s did not stop in container %s, stopping the container", cmd.Name, s.name)
+		if err := exec.Command(s.sandbox.Binary, "kill", s.name).Run(); err != nil {
+			LogError("test", "Could not kill container %s: %s", s.name, err)
+		}
+		return SandboxResult{ExitCode: -1, TimedOut: true}, SessionStoppedError{Command: cmd.Name}
+	}
+	if err != nil {
+		if exiterr, ok := err.(*exec.ExitError); ok {
+			if status, ok := exiterr.Sys().(syscall.WaitStatus); ok {
+				exitCode := status.ExitStatus()
+				return sessionResult(cmd, exitCode, duration, exitCode == 137 && s.oomKilled()), nil
+			}
+		}
+		return SandboxResult{}, err
+	}
+	return SandboxResult{}, nil
+}
+
+// oomKilled tells if a process of the container was killed, because it ran out of memory
+func (s cliSession) oomKilled() bool {
+	output, err := exec.Command(s.sandbox.Binary, "inspect", "--format", "{{.State.OOMKilled}}", s.name).Output()
+	if err != nil {
+		LogError("test", "Could not inspect container %s: %s", s.name, err)
+		return false
+	}
+	return strings.TrimSpace(string(output)) == "true"
+}
+
+func (s cliSession) Close() error {
+	if output, err := exec.Command(s.sandbox.Binary, "rm", "--force", s.name).CombinedOutput(); err != nil {
+		return fmt.Errorf("%s: %s", err, output)
+	}
+	return nil
+}
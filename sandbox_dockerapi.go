@@ -0,0 +1,333 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"strings"
+	"time"
+)
+
+// label used to find the containers of this RTE instance, e.g. after a crash
+const dockerInstanceLabel = "rte-go.instance"
+
+// DockerApiSandbox runs commands in Docker containers using the Docker Engine API.
+// In contrast to the command line client, containers are removed even if the execution fails
+// and the exit code and OOM status of the container are available.
+type DockerApiSandbox struct {
+	client *dockerClient
+	// Instance identifies the containers created by this RTE instance
+	Instance string
+}
+
+func newDockerApiSandbox(socket string, instance string) DockerApiSandbox {
+	return DockerApiSandbox{client: newDockerClient(socket), Instance: instance}
+}
+
+// removeStaleContainers removes containers left behind by a previous run of this RTE instance
+func (s DockerApiSandbox) removeStaleContainers() error {
+	ctx, cancel := context.WithTimeout(context.Background(), time.Minute)
+	defer cancel()
+	ids, err := s.client.listContainers(ctx, dockerInstanceLabel, s.Instance)
+	if err != nil {
+		return err
+	}
+	for _, id := range ids {
+		Info.Printf("Removing stale container %s\n", id)
+		if err := s.client.removeContainer(ctx, id); err != nil {
+			LogError("startup", "Could not remove stale container %s: %s", id, err)
+		}
+	}
+	return nil
+}
+
+func (s DockerApiSandbox) containerConfig(cmd SandboxCommand) (dockerContainerConfig, error) {
+	config := dockerContainerConfig{
+		Image:        cmd.Image,
+		Cmd:          cmd.Command,
+		WorkingDir:   cmd.WorkDir,
+		Env:          cmd.Env,
+		Labels:       map[string]string{dockerInstanceLabel: s.Instance},
+		AttachStdin:  cmd.Stdin != nil,
+		AttachStdout: true,
+		AttachStderr: true,
+		OpenStdin:    cmd.Stdin != nil,
+		StdinOnce:    cmd.Stdin != nil,
+	}
+	for _, m := range cmd.Mounts {
+		bind := m.Source + ":" + m.Target
+		if m.ReadOnly {
+			bind += ":ro"
+		}
+		config.HostConfig.Binds = append(config.HostConfig.Binds, bind)
+	}
+	if cmd.MaxMem > 0 {
+		config.HostConfig.Memory = int64(cmd.MaxMem) * 1024 * 1024
+	}
+
+	profile := securityProfileOf(cmd)
+	if !isSet(profile.Network) {
+		config.HostConfig.NetworkMode = "none"
+	}
+	config.User = profile.User
+	config.HostConfig.ReadonlyRootfs = isSet(profile.ReadOnly)
+	for _, tmpfs := range profile.Tmpfs {
+		if config.HostConfig.Tmpfs == nil {
+			config.HostConfig.Tmpfs = make(map[string]string)
+		}
+		// same format as the --tmpfs option of the command line client
+		parts := strings.SplitN(tmpfs, ":", 2)
+		if len(parts) == 2 {
+			config.HostConfig.Tmpfs[parts[0]] = parts[1]
+		} else {
+			config.HostConfig.Tmpfs[parts[0]] = ""
+		}
+	}
+	config.HostConfig.PidsLimit = int64(profile.PidsLimit)
+	config.HostConfig.NanoCpus = int64(profile.Cpus * 1e9)
+	if isSet(profile.DropCapabilities) {
+		config.HostConfig.CapDrop = []string{"ALL"}
+	}
+	if isSet(profile.NoNewPrivileges) {
+		config.HostConfig.SecurityOpt = append(config.HostConfig.SecurityOpt, "no-new-privileges")
+	}
+	if profile.SeccompProfile != "" {
+		// the API expects the content of the profile instead of its path
+		seccomp, err := ioutil.ReadFile(profile.SeccompProfile)
+		if err != nil {
+			return config, fmt.Errorf("Could not read seccomp profile: %s", err)
+		}
+		config.HostConfig.SecurityOpt = append(config.HostConfig.SecurityOpt, "seccomp="+string(seccomp))
+	}
+	return config, nil
+}
+
+// createContainer creates a container, replacing a container with the same name left from an earlier execution
+func (s DockerApiSandbox) createContainer(ctx context.Context, name string, config dockerContainerConfig) (string, error) {
+	id, err := s.client.createContainer(ctx, name, config)
+	if apiErr, ok := err.(*dockerApiError); ok && apiErr.StatusCode == 409 {
+		if err := s.client.removeContainer(ctx, name); err != nil {
+			return "", fmt.Errorf("Could not remove old container %s: %s", name, err)
+		}
+		id, err = s.client.createContainer(ctx, name, config)
+	}
+	if err != nil {
+		return "", fmt.Errorf("Could not create container: %s", err)
+	}
+	return id, nil
+}
+
+func (s DockerApiSandbox) Run(cmd SandboxCommand) (SandboxResult, error) {
+	// requests for managing the container must not be canceled by the timeout of the command
+	ctx := context.Background()
+
+	config, err := s.containerConfig(cmd)
+	if err != nil {
+		return SandboxResult{}, err
+	}
+	id, err := s.createContainer(ctx, cmd.Name, config)
+	if err != nil {
+		return SandboxResult{}, err
+	}
+	defer func() {
+		if err := s.client.removeContainer(ctx, id); err != nil {
+			LogError("test", "Could not remove container %s: %s", id, err)
+		}
+	}()
+
+	conn, output, err := s.client.attachContainer(ctx, id, cmd.Stdin != nil)
+	if err != nil {
+		return SandboxResult{}, fmt.Errorf("Could not attach to container: %s", err)
+	}
+	defer conn.Close()
+
+	stdout := limitedOutput(cmd.Stdout, cmd.StdoutLimit)
+	if stdout == nil {
+		stdout = ioutil.Discard
+	}
+	stderr := limitedOutput(cmd.Stderr, cmd.StderrLimit)
+	if stderr == nil {
+		stderr = ioutil.Discard
+	}
+	outputDone := make(chan error, 1)
+	go func() {
+		outputDone <- demultiplexOutput(output, stdout, stderr)
+	}()
+
+	if err := s.client.startContainer(ctx, id); err != nil {
+		return SandboxResult{}, fmt.Errorf("Could not start container: %s", err)
+	}
+
+	if cmd.Stdin != nil {
+		go func() {
+			io.Copy(conn, cmd.Stdin)
+			if c, ok := conn.(interface{ CloseWrite() error }); ok {
+				c.CloseWrite()
+			}
+		}()
+	}
+
+	waitCtx := ctx
+	if cmd.Timeout > 0 {
+		var cancel context.CancelFunc
+		waitCtx, cancel = context.WithTimeout(ctx, cmd.Timeout)
+		defer cancel()
+	}
+	res := SandboxResult{}
+	res.ExitCode, err = s.client.waitContainer(waitCtx, id)
+	if waitCtx.Err() == context.DeadlineExceeded {
+		res.TimedOut = true
+		if err := s.client.killContainer(ctx, id); err != nil {
+			LogError("test", "Could not kill container %s: %s", id, err)
+		}
+		res.ExitCode, err = s.client.waitContainer(ctx, id)
+	}
+	if err != nil {
+		return SandboxResult{}, fmt.Errorf("Could not wait for container: %s", err)
+	}
+
+	// the output stream ends when the container stopped
+	select {
+	case err := <-outputDone:
+		if err != nil && !isClosedConnError(err) {
+			LogError("test", "Could not read output of container %s: %s", id, err)
+		}
+	case <-time.After(5 * time.Second):
+		LogError("test", "Output of container %s did not end", id)
+	}
+
+	state, err := s.client.inspectContainer(ctx, id)
+	if err != nil {
+		return SandboxResult{}, fmt.Errorf("Could not inspect container: %s", err)
+	}
+	res.OOMKilled = state.OOMKilled
+	return res, nil
+}
+
+func isClosedConnError(err error) bool {
+	if opErr, ok := err.(*net.OpError); ok {
+		return opErr.Err.Error() == "use of closed network connection"
+	}
+	return false
+}
+
+// apiSession is a running container, whose commands are executed with the exec API
+type apiSession struct {
+	sandbox DockerApiSandbox
+	id      string
+	name    string
+}
+
+// StartSession creates and starts a container, which is removed when the session is closed
+func (s DockerApiSandbox) StartSession(cmd SandboxCommand) (SandboxSession, error) {
+	ctx := context.Background()
+	cmd.Stdin = nil
+	cmd.Command = sessionKeepAlive
+	config, err := s.containerConfig(cmd)
+	if err != nil {
+		return nil, err
+	}
+	config.AttachStdout = false
+	config.AttachStderr = false
+	id, err := s.createContainer(ctx, cmd.Name, config)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.client.startContainer(ctx, id); err != nil {
+		s.client.removeContainer(ctx, id)
+		return nil, fmt.Errorf("Could not start container: %s", err)
+	}
+	return apiSession{sandbox: s, id: id, name: cmd.Name}, nil
+}
+
+func (s apiSession) Exec(cmd SandboxCommand) (SandboxResult, error) {
+	ctx := context.Background()
+	client := s.sandbox.client
+	execId, err := client.createExec(ctx, s.id, dockerExecConfig{
+		AttachStdin:  cmd.Stdin != nil,
+		AttachStdout: true,
+		AttachStderr: true,
+		Cmd:          sessionCommand(cmd),
+		Env:          cmd.Env,
+		WorkingDir:   cmd.WorkDir,
+	})
+	if err != nil {
+		return SandboxResult{}, fmt.Errorf("Could not create command in container %s: %s", s.name, err)
+	}
+	conn, output, err := client.startExec(ctx, execId)
+	if err != nil {
+		return SandboxResult{}, fmt.Errorf("Could not start command in container %s: %s", s.name, err)
+	}
+	defer conn.Close()
+	startTime := time.Now()
+
+	stdout := limitedOutput(cmd.Stdout, cmd.StdoutLimit)
+	if stdout == nil {
+		stdout = ioutil.Discard
+	}
+	stderr := limitedOutput(cmd.Stderr, cmd.StderrLimit)
+	if stderr == nil {
+		stderr = ioutil.Discard
+	}
+	if cmd.Stdin != nil {
+		go func() {
+			io.Copy(conn, cmd.Stdin)
+			if c, ok := conn.(interface{ CloseWrite() error }); ok {
+				c.CloseWrite()
+			}
+		}()
+	}
+
+	// the output stream ends when the command stopped
+	outputDone := make(chan error, 1)
+	go func() {
+		outputDone <- demultiplexOutput(output, stdout, stderr)
+	}()
+	var deadline <-chan time.Time
+	if cmd.Timeout > 0 {
+		deadline = time.After(cmd.Timeout + sessionGracePeriod)
+	}
+	select {
+	case err := <-outputDone:
+		if err != nil && !isClosedConnError(err) {
+			LogError("test", "Could not read output of %s in container %s: %s", cmd.Name, s.name, err)
+		}
+	case <-deadline:
+		// the timeout command did not stop the process, the container is stopped to end it
+		LogError("test", "Command %s did not stop in container %s, stopping the container", cmd.Name, s.name)
+		if err := client.killContainer(ctx, s.id); err != nil {
+			LogError("test", "Could not kill container %s: %s", s.name, err)
+		}
+		return SandboxResult{ExitCode: -1, TimedOut: true}, SessionStoppedError{Command: cmd.Name}
+	}
+	duration := time.Since(startTime)
+
+	// the exit code is set shortly after the output ended
+	var state dockerExecState
+	for i := 0; i < 20; i++ {
+		state, err = client.inspectExec(ctx, execId)
+		if err != nil {
+			return SandboxResult{}, fmt.Errorf("Could not inspect command in container %s: %s", s.name, err)
+		}
+		if !state.Running {
+			break
+		}
+		time.Sleep(50 * time.Millisecond)
+	}
+	oomKilled := false
+	if state.ExitCode == 137 {
+		// the container state tells if a process of the container was killed, because it ran out of memory
+		containerState, err := client.inspectContainer(ctx, s.id)
+		if err != nil {
+			return SandboxResult{}, fmt.Errorf("Could not inspect container %s: %s", s.name, err)
+		}
+		oomKilled = containerState.OOMKilled
+	}
+	return sessionResult(cmd, state.ExitCode, duration, oomKilled), nil
+}
+
+func (s apiSession) Close() error {
+	return s.sandbox.client.removeContainer(context.Background(), s.id)
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"io"
+	"sync"
+	"testing"
+)
+
+// fakeSandbox records the commands and answers them with run instead of starting containers
+type fakeSandbox struct {
+	sync.Mutex
+	commands []SandboxCommand
+	run      func(cmd SandboxCommand) (SandboxResult, error)
+}
+
+func (s *fakeSandbox) Run(cmd SandboxCommand) (SandboxResult, error) {
+	s.Lock()
+	s.commands = append(s.commands, cmd)
+	s.Unlock()
+	if s.run == nil {
+		return SandboxResult{}, nil
+	}
+	return s.run(cmd)
+}
+
+// useSandbox replaces the sandbox for the duration of the test
+func useSandbox(t *testing.T, s Sandbox) {
+	previous := sandbox
+	sandbox = s
+	t.Cleanup(func() { sandbox = previous })
+}
+
+// useTestdata replaces the folder of the tests for the duration of the test
+func useTestdata(t *testing.T, dir string) {
+	previous := testdataDir
+	testdataDir = dir
+	t.Cleanup(func() { testdataDir = previous })
+}
+
+// writeOutput writes the output of a fake command, like a container does, limited to the limit of the command
+func writeOutput(w io.Writer, limit int64, output string) {
+	if w == nil {
+		return
+	}
+	limitedOutput(w, limit).Write([]byte(output))
+}
+
+// fakeSessionSandbox starts fake sessions, whose commands are answered with exec
+type fakeSessionSandbox struct {
+	fakeSandbox
+	started []string // names of the started sessions
+	closed  []string // names of the closed sessions
+	exec    func(session string, cmd SandboxCommand) (SandboxResult, error)
+}
+
+func (s *fakeSessionSandbox) StartSession(cmd SandboxCommand) (SandboxSession, error) {
+	s.Lock()
+	defer s.Unlock()
+	s.started = append(s.started, cmd.Name)
+	return fakeSession{sandbox: s, name: cmd.Name}, nil
+}
+
+type fakeSession struct {
+	sandbox *fakeSessionSandbox
+	name    string
+}
+
+func (s fakeSession) Exec(cmd SandboxCommand) (SandboxResult, error) {
+	return s.sandbox.exec(s.name, cmd)
+}
+
+func (s fakeSession) Close() error {
+	s.sandbox.Lock()
+	defer s.sandbox.Unlock()
+	s.sandbox.closed = append(s.sandbox.closed, s.name)
+	return nil
+}
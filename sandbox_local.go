@@ -0,0 +1,103 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"os/exec"
+	"regexp"
+	"strings"
+	"syscall"
+)
+
+// LocalSandbox runs commands directly on the host without any isolation.
+// It is only meant for developing RTE on machines without a container runtime.
+// Paths of the mounts are replaced with the corresponding paths on the host and the image is ignored,
+// so the tools used by the tests have to be installed on the host.
+type LocalSandbox struct {
+	// Entrypoints replace the entrypoint of images, which do not start with the executed program
+	Entrypoints map[string][]string
+}
+
+// hostPath replaces all paths of mount targets in the argument with the path on the host
+func hostPath(arg string, mounts []Mount) string {
+	for _, m := range mounts {
+		target := regexp.MustCompile(`(^|[:=])` + regexp.QuoteMeta(m.Target) + `($|[/:])`)
+		arg = target.ReplaceAllString(arg, "${1}"+strings.ReplaceAll(m.Source, "$", "$$")+"${2}")
+	}
+	return arg
+}
+
+func (s LocalSandbox) Run(cmd SandboxCommand) (SandboxResult, error) {
+	if len(cmd.Command) == 0 {
+		return SandboxResult{}, fmt.Errorf("No command given for %s", cmd.Name)
+	}
+	ctx := context.Background()
+	if cmd.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, cmd.Timeout)
+		defer cancel()
+	}
+
+	arguments := make([]string, 0, len(cmd.Command))
+	arguments = append(arguments, s.Entrypoints[cmd.Image]...)
+	for _, arg := range cmd.Command {
+		arguments = append(arguments, hostPath(arg, cmd.Mounts))
+	}
+	if debug {
+		Debug.Printf("local args = %v\n", arguments)
+	}
+
+	c := exec.Command(arguments[0], arguments[1:]...)
+	c.Dir = hostPath(cmd.WorkDir, cmd.Mounts)
+	c.Env = append(os.Environ(), cmd.Env...)
+	c.Stdin = cmd.Stdin
+	c.Stdout = limitedOutput(cmd.Stdout, cmd.StdoutLimit)
+	c.Stderr = limitedOutput(cmd.Stderr, cmd.StderrLimit)
+	// use a separate process group, so that child processes can be killed on timeout
+	c.SysProcAttr = &syscall.SysProcAttr{Setpgid: true}
+
+	if err := c.Start(); err != nil {
+		return SandboxResult{}, err
+	}
+	done := make(chan struct{})
+	go func() {
+		select {
+		case <-ctx.Done():
+			syscall.Kill(-c.Process.Pid, syscall.SIGKILL)
+		case <-done:
+		}
+	}()
+	err := c.Wait()
+	close(done)
+
+	if ctx.Err() == context.DeadlineExceeded {
+		return SandboxResult{ExitCode: -1, TimedOut: true}, nil
+	}
+	if err != nil {
+		if exiterr, ok := err.(*exec.ExitError); ok {
+			if status, ok := exiterr.Sys().(syscall.WaitStatus); ok {
+				return SandboxResult{ExitCode: status.ExitStatus()}, nil
+			}
+		}
+		return SandboxResult{}, err
+	}
+	return SandboxResult{}, nil
+}
+
+// localSession executes the commands like Run, there is no container whose start-up could be saved
+type localSession struct {
+	sandbox LocalSandbox
+}
+
+func (s LocalSandbox) StartSession(cmd SandboxCommand) (SandboxSession, error) {
+	return localSession{sandbox: s}, nil
+}
+
+func (s localSession) Exec(cmd SandboxCommand) (SandboxResult, error) {
+	return s.sandbox.Run(cmd)
+}
+
+func (s localSession) Close() error {
+	return nil
+}
@@ -0,0 +1,10 @@
+package main
+
+// newPodmanSandbox runs commands in containers using podman.
+// The user namespace keeps the id of the user running RTE, so that files written to mounted folders belong to this user.
+func newPodmanSandbox() Sandbox {
+	return ContainerCliSandbox{
+		Binary:    "podman",
+		ExtraArgs: []string{"--userns=keep-id"},
+	}
+}
@@ -0,0 +1,50 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestSessionResult(t *testing.T) {
+	timeout := 2 * time.Second
+	cases := []struct {
+		name      string
+		exitCode  int
+		duration  time.Duration
+		oomKilled bool
+		want      SandboxResult
+	}{
+		{"success", 0, time.Second, false, SandboxResult{ExitCode: 0}},
+		{"terminated", 124, timeout, false, SandboxResult{ExitCode: -1, TimedOut: true}},
+		{"killed", 137, timeout + sessionKillAfter, false, SandboxResult{ExitCode: -1, TimedOut: true}},
+		// the program itself exits with 124
+		{"124 before the timeout", 124, time.Second, false, SandboxResult{ExitCode: 124}},
+		// the kernel killed the program before timeout killed it
+		{"out of memory", 137, time.Second, true, SandboxResult{ExitCode: 137, OOMKilled: true}},
+		{"out of memory after the timeout", 137, timeout + sessionKillAfter/2, true, SandboxResult{ExitCode: 137, OOMKilled: true}},
+		{"killed by a signal", 137, timeout + sessionKillAfter/2, false, SandboxResult{ExitCode: 137}},
+	}
+	for _, c := range cases {
+		if got := sessionResult(SandboxCommand{Timeout: timeout}, c.exitCode, c.duration, c.oomKilled); got != c.want {
+			t.Errorf("%s: %+v, want %+v", c.name, got, c.want)
+		}
+	}
+	if got := sessionResult(SandboxCommand{}, 124, time.Hour, false); got.TimedOut {
+		t.Errorf("timed out without a timeout")
+	}
+}
+
+func TestSessionCommand(t *testing.T) {
+	cmd := SandboxCommand{Command: []string{"python3", "main.py"}, Timeout: 1500 * time.Millisecond}
+	got := sessionCommand(cmd)
+	want := []string{"timeout", "-k", "1", "1.5", "python3", "main.py"}
+	if len(got) != len(want) {
+		t.Fatalf("%v, want %v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("%v, want %v", got, want)
+			break
+		}
+	}
+}
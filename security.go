@@ -0,0 +1,124 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+)
+
+// SecurityProfile restricts what programs running in the sandbox are allowed to do.
+// Unset fields of a profile in a test configuration are taken from the server-wide default profile.
+type SecurityProfile struct {
+	// Network allows access to the network
+	Network *bool `json:",omitempty"`
+	// User (uid:gid) executing the commands
+	User string `json:",omitempty"`
+	// ReadOnly mounts the root file system read-only (mounted folders and tmpfs mounts stay writable)
+	ReadOnly *bool `json:",omitempty"`
+	// Tmpfs lists writable in-memory file systems, e.g. "/tmp" or "/tmp:size=64m"
+	Tmpfs []string `json:",omitempty"`
+	// PidsLimit is the maximum number of processes
+	PidsLimit int `json:",omitempty"`
+	// Cpus is the number of CPUs available
+	Cpus float64 `json:",omitempty"`
+	// DropCapabilities drops all Linux capabilities
+	DropCapabilities *bool `json:",omitempty"`
+	// NoNewPrivileges prevents processes from gaining privileges, e.g. using setuid binaries
+	NoNewPrivileges *bool `json:",omitempty"`
+	// SeccompProfile is the path of a seccomp profile (JSON) on the host
+	SeccompProfile string `json:",omitempty"`
+}
+
+func boolPtr(b bool) *bool {
+	return &b
+}
+
+// defaultSecurityProfile is applied to all commands in the sandbox, unless a test configures something different
+var defaultSecurityProfile = SecurityProfile{
+	Network:          boolPtr(false),
+	User:             defaultSandboxUser(),
+	ReadOnly:         boolPtr(true),
+	Tmpfs:            []string{"/tmp"},
+	PidsLimit:        128,
+	Cpus:             1,
+	DropCapabilities: boolPtr(true),
+	NoNewPrivileges:  boolPtr(true),
+}
+
+// defaultSandboxUser runs commands as the user running RTE, so that files written in the run directory can be read and removed.
+// If RTE runs as root, nobody is used instead.
+func defaultSandboxUser() string {
+	uid := os.Getuid()
+	if uid <= 0 {
+		return "65534:65534"
+	}
+	return fmt.Sprintf("%d:%d", uid, os.Getgid())
+}
+
+// loadSecurityProfile replaces fields of the default profile with the fields set in the given file
+func loadSecurityProfile(file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	var profile SecurityProfile
+	if err := json.NewDecoder(f).Decode(&profile); err != nil {
+		return fmt.Errorf("Could not read security profile %s: %s", file, err)
+	}
+	defaultSecurityProfile = defaultSecurityProfile.merge(&profile)
+	return nil
+}
+
+// merge returns a copy of the profile with all fields set in override replaced
+func (p SecurityProfile) merge(override *SecurityProfile) SecurityProfile {
+	if override == nil {
+		return p
+	}
+	if override.Network != nil {
+		p.Network = override.Network
+	}
+	if override.User != "" {
+		p.User = override.User
+	}
+	if override.ReadOnly != nil {
+		p.ReadOnly = override.ReadOnly
+	}
+	if override.Tmpfs != nil {
+		p.Tmpfs = override.Tmpfs
+	}
+	if override.PidsLimit != 0 {
+		p.PidsLimit = override.PidsLimit
+	}
+	if override.Cpus != 0 {
+		p.Cpus = override.Cpus
+	}
+	if override.DropCapabilities != nil {
+		p.DropCapabilities = override.DropCapabilities
+	}
+	if override.NoNewPrivileges != nil {
+		p.NoNewPrivileges = override.NoNewPrivileges
+	}
+	if override.SeccompProfile != "" {
+		p.SeccompProfile = override.SeccompProfile
+	}
+	return p
+}
+
+func isSet(b *bool) bool {
+	return b != nil && *b
+}
+
+// securityProfile returns the profile for the commands of the execution
+func (execution *Execution) securityProfile() *SecurityProfile {
+	profile := defaultSecurityProfile.merge(execution.Config.Security)
+	return &profile
+}
+
+// securityProfileOf returns the profile of a command, commands without a profile use the default profile
+func securityProfileOf(cmd SandboxCommand) SecurityProfile {
+	if cmd.Security == nil {
+		return defaultSecurityProfile
+	}
+	return *cmd.Security
+}
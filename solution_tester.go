@@ -21,7 +21,7 @@ func testSolutions() error {
 		return err
 	}
 	if *testSolutionTestname != "" {
-		solutionFolder := filepath.Join(testdataDir, *testSolutionTestname, "_solution")
+		solutionFolder := filepath.Join(testdataDir, *testSolutionTestname, solutionDir)
 		if _, err := os.Stat(solutionFolder); os.IsNotExist(err) {
 			return fmt.Errorf("Could not find solution folder in %s", solutionFolder)
 		}
@@ -36,7 +36,7 @@ func testSolutions() error {
 	} else {
 		for _, configFile := range configFiles {
 			folder := filepath.Dir(configFile)
-			solutionFolder := filepath.Join(folder, "_solution")
+			solutionFolder := filepath.Join(folder, solutionDir)
 			if _, err := os.Stat(solutionFolder); os.IsNotExist(err) {
 				continue
 			}
@@ -68,6 +68,8 @@ func sendFiles(testName string, solutionFolder string, files []os.FileInfo) erro
 
 	bodyWriter.WriteField("test", testName)
 	bodyWriter.WriteField("numfiles", strconv.Itoa(len(files)))
+	// solutions are checked by instructors and should not wait for student submissions
+	bodyWriter.WriteField("priority", "high")
 
 	for i, file := range files {
 		filename := filepath.Join(solutionFolder, file.Name())
@@ -99,7 +101,16 @@ func sendFiles(testName string, solutionFolder string, files []os.FileInfo) erro
 	bodyWriter.Close()
 
 	targetUrl := "http://" + *hostname + ":" + strconv.Itoa(*port) + "/test"
-	resp, err := http.Post(targetUrl, contentType, bodyBuf)
+	req, err := http.NewRequest("POST", targetUrl, bodyBuf)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", contentType)
+	// the solutions of all tests can only be tested with the admin key
+	if key := os.Getenv("RTE_API_KEY"); key != "" {
+		req.Header.Set("ApiKey", key)
+	}
+	resp, err := http.DefaultClient.Do(req)
 	if err != nil {
 		return err
 	}
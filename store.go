@@ -0,0 +1,360 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// UploadedFile describes a file uploaded for a test execution
+type UploadedFile struct {
+	Name   string `json:"name"` // path relative to the run directory
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// RunRecord is the persistent record of a test execution and its result
+type RunRecord struct {
+	ID     string `json:"id"`
+	Test   string `json:"test"`
+	Caller string `json:"caller,omitempty"`
+	// User is the LTI user (subject of the token) who started the run
+	User     string           `json:"user,omitempty"`
+	Config   TestConfig       `json:"config"`
+	Uploads  []UploadedFile   `json:"uploads"`
+	Commit   string           `json:"commit,omitempty"`
+	Status   SubmissionStatus `json:"status"`
+	Created  time.Time        `json:"created"`
+	Started  *time.Time       `json:"started,omitempty"`
+	Finished *time.Time       `json:"finished,omitempty"`
+	Result   *RteResult       `json:"result,omitempty"`
+	Error    string           `json:"error,omitempty"`
+}
+
+// RunStore persists the records of test executions
+type RunStore interface {
+	save(record RunRecord) error
+	// load returns the record with the given id, the record is nil if it does not exist
+	load(id string) (*RunRecord, error)
+	// findByTest returns the newest runs of the test created before the cursor (at most limit),
+	// ordered by their creation time
+	findByTest(test string, before runCursor, limit int) ([]RunRecord, error)
+	// unfinished returns the records of all executions which are not done
+	unfinished() ([]RunRecord, error)
+	// prune removes the records of the runs finished before the given time and returns their number
+	prune(finishedBefore time.Time) (int, error)
+	Close() error
+}
+
+// runCursor is the position of a run in the runs of a test, which are ordered by their creation time and id.
+// The zero cursor is after the newest run.
+type runCursor struct {
+	Created time.Time
+	ID      string
+}
+
+func cursorOf(record RunRecord) runCursor {
+	return runCursor{Created: record.Created, ID: record.ID}
+}
+
+func (c runCursor) isZero() bool {
+	return c.Created.IsZero() && c.ID == ""
+}
+
+// before tells if the run at the cursor c comes before the run at the cursor other
+func (c runCursor) before(other runCursor) bool {
+	if other.isZero() {
+		return true
+	}
+	if !c.Created.Equal(other.Created) {
+		return c.Created.Before(other.Created)
+	}
+	return c.ID < other.ID
+}
+
+// limits of the runs returned by GET /results
+const (
+	defaultResultsLimit = 100
+	maxResultsLimit     = 1000
+)
+
+// runStore is nil if results are not stored
+var runStore RunStore
+
+// openRunStore opens the store with the given name at the given path.
+// If path is empty, the store is created in the base folder.
+func openRunStore(name string, path string) (RunStore, error) {
+	switch name {
+	case "bolt":
+		if path == "" {
+			path = filepath.Join(baseDir, "results.db")
+		}
+		return openBoltRunStore(path)
+	case "fs":
+		if path == "" {
+			path = filepath.Join(baseDir, "results")
+		}
+		return openFsRunStore(path)
+	case "none":
+		return nil, nil
+	default:
+		return nil, fmt.Errorf("Unknown store: %s", name)
+	}
+}
+
+func newRunRecord(execution Execution) RunRecord {
+	record := RunRecord{
+		ID:      execution.ID,
+		Test:    execution.Test,
+		Caller:  execution.Caller,
+		Config:  execution.Config,
+		Uploads: execution.Uploads,
+		Commit:  execution.Commit,
+		Status:  SubmissionQueued,
+		Created: time.Now(),
+	}
+	if execution.Lti != nil {
+		record.User = execution.Lti.user
+	}
+	return record
+}
+
+func (record *RunRecord) start() {
+	started := time.Now()
+	record.Status = SubmissionRunning
+	record.Started = &started
+}
+
+func (record *RunRecord) finish(result *RteResult) {
+	finished := time.Now()
+	record.Status = SubmissionDone
+	record.Finished = &finished
+	record.Result = result
+}
+
+// storeRun saves the record, if a store is configured
+func storeRun(record RunRecord) {
+	if runStore == nil {
+		return
+	}
+	if err := runStore.save(record); err != nil {
+		LogError("store", "Could not store run %s: %s", record.ID, err)
+	}
+}
+
+// hashUploads computes the checksums of all files in the upload folder
+func hashUploads(rundir string, uploadFolder string) ([]UploadedFile, error) {
+	uploads := make([]UploadedFile, 0)
+	err := filepath.Walk(uploadFolder, func(path string, info os.FileInfo, err error) error {
+		if err != nil || info.IsDir() {
+			return err
+		}
+		f, err := os.Open(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		hash := sha256.New()
+		if _, err := io.Copy(hash, f); err != nil {
+			return err
+		}
+		name, err := filepath.Rel(rundir, path)
+		if err != nil {
+			return err
+		}
+		uploads = append(uploads, UploadedFile{
+			Name:   filepath.ToSlash(name),
+			Size:   info.Size(),
+			SHA256: hex.EncodeToString(hash.Sum(nil)),
+		})
+		return nil
+	})
+	return uploads, err
+}
+
+// recoverRuns handles the executions which were interrupted by a restart of RTE.
+// They are either executed again or marked as failed.
+func recoverRuns(requeue bool) error {
+	if runStore == nil {
+		return nil
+	}
+	records, err := runStore.unfinished()
+	if err != nil {
+		return err
+	}
+	for _, record := range records {
+		rundir := filepath.Join(testrunDir, record.ID)
+		testdir := filepath.Join(testdataDir, record.Test)
+		if requeue && fileExists(rundir) && fileExists(testdir) {
+			Info.Printf("Re-queueing interrupted run %s of test %s\n", record.ID, record.Test)
+			execution := newExecution(record.ID, rundir, testdir, record.Test, record.Config)
+			execution.Uploads = record.Uploads
+			record.Status = SubmissionQueued
+			record.Started = nil
+			if _, ok := startSubmission(execution, record); ok {
+				continue
+			}
+			LogError("startup", "Queue is full, could not re-queue run %s", record.ID)
+		}
+		Info.Printf("Marking interrupted run %s of test %s as failed\n", record.ID, record.Test)
+		finished := time.Now()
+		record.Status = SubmissionFailed
+		record.Finished = &finished
+		record.Error = "Run was interrupted by a restart of RTE"
+		storeRun(record)
+	}
+	return nil
+}
+
+// findVisibleRuns returns the newest runs of the test created before the cursor which the caller may see (at most limit),
+// ordered by their creation time
+func findVisibleRuns(caller Caller, test string, before runCursor, limit int) ([]RunRecord, error) {
+	if caller.User == "" || caller.Instructor {
+		return runStore.findByTest(test, before, limit)
+	}
+	// the runs of other users are skipped, until enough runs are found or all runs were read
+	visible := make([]RunRecord, 0)
+	for len(visible) < limit {
+		records, err := runStore.findByTest(test, before, maxResultsLimit)
+		if err != nil {
+			return nil, err
+		}
+		for i := len(records) - 1; i >= 0 && len(visible) < limit; i-- {
+			if caller.canSeeRun(records[i].Test, records[i].Caller, records[i].User) {
+				visible = append(visible, records[i])
+			}
+		}
+		if len(records) < maxResultsLimit {
+			break
+		}
+		before = cursorOf(records[0])
+	}
+	for i, j := 0, len(visible)-1; i < j; i, j = i+1, j-1 {
+		visible[i], visible[j] = visible[j], visible[i]
+	}
+	return visible, nil
+}
+
+// pruneRuns removes the records of the runs finished before the given time from the store
+func pruneRuns(finishedBefore time.Time) {
+	removed, err := runStore.prune(finishedBefore)
+	if err != nil {
+		LogError("store", "Could not remove old runs: %s", err)
+		return
+	}
+	if removed > 0 {
+		Info.Printf("Removed %d runs finished before %s from the store\n", removed, finishedBefore.Format(time.RFC3339))
+	}
+}
+
+// storeRetentionService periodically removes the records of runs which finished longer ago than the retention
+func storeRetentionService(retention time.Duration) {
+	for {
+		pruneRuns(time.Now().Add(-retention))
+		time.Sleep(time.Hour)
+	}
+}
+
+// handleResults returns stored results: /results/<id> returns a single run, /results?test=<ref> the newest runs of a test.
+// The runs of a test are paged with the parameters limit and before, the id of the oldest run of the previous page.
+func handleResults(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != "GET" {
+		rejectMethod(w, r, "GET")
+		LogError("listing", "Rejected %s request to results from %s", r.Method, r.RemoteAddr)
+		return
+	}
+
+	caller, ok := authenticate(w, r, "listing")
+	if !ok {
+		return
+	}
+
+	if runStore == nil {
+		notFound(w, "Results are not stored")
+		return
+	}
+
+	id := strings.Trim(strings.TrimPrefix(apiPath(r), "/results"), "/")
+	if id != "" {
+		record, err := runStore.load(id)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, ApiError{Code: ErrStorage, Message: err.Error(), Phase: PhaseListing})
+			LogError("listing", "Could not load run %s: %s", id, err)
+			return
+		}
+		if record == nil || !caller.canSeeRun(record.Test, record.Caller, record.User) {
+			notFound(w, "Run not found")
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		enc := json.NewEncoder(w)
+		enc.Encode(record)
+		return
+	}
+
+	test := r.URL.Query().Get("test")
+	if test == "" {
+		writeError(w, http.StatusBadRequest, ApiError{Code: ErrMissingParameter, Message: "Parameter 'test' required", Details: map[string]string{"parameter": "test"}, Phase: PhaseRequest})
+		return
+	}
+	test = filepath.Clean(test)
+	if !caller.canAccess(test) {
+		notFound(w, "Test not found")
+		return
+	}
+	limit := defaultResultsLimit
+	if value := r.URL.Query().Get("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 || n > maxResultsLimit {
+			writeError(w, http.StatusBadRequest, ApiError{
+				Code:    ErrInvalidParameter,
+				Message: fmt.Sprintf("Parameter 'limit' must be a number from 1 to %d", maxResultsLimit),
+				Details: map[string]string{"parameter": "limit"},
+				Phase:   PhaseRequest,
+			})
+			return
+		}
+		limit = n
+	}
+	var before runCursor
+	if id := r.URL.Query().Get("before"); id != "" {
+		record, err := runStore.load(id)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, ApiError{Code: ErrStorage, Message: err.Error(), Phase: PhaseListing})
+			LogError("listing", "Could not load run %s: %s", id, err)
+			return
+		}
+		if record == nil || record.Test != test || !caller.canSeeRun(record.Test, record.Caller, record.User) {
+			writeError(w, http.StatusBadRequest, ApiError{
+				Code:    ErrInvalidParameter,
+				Message: "Parameter 'before' must be the id of a run of the test",
+				Details: map[string]string{"parameter": "before"},
+				Phase:   PhaseRequest,
+			})
+			return
+		}
+		before = cursorOf(*record)
+	}
+	records, err := findVisibleRuns(caller, test, before, limit)
+	if err != nil {
+		writeError(w, http.StatusInternalServerError, ApiError{Code: ErrStorage, Message: err.Error(), Phase: PhaseListing})
+		LogError("listing", "Could not load runs of test %s: %s", test, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.Encode(records)
+}
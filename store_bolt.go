@@ -0,0 +1,213 @@
+package main
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+var (
+	boltRunsBucket = []byte("runs")
+	// index of the runs of a test, the keys are "<test>\x00" followed by the key in boltCreatedBucket
+	boltTestsBucket = []byte("tests")
+	// index of the runs ordered by their creation time, see boltCreatedKey
+	boltCreatedBucket = []byte("created")
+	// ids of the runs which are not done yet
+	boltUnfinishedBucket = []byte("unfinished")
+)
+
+// BoltRunStore stores the records in an embedded bbolt database
+type BoltRunStore struct {
+	db *bolt.DB
+}
+
+func openBoltRunStore(path string) (*BoltRunStore, error) {
+	db, err := bolt.Open(path, 0600, &bolt.Options{Timeout: 5 * time.Second})
+	if err != nil {
+		return nil, err
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		indexed := tx.Bucket(boltCreatedBucket) != nil
+		if !indexed {
+			// databases of older versions index the runs of a test by their id only
+			if err := tx.DeleteBucket(boltTestsBucket); err != nil && err != bolt.ErrBucketNotFound {
+				return err
+			}
+		}
+		for _, bucket := range [][]byte{boltRunsBucket, boltTestsBucket, boltCreatedBucket, boltUnfinishedBucket} {
+			if _, err := tx.CreateBucketIfNotExists(bucket); err != nil {
+				return err
+			}
+		}
+		if indexed {
+			return nil
+		}
+		return tx.Bucket(boltRunsBucket).ForEach(func(id, data []byte) error {
+			var record RunRecord
+			if err := json.Unmarshal(data, &record); err != nil {
+				return err
+			}
+			return indexBoltRecord(tx, record)
+		})
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &BoltRunStore{db: db}, nil
+}
+
+// boltCreatedKey orders the runs by their creation time and id
+func boltCreatedKey(cursor runCursor) []byte {
+	key := make([]byte, 8, 8+len(cursor.ID))
+	binary.BigEndian.PutUint64(key, uint64(cursor.Created.UnixNano()))
+	return append(key, cursor.ID...)
+}
+
+func boltTestKey(test string, cursor runCursor) []byte {
+	return append([]byte(test+"\x00"), boltCreatedKey(cursor)...)
+}
+
+// indexBoltRecord adds the run to the indexes, the keys do not change when the record is saved again
+func indexBoltRecord(tx *bolt.Tx, record RunRecord) error {
+	cursor := cursorOf(record)
+	if err := tx.Bucket(boltTestsBucket).Put(boltTestKey(record.Test, cursor), nil); err != nil {
+		return err
+	}
+	return tx.Bucket(boltCreatedBucket).Put(boltCreatedKey(cursor), nil)
+}
+
+func (s *BoltRunStore) save(record RunRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	return s.db.Update(func(tx *bolt.Tx) error {
+		id := []byte(record.ID)
+		if err := tx.Bucket(boltRunsBucket).Put(id, data); err != nil {
+			return err
+		}
+		if err := indexBoltRecord(tx, record); err != nil {
+			return err
+		}
+		if record.Status == SubmissionDone || record.Status == SubmissionFailed {
+			return tx.Bucket(boltUnfinishedBucket).Delete(id)
+		}
+		return tx.Bucket(boltUnfinishedBucket).Put(id, nil)
+	})
+}
+
+func loadBoltRecord(tx *bolt.Tx, id []byte) (*RunRecord, error) {
+	data := tx.Bucket(boltRunsBucket).Get(id)
+	if data == nil {
+		return nil, nil
+	}
+	var record RunRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+func (s *BoltRunStore) load(id string) (record *RunRecord, err error) {
+	err = s.db.View(func(tx *bolt.Tx) error {
+		record, err = loadBoltRecord(tx, []byte(id))
+		return err
+	})
+	return record, err
+}
+
+func (s *BoltRunStore) findByTest(test string, before runCursor, limit int) ([]RunRecord, error) {
+	records := make([]RunRecord, 0)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		prefix := []byte(test + "\x00")
+		// the keys of the test end before "<test>\x01"
+		end := []byte(test + "\x01")
+		if !before.isZero() {
+			end = boltTestKey(test, before)
+		}
+		c := tx.Bucket(boltTestsBucket).Cursor()
+		k, _ := c.Seek(end)
+		if k == nil {
+			k, _ = c.Last()
+		} else {
+			k, _ = c.Prev()
+		}
+		// the newest runs are read first
+		for ; k != nil && bytes.HasPrefix(k, prefix) && len(records) < limit; k, _ = c.Prev() {
+			record, err := loadBoltRecord(tx, k[len(prefix)+8:])
+			if err != nil {
+				return err
+			}
+			if record != nil {
+				records = append(records, *record)
+			}
+		}
+		return nil
+	})
+	for i, j := 0, len(records)-1; i < j; i, j = i+1, j-1 {
+		records[i], records[j] = records[j], records[i]
+	}
+	return records, err
+}
+
+func (s *BoltRunStore) unfinished() ([]RunRecord, error) {
+	records := make([]RunRecord, 0)
+	err := s.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(boltUnfinishedBucket).ForEach(func(id, _ []byte) error {
+			record, err := loadBoltRecord(tx, id)
+			if err != nil {
+				return err
+			}
+			if record != nil {
+				records = append(records, *record)
+			}
+			return nil
+		})
+	})
+	return records, err
+}
+
+func (s *BoltRunStore) prune(finishedBefore time.Time) (int, error) {
+	removed := 0
+	err := s.db.Update(func(tx *bolt.Tx) error {
+		var remove []RunRecord
+		// runs finish after they were created, so only runs created before the time have to be checked
+		c := tx.Bucket(boltCreatedBucket).Cursor()
+		end := boltCreatedKey(runCursor{Created: finishedBefore})
+		for k, _ := c.First(); k != nil && bytes.Compare(k, end) < 0; k, _ = c.Next() {
+			record, err := loadBoltRecord(tx, k[8:])
+			if err != nil {
+				return err
+			}
+			if record != nil && record.Finished != nil && record.Finished.Before(finishedBefore) {
+				remove = append(remove, *record)
+			}
+		}
+		for _, record := range remove {
+			cursor := cursorOf(record)
+			if err := tx.Bucket(boltRunsBucket).Delete([]byte(record.ID)); err != nil {
+				return err
+			}
+			if err := tx.Bucket(boltTestsBucket).Delete(boltTestKey(record.Test, cursor)); err != nil {
+				return err
+			}
+			if err := tx.Bucket(boltCreatedBucket).Delete(boltCreatedKey(cursor)); err != nil {
+				return err
+			}
+			if err := tx.Bucket(boltUnfinishedBucket).Delete([]byte(record.ID)); err != nil {
+				return err
+			}
+		}
+		removed = len(remove)
+		return nil
+	})
+	return removed, err
+}
+
+func (s *BoltRunStore) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+// FsRunStore stores each record as JSON file <id>.json in a folder.
+// The index of the runs is read from all records when the store is opened and kept in memory.
+type FsRunStore struct {
+	sync.Mutex
+	dir string
+	// runs holds the index entry of each run by its id
+	runs map[string]fsIndexEntry
+	// tests holds the ids of the runs of each test
+	tests map[string]map[string]bool
+}
+
+// fsIndexEntry is what the index keeps of a record
+type fsIndexEntry struct {
+	test     string
+	cursor   runCursor
+	finished *time.Time // only set if the run is done or failed
+}
+
+func openFsRunStore(dir string) (*FsRunStore, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, err
+	}
+	s := &FsRunStore{dir: dir, runs: make(map[string]fsIndexEntry), tests: make(map[string]map[string]bool)}
+	records, err := s.all()
+	if err != nil {
+		return nil, err
+	}
+	for _, record := range records {
+		s.index(record)
+	}
+	return s, nil
+}
+
+// index adds or updates the entry of the record, the caller holds the lock if the store is in use
+func (s *FsRunStore) index(record RunRecord) {
+	entry := fsIndexEntry{test: record.Test, cursor: cursorOf(record)}
+	if record.Status == SubmissionDone || record.Status == SubmissionFailed {
+		entry.finished = record.Finished
+		if entry.finished == nil {
+			entry.finished = &record.Created
+		}
+	}
+	s.runs[record.ID] = entry
+	if s.tests[record.Test] == nil {
+		s.tests[record.Test] = make(map[string]bool)
+	}
+	s.tests[record.Test][record.ID] = true
+}
+
+func (s *FsRunStore) file(id string) string {
+	return filepath.Join(s.dir, id+".json")
+}
+
+func (s *FsRunStore) save(record RunRecord) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+	// write to a temporary file first, so that a crash never leaves a partial record
+	tmp, err := ioutil.TempFile(s.dir, record.ID+".*.tmp")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+	if err := os.Rename(tmp.Name(), s.file(record.ID)); err != nil {
+		return err
+	}
+	s.Lock()
+	s.index(record)
+	s.Unlock()
+	return nil
+}
+
+func (s *FsRunStore) load(id string) (*RunRecord, error) {
+	// ids come from requests and must not point outside of the store
+	if id == "" || strings.ContainsAny(id, `/\`) || strings.HasPrefix(id, ".") {
+		return nil, nil
+	}
+	data, err := ioutil.ReadFile(s.file(id))
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	var record RunRecord
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, err
+	}
+	return &record, nil
+}
+
+// all loads all records of the store
+func (s *FsRunStore) all() ([]RunRecord, error) {
+	files, err := filepath.Glob(filepath.Join(s.dir, "*.json"))
+	if err != nil {
+		return nil, err
+	}
+	records := make([]RunRecord, 0, len(files))
+	for _, file := range files {
+		record, err := s.load(strings.TrimSuffix(filepath.Base(file), ".json"))
+		if err != nil {
+			LogError("store", "Could not read %s: %s", file, err)
+			continue
+		}
+		if record != nil {
+			records = append(records, *record)
+		}
+	}
+	return records, nil
+}
+
+func (s *FsRunStore) findByTest(test string, before runCursor, limit int) ([]RunRecord, error) {
+	s.Lock()
+	cursors := make([]runCursor, 0, len(s.tests[test]))
+	for id := range s.tests[test] {
+		if cursor := s.runs[id].cursor; cursor.before(before) {
+			cursors = append(cursors, cursor)
+		}
+	}
+	s.Unlock()
+	sort.Slice(cursors, func(i, j int) bool {
+		return cursors[i].before(cursors[j])
+	})
+	if len(cursors) > limit {
+		cursors = cursors[len(cursors)-limit:]
+	}
+
+	records := make([]RunRecord, 0, len(cursors))
+	for _, cursor := range cursors {
+		record, err := s.load(cursor.ID)
+		if err != nil {
+			return nil, err
+		}
+		if record != nil {
+			records = append(records, *record)
+		}
+	}
+	return records, nil
+}
+
+func (s *FsRunStore) unfinished() ([]RunRecord, error) {
+	s.Lock()
+	var ids []string
+	for id, entry := range s.runs {
+		if entry.finished == nil {
+			ids = append(ids, id)
+		}
+	}
+	s.Unlock()
+
+	records := make([]RunRecord, 0, len(ids))
+	for _, id := range ids {
+		record, err := s.load(id)
+		if err != nil {
+			return nil, err
+		}
+		if record != nil {
+			records = append(records, *record)
+		}
+	}
+	return records, nil
+}
+
+func (s *FsRunStore) prune(finishedBefore time.Time) (int, error) {
+	s.Lock()
+	defer s.Unlock()
+	removed := 0
+	for id, entry := range s.runs {
+		if entry.finished == nil || !entry.finished.Before(finishedBefore) {
+			continue
+		}
+		if err := os.Remove(s.file(id)); err != nil && !os.IsNotExist(err) {
+			return removed, err
+		}
+		delete(s.runs, id)
+		delete(s.tests[entry.test], id)
+		if len(s.tests[entry.test]) == 0 {
+			delete(s.tests, entry.test)
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+func (s *FsRunStore) Close() error {
+	return nil
+}
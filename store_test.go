@@ -0,0 +1,259 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// runStores opens each kind of store in the folder, the stores can be opened again to check what they persisted
+var runStores = []struct {
+	name string
+	open func(dir string) (RunStore, error)
+}{
+	{"bolt", func(dir string) (RunStore, error) { return openBoltRunStore(filepath.Join(dir, "results.db")) }},
+	{"fs", func(dir string) (RunStore, error) { return openFsRunStore(filepath.Join(dir, "results")) }},
+}
+
+var storeEpoch = time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+
+// testRecord creates a record of the test created the given number of minutes after storeEpoch, finished a minute later
+func testRecord(id string, test string, minute int) RunRecord {
+	created := storeEpoch.Add(time.Duration(minute) * time.Minute)
+	finished := created.Add(time.Minute)
+	return RunRecord{ID: id, Test: test, Status: SubmissionDone, Created: created, Finished: &finished}
+}
+
+func recordIds(records []RunRecord) string {
+	ids := make([]string, len(records))
+	for i, record := range records {
+		ids[i] = record.ID
+	}
+	return strings.Join(ids, " ")
+}
+
+func TestRunStoreFindByTest(t *testing.T) {
+	for _, kind := range runStores {
+		t.Run(kind.name, func(t *testing.T) {
+			store, err := kind.open(t.TempDir())
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer store.Close()
+			// saved out of order, with the same creation time for c and d
+			for _, record := range []RunRecord{
+				testRecord("d", "py/io", 3),
+				testRecord("a", "py/io", 1),
+				testRecord("x", "py/io2", 2),
+				testRecord("c", "py/io", 3),
+				testRecord("b", "py/io", 2),
+				testRecord("y", "py", 5),
+			} {
+				if err := store.save(record); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			cases := []struct {
+				before runCursor
+				limit  int
+				want   string
+			}{
+				{limit: 100, want: "a b c d"},
+				{limit: 2, want: "c d"},
+				{before: cursorOf(testRecord("c", "py/io", 3)), limit: 2, want: "a b"},
+				{before: cursorOf(testRecord("d", "py/io", 3)), limit: 2, want: "b c"},
+				{before: cursorOf(testRecord("a", "py/io", 1)), limit: 2, want: ""},
+			}
+			for _, c := range cases {
+				records, err := store.findByTest("py/io", c.before, c.limit)
+				if err != nil {
+					t.Fatal(err)
+				}
+				if got := recordIds(records); got != c.want {
+					t.Errorf("findByTest(%+v, %d) = %q, want %q", c.before, c.limit, got, c.want)
+				}
+			}
+			if records, _ := store.findByTest("missing", runCursor{}, 10); len(records) != 0 {
+				t.Errorf("found runs of a missing test: %s", recordIds(records))
+			}
+		})
+	}
+}
+
+func TestRunStoreSaveAgain(t *testing.T) {
+	for _, kind := range runStores {
+		t.Run(kind.name, func(t *testing.T) {
+			dir := t.TempDir()
+			store, err := kind.open(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			record := testRecord("a", "py/io", 1)
+			record.Status, record.Finished = SubmissionRunning, nil
+			store.save(record)
+			store.save(testRecord("b", "py/io", 2))
+			if unfinished, _ := store.unfinished(); recordIds(unfinished) != "a" {
+				t.Errorf("unfinished = %q, want a", recordIds(unfinished))
+			}
+			record = testRecord("a", "py/io", 1)
+			store.save(record)
+			if unfinished, _ := store.unfinished(); len(unfinished) != 0 {
+				t.Errorf("unfinished = %q, want none", recordIds(unfinished))
+			}
+			store.Close()
+
+			// the index is the same after opening the store again
+			store, err = kind.open(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer store.Close()
+			records, err := store.findByTest("py/io", runCursor{}, 10)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if recordIds(records) != "a b" || records[0].Status != SubmissionDone {
+				t.Errorf("records %+v, want the last version of a and b", records)
+			}
+		})
+	}
+}
+
+func TestRunStorePrune(t *testing.T) {
+	for _, kind := range runStores {
+		t.Run(kind.name, func(t *testing.T) {
+			dir := t.TempDir()
+			store, err := kind.open(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			running := testRecord("running", "py/io", 0)
+			running.Status, running.Finished = SubmissionRunning, nil
+			for _, record := range []RunRecord{running, testRecord("old", "py/io", 1), testRecord("new", "py/io", 10), testRecord("other", "py", 2)} {
+				if err := store.save(record); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			// old finished at minute 2, other at minute 3, new at minute 11
+			removed, err := store.prune(storeEpoch.Add(5 * time.Minute))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if removed != 2 {
+				t.Errorf("%d runs removed, want 2", removed)
+			}
+			for id, exists := range map[string]bool{"running": true, "old": false, "new": true, "other": false} {
+				if record, _ := store.load(id); (record != nil) != exists {
+					t.Errorf("run %s exists: %v, want %v", id, record != nil, exists)
+				}
+			}
+			store.Close()
+
+			store, err = kind.open(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer store.Close()
+			if records, _ := store.findByTest("py/io", runCursor{}, 10); recordIds(records) != "running new" {
+				t.Errorf("runs %q after pruning, want running new", recordIds(records))
+			}
+			if records, _ := store.findByTest("py", runCursor{}, 10); len(records) != 0 {
+				t.Errorf("runs %q after pruning, want none", recordIds(records))
+			}
+		})
+	}
+}
+
+func TestBoltRunStoreMigration(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "results.db")
+	// a database of an older version without the index of the creation time
+	db, err := bolt.Open(path, 0600, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		runs, _ := tx.CreateBucket(boltRunsBucket)
+		tests, _ := tx.CreateBucket(boltTestsBucket)
+		tx.CreateBucket(boltUnfinishedBucket)
+		for i, id := range []string{"b", "a"} {
+			data, _ := json.Marshal(testRecord(id, "py/io", i))
+			runs.Put([]byte(id), data)
+			tests.Put([]byte("py/io\x00"+id), nil)
+		}
+		return nil
+	})
+	db.Close()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store, err := openBoltRunStore(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	records, err := store.findByTest("py/io", runCursor{}, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if recordIds(records) != "b a" {
+		t.Errorf("runs %q, want b a ordered by their creation time", recordIds(records))
+	}
+}
+
+func TestHandleResultsPaging(t *testing.T) {
+	store, err := openFsRunStore(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	previous := runStore
+	runStore = store
+	t.Cleanup(func() { runStore = previous })
+	for i := 0; i < 5; i++ {
+		store.save(testRecord(fmt.Sprintf("r%d", i), "py/io", i))
+	}
+	store.save(testRecord("other", "py", 0))
+
+	cases := []struct {
+		query  string
+		status int
+		want   string
+	}{
+		{query: "test=py/io", status: http.StatusOK, want: "r0 r1 r2 r3 r4"},
+		{query: "test=py/io&limit=2", status: http.StatusOK, want: "r3 r4"},
+		{query: "test=py/io&limit=2&before=r3", status: http.StatusOK, want: "r1 r2"},
+		{query: "test=py/io&limit=2&before=r1", status: http.StatusOK, want: "r0"},
+		{query: "test=py/io&limit=0", status: http.StatusBadRequest},
+		{query: "test=py/io&limit=1001", status: http.StatusBadRequest},
+		{query: "test=py/io&limit=x", status: http.StatusBadRequest},
+		{query: "test=py/io&before=missing", status: http.StatusBadRequest},
+		{query: "test=py/io&before=other", status: http.StatusBadRequest},
+	}
+	for _, c := range cases {
+		w := httptest.NewRecorder()
+		handleResults(w, httptest.NewRequest("GET", "/results?"+c.query, nil))
+		if w.Code != c.status {
+			t.Errorf("%s: status %d, want %d: %s", c.query, w.Code, c.status, w.Body.String())
+			continue
+		}
+		if c.status != http.StatusOK {
+			continue
+		}
+		var records []RunRecord
+		if err := json.Unmarshal(w.Body.Bytes(), &records); err != nil {
+			t.Fatal(err)
+		}
+		if got := recordIds(records); got != c.want {
+			t.Errorf("%s: runs %q, want %q", c.query, got, c.want)
+		}
+	}
+}
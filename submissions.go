@@ -0,0 +1,252 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SubmissionStatus is the state of an asynchronous submission
+type SubmissionStatus string
+
+const (
+	// SubmissionQueued means the submission waits for a free compile service
+	SubmissionQueued SubmissionStatus = "queued"
+	// SubmissionRunning means the submission is compiled, tested or analysed
+	SubmissionRunning SubmissionStatus = "running"
+	// SubmissionDone means the result of the submission is available
+	SubmissionDone SubmissionStatus = "done"
+	// SubmissionFailed means the submission was interrupted and has no result
+	SubmissionFailed SubmissionStatus = "failed"
+)
+
+// Submission is a test execution that was started using the asynchronous API
+type Submission struct {
+	ID       string           `json:"id"`
+	Test     string           `json:"test"`
+	Status   SubmissionStatus `json:"status"`
+	Created  time.Time        `json:"created"`
+	Finished *time.Time       `json:"finished,omitempty"`
+	Result   *RteResult       `json:"result,omitempty"`
+
+	// caller and user started the submission, like in RunRecord
+	caller   string
+	user     string
+	progress *progressStream
+}
+
+// visibleTo checks if the caller may see the submission
+func (s Submission) visibleTo(caller Caller) bool {
+	return caller.canSeeRun(s.Test, s.caller, s.user)
+}
+
+type submissionStore struct {
+	sync.Mutex
+	submissions map[string]*Submission
+}
+
+var submissions = submissionStore{submissions: make(map[string]*Submission)}
+
+func (s *submissionStore) add(submission *Submission) {
+	s.Lock()
+	defer s.Unlock()
+	s.submissions[submission.ID] = submission
+}
+
+// get returns a copy of the submission with the given id
+func (s *submissionStore) get(id string) (Submission, bool) {
+	s.Lock()
+	defer s.Unlock()
+	submission, ok := s.submissions[id]
+	if !ok {
+		return Submission{}, false
+	}
+	return *submission, true
+}
+
+func (s *submissionStore) update(id string, f func(submission *Submission)) {
+	s.Lock()
+	defer s.Unlock()
+	if submission, ok := s.submissions[id]; ok {
+		f(submission)
+	}
+}
+
+func (s *submissionStore) remove(id string) {
+	s.Lock()
+	defer s.Unlock()
+	delete(s.submissions, id)
+}
+
+// removeFinishedBefore forgets all submissions which have been finished before the given time
+func (s *submissionStore) removeFinishedBefore(t time.Time) {
+	s.Lock()
+	defer s.Unlock()
+	for id, submission := range s.submissions {
+		if submission.Finished != nil && submission.Finished.Before(t) {
+			delete(s.submissions, id)
+		}
+	}
+}
+
+// submissionCleanupService periodically removes old results of submissions from memory
+func submissionCleanupService(retention time.Duration) {
+	for {
+		time.Sleep(time.Minute)
+		submissions.removeFinishedBefore(time.Now().Add(-retention))
+	}
+}
+
+// startSubmission registers the submission of the execution and runs it in the background.
+// It returns false if the execution could not be queued.
+func startSubmission(execution Execution, record RunRecord) (Submission, bool) {
+	execution.Progress = newProgressStream()
+	submission := &Submission{
+		ID:       execution.ID,
+		Test:     execution.Test,
+		Status:   SubmissionQueued,
+		Created:  record.Created,
+		caller:   record.Caller,
+		user:     record.User,
+		progress: execution.Progress,
+	}
+	submissions.add(submission)
+	execution.report(ProgressEvent{Type: EventQueued})
+	if !compileQueue.push(execution) {
+		submissions.remove(execution.ID)
+		return Submission{}, false
+	}
+	storeRun(record)
+	go runSubmission(execution, record)
+	return *submission, true
+}
+
+// runSubmission sends the execution into the pipeline and stores the result in the submission once all phases are done
+func runSubmission(execution Execution, record RunRecord) {
+	<-execution.Started
+	record.start()
+	storeRun(record)
+	submissions.update(execution.ID, func(submission *Submission) {
+		submission.Status = SubmissionRunning
+	})
+
+	rteResult := RteResult{Commit: execution.Commit}
+	if execution.AnalysisChan != nil {
+		rteResult.FileWarnings = <-execution.AnalysisChan
+	}
+	rteResult.TestResult = <-execution.ResChan
+	rteResult.ClocResults = <-execution.ClocChan
+
+	finishRun(execution, &record, &rteResult)
+	submissions.update(execution.ID, func(submission *Submission) {
+		submission.Status = SubmissionDone
+		submission.Finished = record.Finished
+		submission.Result = &rteResult
+	})
+	execution.report(ProgressEvent{Type: EventDone, Result: &rteResult})
+}
+
+// handleSubmissions accepts a submission with the same parameters as /test and returns its id without waiting for the result
+func handleSubmissions(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != "POST" {
+		rejectMethod(w, r, "POST")
+		LogError("upload", "Rejected %s request to submissions from %s", r.Method, r.RemoteAddr)
+		return
+	}
+
+	caller, ok := authenticate(w, r, "upload")
+	if !ok {
+		return
+	}
+
+	request, ok := parseFormSubmission(w, r)
+	if !ok {
+		return
+	}
+	execution, ok := prepareExecution(w, r, caller, request)
+	if !ok {
+		return
+	}
+
+	submission, ok := startSubmission(execution, newRunRecord(execution))
+	if !ok {
+		rejectOverloaded(w, execution)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Location", r.URL.Path+"/"+submission.ID)
+	w.WriteHeader(http.StatusAccepted)
+	enc := json.NewEncoder(w)
+	enc.Encode(submission)
+}
+
+// handleSubmission returns the status of a submission and its result, once it is done.
+// The progress of the submission is available as server-sent events under /submissions/<id>/events.
+func handleSubmission(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != "GET" {
+		rejectMethod(w, r, "GET")
+		LogError("listing", "Rejected %s request to submission from %s", r.Method, r.RemoteAddr)
+		return
+	}
+
+	caller, ok := authenticate(w, r, "listing")
+	if !ok {
+		return
+	}
+
+	id := strings.TrimPrefix(apiPath(r), "/submissions/")
+	if strings.HasSuffix(id, "/events") {
+		handleSubmissionEvents(w, r, caller, strings.TrimSuffix(id, "/events"))
+		return
+	}
+	submission, ok := submissions.get(id)
+	if !ok {
+		// submissions are only kept in memory for a while, older results may still be in the store
+		submission, ok = storedSubmission(id)
+	}
+	if !ok || !submission.visibleTo(caller) {
+		notFound(w, "Submission not found")
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.Encode(submission)
+}
+
+// storedSubmission loads a submission, which is no longer in memory, from the run store
+func storedSubmission(id string) (Submission, bool) {
+	if runStore == nil {
+		return Submission{}, false
+	}
+	record, err := runStore.load(id)
+	if err != nil {
+		LogError("listing", "Could not load run %s: %s", id, err)
+		return Submission{}, false
+	}
+	if record == nil {
+		return Submission{}, false
+	}
+	return Submission{
+		ID:       record.ID,
+		Test:     record.Test,
+		Status:   record.Status,
+		Created:  record.Created,
+		Finished: record.Finished,
+		Result:   record.Result,
+		caller:   record.Caller,
+		user:     record.User,
+	}, true
+}
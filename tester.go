@@ -1,15 +1,15 @@
 package main
 
 import (
-	"context"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strconv"
 	"strings"
-	"syscall"
+	"sync"
 	"time"
 
 	"github.com/go-errors/errors"
@@ -67,12 +67,19 @@ func allEndLines(b []byte) bool {
 	return true
 }
 
-func executeProgram(execution Execution, inFile string, paramFile string, outFile string, errFile string, dockerArgs []string, dockerImage string, command ...string) (err error) {
-	testid := execution.ID + "-" + filepath.Base(inFile)
+// executeProgram runs the command of a single IO test case in the sandbox.
+// Image, command, environment and additional mounts are taken from the given sandbox command,
+// the arguments, environment and input from the test case.
+// Exceeding a limit is returned as error, the exit status is left to the caller in the result.
+func executeProgram(execution Execution, tc ioTestCase, outFile string, errFile string, sandboxCmd SandboxCommand) (res SandboxResult, err error) {
+	testid := execution.ID + "-" + tc.Name
 	runDir := execution.RunDir
 	testDir := execution.TestDir
 
 	timeout := execution.Config.Timeout
+	if tc.Timeout > 0 {
+		timeout = tc.Timeout
+	}
 	if timeout == 0 {
 		timeout = 10
 	}
@@ -81,53 +88,36 @@ func executeProgram(execution Execution, inFile string, paramFile string, outFil
 		maxMem = 100
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), time.Duration(timeout)*time.Second)
-	defer func() {
-		err := exec.Command("docker", "stop", testid).Run()
-		if err != nil {
-			println("Could not stop", testid, err.Error())
-		}
-		cancel()
-	}()
-	// Docker command
-	arguments, err := dockerArguments(execution.RunDir, testid)
+	code, err := codeMount(execution.RunDir)
 	if err != nil {
-		return fmt.Errorf("Could not get docker arguments: %s", err)
+		return SandboxResult{}, fmt.Errorf("Could not get docker arguments: %s", err)
 	}
-	arguments = append(arguments, "-i")
-
-	arguments = append(arguments, "-m", fmt.Sprintf("%dM", maxMem))
-
-	arguments = append(arguments, dockerArgs...)
-
-	arguments = append(arguments, dockerImage)
-
-	// the java command
-	arguments = append(arguments, command...)
-
-	cmd := exec.CommandContext(ctx, "docker")
-	cmd.Dir = runDir
-
-	paramFilePath := filepath.Join(testDir, paramFile)
-	if finfo, err := os.Stat(paramFilePath); err == nil && !finfo.IsDir() {
-		if paramBytes, err := ioutil.ReadFile(paramFilePath); err == nil {
-			if debug {
-				Debug.Printf("Found parameters: %v", strings.Split(strings.Trim(string(paramBytes), "\r\n"), " "))
-			}
-			arguments = append(arguments, strings.Split(strings.Trim(string(paramBytes), "\r\n"), " ")...)
+	sandboxCmd.Name = testid
+	sandboxCmd.WorkDir = "/code"
+	sandboxCmd.Mounts = append([]Mount{code}, sandboxCmd.Mounts...)
+	sandboxCmd.MaxMem = maxMem
+	sandboxCmd.Timeout = time.Duration(timeout) * time.Second
+	sandboxCmd.Security = execution.securityProfile()
+	// the program reads from stdin even if there is no input file
+	sandboxCmd.Stdin = strings.NewReader(tc.Stdin)
+	sandboxCmd.Env = append(sandboxCmd.Env, tc.environment()...)
+
+	if len(tc.Args) > 0 {
+		if debug {
+			Debug.Printf("Found parameters: %v", tc.Args)
 		}
+		sandboxCmd.Command = append(sandboxCmd.Command, tc.Args...)
 	}
-	cmd.Args = arguments
 
-	inFilePath := filepath.Join(testDir, inFile)
-	if finfo, perr := os.Stat(inFilePath); perr == nil && !finfo.IsDir() {
+	if tc.StdinFile != "" {
+		inFilePath := filepath.Join(testDir, filepath.FromSlash(tc.StdinFile))
 		inFileHandle, err := os.Open(inFilePath)
 		if err != nil {
 			LogError("test", "Could not open test input file %s: %s", inFilePath, err)
-			return err
+			return SandboxResult{}, err
 		}
 		defer inFileHandle.Close()
-		cmd.Stdin = inFileHandle
+		sandboxCmd.Stdin = inFileHandle
 	}
 
 	outFilePath := filepath.Join(runDir, outFile)
@@ -144,7 +134,8 @@ func executeProgram(execution Execution, inFile string, paramFile string, outFil
 			return
 		}
 	}()
-	cmd.Stdout = LimitWriter(outFileHandle, maxFileSize)
+	sandboxCmd.Stdout = outFileHandle
+	sandboxCmd.StdoutLimit = maxFileSize
 
 	errFilePath := filepath.Join(runDir, errFile)
 	errFileHandle, err := os.Create(errFilePath)
@@ -160,33 +151,35 @@ func executeProgram(execution Execution, inFile string, paramFile string, outFil
 			return
 		}
 	}()
-	cmd.Stderr = LimitWriter(errFileHandle, maxFileSize)
-
-	if err = cmd.Run(); err != nil {
-		if exiterr, ok := err.(*exec.ExitError); ok {
-			if status, ok := exiterr.Sys().(syscall.WaitStatus); ok {
-				if status.ExitStatus() == -1 { // killed
-					err = fmt.Errorf("Timeout")
-				}
-			}
-		}
+	sandboxCmd.Stderr = errFileHandle
+	sandboxCmd.StderrLimit = maxFileSize
 
+	if execution.ioSession != nil {
+		res, err = execution.ioSession.exec(sandboxCmd)
+	} else {
+		res, err = sandbox.Run(sandboxCmd)
+	}
+	if err != nil {
+		return
+	}
+	if res.TimedOut || res.OOMKilled {
+		err = fmt.Errorf("%s", sandboxLimitMessage(res))
 	}
 	return
 }
 
-func compareFileContent(expectedFile, outFile string, execution Execution) (expectedResult string, testOk bool, err error) {
+// compareFileContent compares the output with the CompareTool or the CompareMode of the test.
+// The diff is only computed for the CompareModes, the output of a CompareTool is returned as expected result.
+func compareFileContent(expectedFile, outFile string, execution Execution) (expectedResult string, testOk bool, diff *OutputDiff, err error) {
 	config := execution.Config
 	if config.CompareTool == "" {
-		return compareFileContentExactMatch(expectedFile, outFile)
+		if config.CompareMode == ExactMatch {
+			return compareFileContentExactMatch(expectedFile, outFile)
+		}
+		return compareFileContentMode(expectedFile, outFile, config)
 	}
 
-	var tool string
-	if filepath.IsAbs(*tools_folder) {
-		tool = filepath.Join(*tools_folder, config.CompareTool)
-	} else {
-		tool = filepath.Join(testdataDir, *tools_folder, config.CompareTool)
-	}
+	tool := compareToolPath(config.CompareTool)
 
 	args := make([]string, 0)
 	args = append(args, config.CompareToolArgs...)
@@ -196,178 +189,419 @@ func compareFileContent(expectedFile, outFile string, execution Execution) (expe
 	output, err := cmd.Output()
 	if err != nil {
 		if _, ok := err.(*exec.ExitError); ok {
-			return string(output), false, nil
+			return string(output), false, nil, nil
 		}
-		return "", false, err
+		return "", false, nil, err
+	}
+	return "", true, nil, nil
+}
+
+// compareToolPath returns the path of a CompareTool in the tools folder
+func compareToolPath(name string) string {
+	if filepath.IsAbs(*tools_folder) {
+		return filepath.Join(*tools_folder, name)
 	}
-	return "", true, nil
+	return filepath.Join(testdataDir, *tools_folder, name)
 }
 
-func compareFileContentExactMatch(expectedFile, outFile string) (expectedResult string, testOk bool, err error) {
+// compareFileContentExactMatch compares the files byte by byte, it returns the expected output and the diff if they differ
+func compareFileContentExactMatch(expectedFile, outFile string) (expectedResult string, testOk bool, diff *OutputDiff, err error) {
 	expected, err := readFile(expectedFile)
 	if err != nil {
-		return "", false, err
+		return "", false, nil, err
 	}
 	output, err := readFile(outFile)
 	if err != nil {
-		return "", false, err
+		return "", false, nil, err
 	}
 
-	outputLen := len(output)
-	expectedLen := len(expected)
-	if outputLen != expectedLen {
-		if outputLen > expectedLen && allEndLines(output[expectedLen:]) {
-			outputLen = expectedLen
-		} else if expectedLen > outputLen && allEndLines(expected[outputLen:]) {
-			// all right, shorter len already
-		} else {
-			return string(expected), false, nil
+	if !exactMatch(expected, output) {
+		return string(expected), false, diffOutput(expected, output, TestConfig{}), nil
+	}
+	return "", true, nil, nil
+}
+
+// ioSession starts one container for all cases of an IO test with the first case executed in it.
+// The cases share the /tmp folder and the processes of the container.
+// If a case does not stop or runs out of memory, the container is replaced and the following cases are executed in a new container.
+type ioSession struct {
+	sync.Mutex
+	sandbox  SessionSandbox
+	name     string
+	session  SandboxSession
+	err      error
+	restarts int
+}
+
+// sessionRetries is the number of times a case interrupted by the replacement of the container is executed again
+const sessionRetries = 2
+
+// exec executes the command of a case in the container of the session
+func (s *ioSession) exec(cmd SandboxCommand) (SandboxResult, error) {
+	for attempt := 0; ; attempt++ {
+		session, err := s.start(cmd)
+		if err != nil {
+			return SandboxResult{}, fmt.Errorf("Could not start container: %s", err)
 		}
+		res, err := session.Exec(cmd)
+		if !s.interrupted(session, res, err) {
+			if _, ok := err.(SessionStoppedError); ok {
+				// the case timed out
+				return res, nil
+			}
+			return res, err
+		}
+		// the result is not meaningful, the case is executed again in the new container
+		if attempt == sessionRetries || !rewindCommand(cmd) {
+			return SandboxResult{}, fmt.Errorf("Not run: the container was replaced %d times while the case was running", attempt+1)
+		}
+		Info.Printf("Executing %s again in a new container\n", cmd.Name)
 	}
+}
 
-	for i := 0; i < outputLen; i++ {
-		if output[i] != expected[i] {
-			return string(expected), false, nil
+// start returns the container of the session, it is started with the first command
+func (s *ioSession) start(cmd SandboxCommand) (SandboxSession, error) {
+	s.Lock()
+	defer s.Unlock()
+	if s.session == nil && s.err == nil {
+		start := cmd
+		start.Name = s.containerName()
+		// the environment is given to each command, the variables of a case must not leak into the other cases
+		start.Env = nil
+		s.session, s.err = s.sandbox.StartSession(start)
+		if s.err != nil {
+			LogError("test", "Could not start container %s: %s", start.Name, s.err)
 		}
 	}
+	return s.session, s.err
+}
 
-	return "", true, nil
+// interrupted replaces the container after a command which did not stop or ran out of memory,
+// as the container was stopped or its OOMKilled state stays set. It tells if the command was interrupted
+// by the replacement of the container while it was running, e.g. by a case executed in parallel.
+func (s *ioSession) interrupted(session SandboxSession, res SandboxResult, err error) bool {
+	s.Lock()
+	defer s.Unlock()
+	_, stopped := err.(SessionStoppedError)
+	if stopped || res.OOMKilled {
+		if s.session == session {
+			Info.Printf("Starting a new container for the remaining cases of %s\n", s.name)
+			s.closeSession()
+			s.restarts++
+		}
+		return false
+	}
+	return s.session != session
+}
+
+// rewindCommand resets the input and the output files of a command to execute it again, false if they cannot be reset
+func rewindCommand(cmd SandboxCommand) bool {
+	if cmd.Stdin != nil {
+		seeker, ok := cmd.Stdin.(io.Seeker)
+		if !ok {
+			return false
+		}
+		if _, err := seeker.Seek(0, io.SeekStart); err != nil {
+			return false
+		}
+	}
+	for _, w := range []io.Writer{cmd.Stdout, cmd.Stderr} {
+		if w == nil {
+			continue
+		}
+		f, ok := w.(interface {
+			io.Seeker
+			Truncate(size int64) error
+		})
+		if !ok || f.Truncate(0) != nil {
+			return false
+		}
+		if _, err := f.Seek(0, io.SeekStart); err != nil {
+			return false
+		}
+	}
+	return true
+}
+
+// containerName returns the name of the container, the containers started after a restart get a new name
+// as the stopped container might not be removed yet
+func (s *ioSession) containerName() string {
+	if s.restarts == 0 {
+		return s.name
+	}
+	return fmt.Sprintf("%s-%d", s.name, s.restarts)
+}
+
+// closeSession removes the container of the session, the caller holds the lock
+func (s *ioSession) closeSession() {
+	if s.session != nil {
+		if err := s.session.Close(); err != nil {
+			LogError("test", "Could not remove container %s: %s", s.containerName(), err)
+		}
+		s.session = nil
+	}
+}
+
+// close removes the container, if it was started
+func (s *ioSession) close() {
+	s.Lock()
+	defer s.Unlock()
+	s.closeSession()
 }
 
 type IOTestRunner struct {
 }
 
 func (t IOTestRunner) executeTest(execution Execution) TestResult {
-	testDir := execution.getTestDir()
-	files, err := ioutil.ReadDir(testDir)
+	cases, err := loadIOTestCases(execution.getTestDir())
 	if err != nil {
-		return internalErrorResult(execution, "Could not read test folder")
+		return internalErrorResult(execution, "Could not read test cases")
 	}
 
-	numTests := 0
-	numFailed := 0
-	tests := make([]Test, 0)
+	if *ioSessionFlag {
+		if s, ok := sandbox.(SessionSandbox); ok {
+			execution.ioSession = &ioSession{sandbox: s, name: execution.ID + "-io"}
+			defer execution.ioSession.close()
+		}
+	}
+	parallelism := execution.Config.Parallelism
+	if parallelism == 0 {
+		parallelism = *ioParallelism
+	}
+	if parallelism < 1 || execution.ioSession != nil {
+		// the cases of a session share the memory limit of the container, a case running out of memory
+		// could get a case executed in parallel killed
+		parallelism = 1
+	}
+
+	// the results keep the order of the cases, the progress is reported when a case finished
+	tests := make([]Test, len(cases))
 	startTime := time.Now()
-	for _, f := range files {
-		if !f.IsDir() && strings.HasSuffix(f.Name(), ".out.txt") {
-			fileBaseName := f.Name()[:len(f.Name())-8]
+	slots := make(chan struct{}, parallelism)
+	var wg sync.WaitGroup
+	for i, tc := range cases {
+		slots <- struct{}{}
+		wg.Add(1)
+		go func(i int, tc ioTestCase) {
+			defer wg.Done()
+			defer func() { <-slots }()
+			defer func() {
+				if err := recover(); err != nil {
+					fmt.Printf("Error in case %s of test execution %s\n", tc.Name, execution.ID)
+					fmt.Println("Recovered from error", err)
+					fmt.Println(errors.Wrap(err, 2).ErrorStack())
+					tests[i] = tc.present(Test{Name: tc.Name, Weight: tc.Weight, Output: "Internal error while executing the case"})
+					execution.reportTest(tests[i])
+				}
+			}()
+			tests[i] = runIOTestCase(execution, tc)
+			execution.reportTest(tests[i])
+		}(i, tc)
+	}
+	wg.Wait()
+	duration := time.Since(startTime)
 
-			test := Test{
-				Name:   fileBaseName,
-				Output: "",
-			}
+	numFailed := 0
+	weighted := false
+	var score, maxScore float64
+	for i, tc := range cases {
+		if tests[i].Success {
+			score += tc.weight()
+		} else {
+			numFailed++
+		}
+		maxScore += tc.weight()
+		weighted = weighted || tc.Weight != nil
+	}
+	testExecutionTimeHistogram.Observe(duration.Seconds())
+	if debug {
+		Debug.Printf("Duration of IO test execution: %s", duration)
+	}
 
-			inFileName := fileBaseName + ".in.txt"
-			inFile := filepath.Join(testDir, inFileName)
-			paramFileName := fileBaseName + ".param.txt"
-			paramFile := filepath.Join(testDir, paramFileName)
-			outFileName := fileBaseName + ".out.txt"
-			outFile := filepath.Join(execution.RunDir, outFileName)
-			errFileName := fileBaseName + ".err.txt"
-			errFile := filepath.Join(execution.RunDir, errFileName)
-			expectedFile := filepath.Join(testDir, outFileName)
-
-			numTests++
-			var execErr error
-
-			switch execution.Config.Compiler {
-			case JavaCompiler:
-				execErr = executeJava(execution, inFileName, paramFileName, outFileName, errFileName)
-			case CCompiler:
-				execErr = executeC(execution, inFileName, paramFileName, outFileName, errFileName)
-			case PythonCompiler:
-				execErr = executePython(execution, inFileName, paramFileName, outFileName, errFileName)
-			default:
-				LogError("test", "Execution not supported for compiler %s", _CompilerValueToName[execution.Config.Compiler])
-				execErr = fmt.Errorf("execution not supported for compiler %s", _CompilerValueToName[execution.Config.Compiler])
-			}
+	result := TestResult{
+		ID:            execution.ID,
+		Compiled:      true,
+		Tests:         tests,
+		TestsExecuted: len(cases),
+		TestsFailed:   numFailed}
+	if weighted {
+		result.Score = score
+		result.MaxScore = maxScore
+	}
+	return result
+}
 
-			// read in file
-			inFileContent, err := readFile(inFile)
-			if err != nil {
-				inFileContent = []byte("No input")
-			}
+// runIOTestCase executes the program with the input of the case and compares its output with the expected output
+func runIOTestCase(execution Execution, tc ioTestCase) Test {
+	testDir := execution.getTestDir()
+	test := Test{
+		Name:   tc.Name,
+		Output: "",
+		Weight: tc.Weight,
+	}
 
-			parameters := ""
-			if finfo, err := os.Stat(paramFile); err == nil && !finfo.IsDir() {
-				if paramBytes, err := ioutil.ReadFile(paramFile); err == nil {
-					parameters = " with parameters '" + string(paramBytes) + "'"
-				}
-			}
+	outFileName := tc.Name + ".out.txt"
+	outFile := filepath.Join(execution.RunDir, outFileName)
+	errFileName := tc.Name + ".err.txt"
+	errFile := filepath.Join(execution.RunDir, errFileName)
+
+	var execErr error
+	var execRes SandboxResult
+
+	switch execution.Config.Compiler {
+	case JavaCompiler:
+		execRes, execErr = executeJava(execution, tc, outFileName, errFileName)
+	case CCompiler:
+		execRes, execErr = executeC(execution, tc, outFileName, errFileName)
+	case PythonCompiler:
+		execRes, execErr = executePython(execution, tc, outFileName, errFileName)
+	default:
+		LogError("test", "Execution not supported for compiler %s", _CompilerValueToName[execution.Config.Compiler])
+		execErr = fmt.Errorf("execution not supported for compiler %s", _CompilerValueToName[execution.Config.Compiler])
+	}
 
-			test.Error = fmt.Sprintf("Error for the following input%s:\n%s", parameters, string(inFileContent))
+	parameters := ""
+	if len(tc.Args) > 0 {
+		parameters = " with parameters '" + strings.Join(tc.Args, " ") + "'"
+	}
+	test.Error = fmt.Sprintf("Error for the following input%s:\n%s", parameters, tc.input(testDir))
 
-			// read out file
-			outFileContent, err := readFile(outFile)
-			if err != nil {
-				outFileContent = []byte("")
-			}
-			test.Output += string(outFileContent)
+	// read out file
+	outFileContent, err := readFile(outFile)
+	if err != nil {
+		outFileContent = []byte("")
+	}
+	test.Output += string(outFileContent)
+
+	if execErr == nil {
+		exitCode := execRes.ExitCode
+		test.ExitCode = &exitCode
+		if tc.ExitCode == nil && exitCode != 0 {
+			// without an expected exit status the program has to succeed
+			execErr = fmt.Errorf("exit status %d", exitCode)
+		}
+	}
 
-			// read expectedFile
-			expectedFileContent, err := readFile(expectedFile)
-			if err != nil {
-				expectedFileContent = []byte("")
-			}
-			test.Expected += string(expectedFileContent)
+	expectedFile := ""
+	if tc.expectsStdout() {
+		file, cleanup, err := tc.expectedFile(testDir)
+		if err != nil {
+			test.Success = false
+			test.Output += fmt.Sprintf("\n\n\nError comparing results:\n%s\n", err.Error())
+			return tc.present(test)
+		}
+		defer cleanup()
+		expectedFile = file
+
+		// read expectedFile
+		expectedFileContent, err := readFile(expectedFile)
+		if err != nil {
+			expectedFileContent = []byte("")
+		}
+		test.Expected += string(expectedFileContent)
+	}
 
-			if execErr != nil {
-				test.Success = false
+	// read err file
+	errFileContent, err := readFile(errFile)
+	if err != nil {
+		errFileContent = []byte("")
+	}
 
-				// read err file
-				errFileContent, err := readFile(errFile)
-				if err != nil {
-					errFileContent = []byte("")
-				}
-				test.Output += fmt.Sprintf("\n\n\n%s\n%s\n", execErr.Error(), string(errFileContent))
-				tests = append(tests, test)
-				if debug {
-					Debug.Println(execErr)
-				}
-				numFailed++
-				continue
-			}
+	if execErr != nil {
+		test.Success = false
+		test.Timeout = execRes.TimedOut
+		test.MemoryExceeded = execRes.OOMKilled
+		test.Output += fmt.Sprintf("\n\n\n%s\n%s\n", execErr.Error(), string(errFileContent))
+		if debug {
+			Debug.Println(execErr)
+		}
+		return tc.present(test)
+	}
 
-			expectedResult, resultOk, execErr := compareFileContent(expectedFile, outFile, execution)
-			if execErr != nil {
-				test.Success = false
-				test.Output += fmt.Sprintf("\n\n\nError comparing results:\n%s\n", execErr.Error())
-				numFailed++
-				tests = append(tests, test)
-				continue
-			}
-			if !resultOk {
-				test.Success = false
+	if expectedFile != "" {
+		expectedResult, resultOk, diff, err := compareFileContent(expectedFile, outFile, execution)
+		if err != nil {
+			test.Success = false
+			test.Output += fmt.Sprintf("\n\n\nError comparing results:\n%s\n", err.Error())
+			return tc.present(test)
+		}
+		if !resultOk {
+			// get expected result from error
+			test.Expected = expectedResult
+			test.Mismatches = append(test.Mismatches, Mismatch{Check: CheckStdout, Diff: diff})
+		}
+	}
 
-				// get expected result from error
-				test.Expected = expectedResult
+	if tc.expectsStderr() {
+		expectedStderrFile, cleanup, err := tc.expectedStderrFile(testDir)
+		if err != nil {
+			test.Success = false
+			test.Output += fmt.Sprintf("\n\n\nError comparing results:\n%s\n", err.Error())
+			return tc.present(test)
+		}
+		defer cleanup()
+		// the CompareTool is only used for stdout, stderr is compared with the CompareMode (ExactMatch with a CompareTool)
+		expectedStderr, stderrOk, diff, err := compareFileContentMode(expectedStderrFile, errFile, execution.Config)
+		if err != nil {
+			test.Success = false
+			test.Output += fmt.Sprintf("\n\n\nError comparing results:\n%s\n", err.Error())
+			return tc.present(test)
+		}
+		if !stderrOk {
+			test.Mismatches = append(test.Mismatches, Mismatch{Check: CheckStderr, Expected: expectedStderr, Actual: string(errFileContent), Diff: diff})
+		}
+	}
 
-				tests = append(tests, test)
-				numFailed++
-				continue
-			}
+	if tc.ExitCode != nil && *tc.ExitCode != execRes.ExitCode {
+		test.Mismatches = append(test.Mismatches, Mismatch{
+			Check:    CheckExitCode,
+			Expected: strconv.Itoa(*tc.ExitCode),
+			Actual:   strconv.Itoa(execRes.ExitCode),
+		})
+	}
 
-			if errContent, err := readFile(errFile); err == nil {
-				test.Output += string(errContent)
-			}
+	if len(test.Mismatches) > 0 {
+		test.Success = false
+		return tc.present(test)
+	}
 
-			test.Success = true
-			test.Error = ""
-			tests = append(tests, test)
-		}
+	if !tc.expectsStderr() {
+		test.Output += string(errFileContent)
 	}
-	duration := time.Since(startTime)
-	testExecutionTimeHistogram.Observe(duration.Seconds())
-	if debug {
-		Debug.Printf("Duration of IO test execution: %s", duration)
+
+	test.Success = true
+	test.Error = ""
+	return tc.present(test)
+}
+
+// sandboxLimitMessage describes which limit was exceeded by a command in the sandbox
+func sandboxLimitMessage(res SandboxResult) string {
+	if res.TimedOut {
+		return "Timeout"
+	}
+	if res.OOMKilled {
+		return "Memory limit exceeded"
 	}
+	return ""
+}
 
+// sandboxLimitResult creates the result of a test run, which was aborted as a whole
+func sandboxLimitResult(execution Execution, res SandboxResult, message string) TestResult {
 	return TestResult{
 		ID:            execution.ID,
 		Compiled:      true,
-		Tests:         tests,
-		TestsExecuted: numTests,
-		TestsFailed:   numFailed}
+		TestsExecuted: 1,
+		TestsFailed:   1,
+		Tests: []Test{
+			{
+				Name:           "Testfälle",
+				Success:        false,
+				Error:          message,
+				Timeout:        res.TimedOut,
+				MemoryExceeded: res.OOMKilled,
+			},
+		},
+	}
 }
 
 func internalErrorResult(execution Execution, msg string) TestResult {
@@ -376,6 +610,7 @@ func internalErrorResult(execution Execution, msg string) TestResult {
 		ID:            execution.ID,
 		Compiled:      true,
 		InternalError: msg,
+		Error:         &ApiError{Code: ErrInternal, Message: msg, Phase: PhaseTest},
 	}
 }
 
@@ -440,7 +675,7 @@ func testService() {
 }
 
 func handleTestRequest() {
-	execution := <-testChannel
+	execution := testQueue.pop()
 	defer func() {
 		if err := recover(); err != nil {
 			fmt.Printf("Error in test execution: %+v\n", execution)
@@ -449,6 +684,7 @@ func handleTestRequest() {
 		}
 	}()
 	fmt.Printf("Executing test: %+v\n", execution)
+	execution.report(ProgressEvent{Type: EventTesting})
 	testResult := getRunner(execution.Config.TestType).executeTest(execution)
 	testCount.WithLabelValues(execution.Test).Add(float64(testResult.TestsExecuted))
 	testFailCount.WithLabelValues(execution.Test).Add(float64(testResult.TestsFailed))
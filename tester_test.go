@@ -0,0 +1,357 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeProgram emulates a program in the sandbox: it prints its input in upper case,
+// "exit <n>" writes to stderr and exits with n and "sleep" exceeds the timeout
+func fakeProgram(cmd SandboxCommand) (SandboxResult, error) {
+	args := cmd.Command[2:]
+	if len(args) == 2 && args[0] == "exit" {
+		code, _ := strconv.Atoi(args[1])
+		writeOutput(cmd.Stderr, cmd.StderrLimit, "boom\n")
+		return SandboxResult{ExitCode: code}, nil
+	}
+	if len(args) == 1 && args[0] == "sleep" {
+		return SandboxResult{ExitCode: -1, TimedOut: true}, nil
+	}
+	input, err := ioutil.ReadAll(cmd.Stdin)
+	if err != nil {
+		return SandboxResult{}, err
+	}
+	writeOutput(cmd.Stdout, cmd.StdoutLimit, strings.ToUpper(string(input)))
+	return SandboxResult{}, nil
+}
+
+const fakeManifest = `cases:
+  - name: upper
+    stdin: "hello\n"
+    stdout: "HELLO\n"
+    weight: 2
+  - name: wrong
+    stdin: "hello\n"
+    stdout: "HELLO\nWORLD\n"
+  - name: exit
+    args: [exit, "3"]
+    stderr: "boom\n"
+    exit_code: 3
+  - name: crash
+    args: [exit, "1"]
+    stdout: ""
+  - name: slow
+    args: [sleep]
+    stdout: ""
+    timeout: 1
+  - name: hidden
+    stdin: "secret\n"
+    stdout: "public\n"
+    hidden: true
+`
+
+// ioTestExecution creates an IO test of a Python program in a temporary test folder
+func ioTestExecution(t *testing.T, manifest string) Execution {
+	testdata := t.TempDir()
+	useTestdata(t, testdata)
+	testDir := filepath.Join(testdata, "py", "io")
+	if err := os.MkdirAll(testDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(testDir, "iotests.yaml"), []byte(manifest), 0644); err != nil {
+		t.Fatal(err)
+	}
+	runDir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(runDir, "main.py"), []byte("print(input().upper())\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return Execution{
+		ID:      "run",
+		RunDir:  runDir,
+		TestDir: testDir,
+		Test:    "py/io",
+		Config:  TestConfig{Compiler: PythonCompiler, TestType: IOTest},
+	}
+}
+
+func TestIOTestRunner(t *testing.T) {
+	fake := &fakeSandbox{run: fakeProgram}
+	useSandbox(t, fake)
+
+	result := IOTestRunner{}.executeTest(ioTestExecution(t, fakeManifest))
+	if result.Error != nil {
+		t.Fatalf("unexpected error %+v", result.Error)
+	}
+	if result.TestsExecuted != 6 || result.TestsFailed != 4 {
+		t.Errorf("%d executed, %d failed, want 6 executed and 4 failed", result.TestsExecuted, result.TestsFailed)
+	}
+	if result.Score != 3 || result.MaxScore != 7 {
+		t.Errorf("score %v of %v, want 3 of 7", result.Score, result.MaxScore)
+	}
+
+	tests := make(map[string]Test)
+	var names []string
+	for _, test := range result.Tests {
+		tests[test.Name] = test
+		names = append(names, test.Name)
+	}
+	if strings.Join(names, " ") != "upper wrong exit crash slow hidden" {
+		t.Errorf("results %v do not keep the order of the cases", names)
+	}
+
+	if upper := tests["upper"]; !upper.Success || upper.Output != "HELLO\n" || upper.Error != "" {
+		t.Errorf("upper: %+v", upper)
+	}
+
+	wrong := tests["wrong"]
+	if wrong.Success || len(wrong.Mismatches) != 1 || wrong.Mismatches[0].Check != CheckStdout {
+		t.Fatalf("wrong: %+v", wrong)
+	}
+	if diff := wrong.Mismatches[0].Diff; diff == nil || diff.Line != 2 || len(diff.Hunks) != 1 {
+		t.Errorf("wrong: diff %+v, want a hunk starting in line 2", diff)
+	}
+
+	if exit := tests["exit"]; !exit.Success || exit.ExitCode == nil || *exit.ExitCode != 3 {
+		t.Errorf("exit: %+v", exit)
+	}
+
+	crash := tests["crash"]
+	if crash.Success || !strings.Contains(crash.Output, "exit status 1") || !strings.Contains(crash.Output, "boom") {
+		t.Errorf("crash: %+v", crash)
+	}
+
+	if slow := tests["slow"]; slow.Success || !slow.Timeout {
+		t.Errorf("slow: %+v", slow)
+	}
+
+	hidden := tests["hidden"]
+	if hidden.Success || !hidden.Hidden || hidden.Output != "" || hidden.Expected != "" {
+		t.Errorf("hidden: %+v", hidden)
+	}
+	if len(hidden.Mismatches) != 1 || hidden.Mismatches[0] != (Mismatch{Check: CheckStdout}) {
+		t.Errorf("hidden: mismatches %+v, want only the check", hidden.Mismatches)
+	}
+}
+
+func TestIOTestRunnerCommands(t *testing.T) {
+	fake := &fakeSandbox{run: fakeProgram}
+	useSandbox(t, fake)
+
+	execution := ioTestExecution(t, `cases:
+  - name: env
+    args: [a, b]
+    env: {LANG: C}
+    stdin: "x"
+    stdout: "X"
+    timeout: 3
+`)
+	execution.Config.MaxMem = 50
+	result := IOTestRunner{}.executeTest(execution)
+	if result.TestsFailed != 0 {
+		t.Fatalf("unexpected result %+v", result)
+	}
+	if len(fake.commands) != 1 {
+		t.Fatalf("%d commands executed, want 1", len(fake.commands))
+	}
+	cmd := fake.commands[0]
+	if cmd.Name != "run-env" || cmd.WorkDir != "/code" || cmd.Mounts[0].Target != "/code" {
+		t.Errorf("unexpected command %+v", cmd)
+	}
+	if strings.Join(cmd.Command, " ") != "python3 main.py a b" {
+		t.Errorf("command = %v", cmd.Command)
+	}
+	if len(cmd.Env) != 1 || cmd.Env[0] != "LANG=C" {
+		t.Errorf("env = %v", cmd.Env)
+	}
+	if cmd.Timeout.Seconds() != 3 || cmd.MaxMem != 50 {
+		t.Errorf("limits = %s, %d MB, want the timeout of the case and the memory of the test", cmd.Timeout, cmd.MaxMem)
+	}
+}
+
+func TestIOTestRunnerSandboxError(t *testing.T) {
+	fake := &fakeSandbox{run: func(cmd SandboxCommand) (SandboxResult, error) {
+		return SandboxResult{}, os.ErrNotExist
+	}}
+	useSandbox(t, fake)
+
+	result := IOTestRunner{}.executeTest(ioTestExecution(t, `cases:
+  - name: one
+    stdout: "1"
+`))
+	if result.TestsFailed != 1 || result.Tests[0].Success || !strings.Contains(result.Tests[0].Output, os.ErrNotExist.Error()) {
+		t.Errorf("unexpected result %+v", result)
+	}
+}
+
+func TestIOTestRunnerStderrCompareMode(t *testing.T) {
+	useSandbox(t, &fakeSandbox{run: fakeProgram})
+	// the program writes "boom\n" to stderr
+	cases := []struct {
+		stderr  string
+		mode    CompareMode
+		success bool
+	}{
+		{"boom", ExactMatch, true},
+		{"BOOM", ExactMatch, false},
+		{"BOOM", IgnoreCase, true},
+		{"  boom  ", ExactMatch, false},
+		{"  boom  ", IgnoreWhitespace, true},
+		{"b.*m", ExactMatch, false},
+		{"b.*m", LineRegex, true},
+	}
+	for _, c := range cases {
+		execution := ioTestExecution(t, fmt.Sprintf("cases:\n  - {name: exit, args: [exit, \"3\"], stderr: %q, exit_code: 3}\n", c.stderr+"\n"))
+		execution.Config.CompareMode = c.mode
+		result := IOTestRunner{}.executeTest(execution)
+		if len(result.Tests) != 1 || result.Tests[0].Success != c.success {
+			t.Errorf("stderr %q with mode %v: result %+v, want success %v", c.stderr, c.mode, result.Tests, c.success)
+		}
+	}
+}
+
+func TestIOSessionRestart(t *testing.T) {
+	// slow runs until release is closed in the first container, hang stops the container and oom runs out of memory
+	release := make(chan struct{})
+	running := make(chan struct{})
+	s := &fakeSessionSandbox{exec: func(session string, cmd SandboxCommand) (SandboxResult, error) {
+		switch {
+		case cmd.Name == "hang":
+			return SandboxResult{ExitCode: -1, TimedOut: true}, SessionStoppedError{Command: cmd.Name}
+		case cmd.Name == "oom":
+			return SandboxResult{ExitCode: 137, OOMKilled: true}, nil
+		case cmd.Name == "slow" && session == "run-io":
+			io.Copy(ioutil.Discard, cmd.Stdin)
+			writeOutput(cmd.Stdout, 0, "partial")
+			close(running)
+			<-release
+			return SandboxResult{ExitCode: 137}, nil
+		}
+		if cmd.Stdin != nil {
+			io.Copy(cmd.Stdout, cmd.Stdin)
+		}
+		return SandboxResult{}, nil
+	}}
+	session := &ioSession{sandbox: s, name: "run-io"}
+	defer session.close()
+
+	if _, err := session.exec(SandboxCommand{Name: "first"}); err != nil {
+		t.Fatal(err)
+	}
+	stdout, err := ioutil.TempFile(t.TempDir(), "stdout")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer stdout.Close()
+	slow := make(chan error, 1)
+	go func() {
+		res, err := session.exec(SandboxCommand{Name: "slow", Stdin: strings.NewReader("input"), Stdout: stdout})
+		if err == nil && res.ExitCode != 0 {
+			err = fmt.Errorf("exit status %d", res.ExitCode)
+		}
+		slow <- err
+	}()
+	<-running
+	if res, err := session.exec(SandboxCommand{Name: "hang"}); err != nil || !res.TimedOut {
+		t.Errorf("hanging case: %+v, %v, want a timeout", res, err)
+	}
+	close(release)
+	// the case running in the stopped container is executed again in the new container
+	if err := <-slow; err != nil {
+		t.Errorf("interrupted case: %v", err)
+	}
+	if output, _ := ioutil.ReadFile(stdout.Name()); string(output) != "input" {
+		t.Errorf("output %q of the interrupted case, want the output of the second execution", output)
+	}
+	// the container which ran out of memory is replaced as well
+	if res, err := session.exec(SandboxCommand{Name: "oom"}); err != nil || !res.OOMKilled {
+		t.Errorf("case out of memory: %+v, %v", res, err)
+	}
+	if res, err := session.exec(SandboxCommand{Name: "next"}); err != nil || res.ExitCode != 0 {
+		t.Errorf("next case: %+v, %v", res, err)
+	}
+	if got := strings.Join(s.started, " "); got != "run-io run-io-1 run-io-2" {
+		t.Errorf("started sessions %s, want run-io run-io-1 run-io-2", got)
+	}
+	if got := strings.Join(s.closed, " "); got != "run-io run-io-1" {
+		t.Errorf("closed sessions %s, want run-io run-io-1", got)
+	}
+}
+
+func TestIOSessionRetries(t *testing.T) {
+	// every execution of the case is interrupted by replacing the container
+	var session *ioSession
+	s := &fakeSessionSandbox{exec: func(name string, cmd SandboxCommand) (SandboxResult, error) {
+		session.Lock()
+		session.closeSession()
+		session.restarts++
+		session.Unlock()
+		return SandboxResult{ExitCode: 137}, nil
+	}}
+	session = &ioSession{sandbox: s, name: "run-io"}
+	defer session.close()
+	_, err := session.exec(SandboxCommand{Name: "case", Stdin: strings.NewReader("input")})
+	if err == nil || !strings.HasPrefix(err.Error(), "Not run:") {
+		t.Errorf("error %v, want not run", err)
+	}
+	if len(s.started) != sessionRetries+1 {
+		t.Errorf("%d executions, want %d", len(s.started), sessionRetries+1)
+	}
+}
+
+func TestIOTestRunnerPanic(t *testing.T) {
+	useSandbox(t, &fakeSandbox{run: func(cmd SandboxCommand) (SandboxResult, error) {
+		if len(cmd.Command) > 2 && cmd.Command[2] == "panic" {
+			panic("sandbox failed")
+		}
+		return fakeProgram(cmd)
+	}})
+	execution := ioTestExecution(t, `cases:
+  - {name: panic, args: [panic], stdout: ""}
+  - {name: upper, stdin: "hello\n", stdout: "HELLO\n"}
+`)
+	execution.Config.Parallelism = 2
+	result := IOTestRunner{}.executeTest(execution)
+	if len(result.Tests) != 2 || result.Tests[0].Success || result.Tests[0].Output != "Internal error while executing the case" || !result.Tests[1].Success {
+		t.Errorf("tests %+v, want the failed case panic and the successful case upper", result.Tests)
+	}
+}
+
+func TestIOTestRunnerSessionSequential(t *testing.T) {
+	previous := *ioSessionFlag
+	*ioSessionFlag = true
+	t.Cleanup(func() { *ioSessionFlag = previous })
+	var mutex sync.Mutex
+	running, maxRunning := 0, 0
+	useSandbox(t, &fakeSessionSandbox{exec: func(session string, cmd SandboxCommand) (SandboxResult, error) {
+		mutex.Lock()
+		running++
+		if running > maxRunning {
+			maxRunning = running
+		}
+		mutex.Unlock()
+		time.Sleep(10 * time.Millisecond)
+		mutex.Lock()
+		running--
+		mutex.Unlock()
+		return fakeProgram(cmd)
+	}})
+	execution := ioTestExecution(t, `cases:
+  - {name: a, stdin: "a\n", stdout: "A\n"}
+  - {name: b, stdin: "b\n", stdout: "B\n"}
+  - {name: c, stdin: "c\n", stdout: "C\n"}
+`)
+	// the cases of a session share the memory of the container and are not executed in parallel
+	execution.Config.Parallelism = 3
+	result := IOTestRunner{}.executeTest(execution)
+	if result.TestsFailed != 0 || maxRunning != 1 {
+		t.Errorf("%d failed cases, %d cases in parallel, want 0 and 1", result.TestsFailed, maxRunning)
+	}
+}
@@ -0,0 +1,246 @@
+package main
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// solutionDir is the folder of a test with the solution checked by -testSolution
+const solutionDir = "_solution"
+
+// TestInfo describes a test for frontends, e.g. to show students which files they have to submit
+type TestInfo struct {
+	Test          string   `json:"test"`
+	Compiler      Compiler `json:"compiler"`
+	TestType      TestType `json:"test_type"`
+	MainIs        string   `json:"main_is,omitempty"`
+	RequiredFiles []string `json:"required_files"`
+	// AllowedFiles are regular expressions, each submitted file has to match one of them
+	AllowedFiles []string `json:"allowed_files"`
+	// Timeout (seconds) and MaxMem (MB) are left out if the defaults of the test type are used
+	Timeout          int    `json:"timeout,omitempty"`
+	MaxMem           int    `json:"max_mem,omitempty"`
+	UploadsDirectory string `json:"uploads_directory,omitempty"`
+	// TemplateFiles are the paths of the files in the template folder, which students may download
+	TemplateFiles []string `json:"template_files"`
+	// HasSolution tells if the test has a _solution folder, it is only returned to admins
+	HasSolution *bool `json:"has_solution,omitempty"`
+}
+
+// listFiles returns the paths of all files in dir relative to dir, an empty list if dir does not exist
+func listFiles(dir string) ([]string, error) {
+	files := []string{}
+	if !fileExists(dir) {
+		return files, nil
+	}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, filepath.ToSlash(rel))
+		return nil
+	})
+	sort.Strings(files)
+	return files, err
+}
+
+// HiddenFilesError is returned if a pattern of HiddenTemplateFiles is not a valid regular expression
+type HiddenFilesError struct {
+	Pattern string
+	Err     error
+}
+
+func (e HiddenFilesError) Error() string {
+	return fmt.Sprintf("Invalid pattern %s in HiddenTemplateFiles: %s", e.Pattern, e.Err)
+}
+
+// visibleTemplateFiles returns the files of the template folder of a test, which do not match HiddenTemplateFiles
+func visibleTemplateFiles(testdir string, config TestConfig) ([]string, error) {
+	var hidden []*regexp.Regexp
+	for _, pattern := range config.HiddenTemplateFiles {
+		r, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, HiddenFilesError{Pattern: pattern, Err: err}
+		}
+		hidden = append(hidden, r)
+	}
+	files, err := listFiles(filepath.Join(testdir, templateDir))
+	if err != nil {
+		return nil, err
+	}
+	visible := []string{}
+	for _, file := range files {
+		matches := false
+		for _, r := range hidden {
+			if r.MatchString(file) {
+				matches = true
+				break
+			}
+		}
+		if !matches {
+			visible = append(visible, file)
+		}
+	}
+	return visible, nil
+}
+
+// testInfo collects the description of the test in testdir
+func testInfo(testref string, testdir string, config TestConfig, caller Caller) (TestInfo, error) {
+	info := TestInfo{
+		Test:             filepath.ToSlash(testref),
+		Compiler:         config.Compiler,
+		TestType:         config.TestType,
+		MainIs:           config.MainIs,
+		RequiredFiles:    config.RequiredFiles,
+		AllowedFiles:     config.AllowedFiles,
+		Timeout:          config.Timeout,
+		MaxMem:           config.MaxMem,
+		UploadsDirectory: config.UploadsDirectory,
+	}
+	if info.RequiredFiles == nil {
+		info.RequiredFiles = []string{}
+	}
+	if info.AllowedFiles == nil {
+		info.AllowedFiles = []string{}
+	}
+	templateFiles, err := visibleTemplateFiles(testdir, config)
+	if err != nil {
+		return info, err
+	}
+	info.TemplateFiles = templateFiles
+	if caller.Admin {
+		hasSolution := fileExists(filepath.Join(testdir, solutionDir))
+		info.HasSolution = &hasSolution
+	}
+	return info, nil
+}
+
+// handleTestInfo returns the description of a single test: /tests/<test>, and its template files: /tests/<test>/template.zip
+func handleTestInfo(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Access-Control-Allow-Origin", "*")
+	if r.Method == "OPTIONS" {
+		w.WriteHeader(http.StatusOK)
+		return
+	}
+	if r.Method != "GET" {
+		rejectMethod(w, r, "GET")
+		LogError("listing", "Rejected %s request to tests from %s", r.Method, r.RemoteAddr)
+		return
+	}
+
+	caller, ok := authenticate(w, r, "listing")
+	if !ok {
+		return
+	}
+
+	testref := strings.Trim(strings.TrimPrefix(apiPath(r), "/tests/"), "/")
+	download := strings.HasSuffix(testref, "/"+templateZip)
+	testref = filepath.Clean(strings.TrimSuffix(testref, "/"+templateZip))
+	test, found := catalog.get(testref)
+	if !found || !caller.canAccess(testref) {
+		writeError(w, http.StatusNotFound, ApiError{
+			Code:    ErrTestNotFound,
+			Message: "Test not found",
+			Details: map[string]string{"test": testref},
+			Phase:   PhaseConfig,
+		})
+		return
+	}
+	if !test.valid() {
+		writeInvalidTestConfig(w, test)
+		LogError("listing", "%s", TestConfigError{Test: testref, Problems: test.Problems})
+		return
+	}
+	testdir, config := test.Dir, test.Config
+
+	if download {
+		sendTemplateZip(w, testref, testdir, config)
+		return
+	}
+	info, err := testInfo(testref, testdir, config, caller)
+	if err != nil {
+		writeTemplateError(w, testref, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/json")
+	enc := json.NewEncoder(w)
+	enc.Encode(info)
+}
+
+// templateZip is the name of the download of the template files of a test
+const templateZip = "template.zip"
+
+func writeTemplateError(w http.ResponseWriter, testref string, err error) {
+	if hiddenErr, ok := err.(HiddenFilesError); ok {
+		writeError(w, http.StatusInternalServerError, ApiError{
+			Code:    ErrInvalidTestConfig,
+			Message: hiddenErr.Error(),
+			Details: map[string]string{"test": testref, "pattern": hiddenErr.Pattern},
+			Phase:   PhaseConfig,
+		})
+	} else {
+		handleError(w, err)
+	}
+	LogError("listing", "Could not list template files of test %s: %s", testref, err)
+}
+
+// sendTemplateZip sends the template files of the test, which are not hidden, as zip archive
+func sendTemplateZip(w http.ResponseWriter, testref string, testdir string, config TestConfig) {
+	files, err := visibleTemplateFiles(testdir, config)
+	if err != nil {
+		writeTemplateError(w, testref, err)
+		return
+	}
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", strings.ReplaceAll(filepath.ToSlash(testref), "/", "-")+"-template.zip"))
+	archive := zip.NewWriter(w)
+	for _, file := range files {
+		if err := addFileToZip(archive, filepath.Join(testdir, templateDir, filepath.FromSlash(file)), file); err != nil {
+			// the response has already started, the client gets a broken archive
+			LogError("listing", "Could not add %s to the template of test %s: %s", file, testref, err)
+			return
+		}
+	}
+	if err := archive.Close(); err != nil {
+		LogError("listing", "Could not send the template of test %s: %s", testref, err)
+	}
+}
+
+func addFileToZip(archive *zip.Writer, path string, name string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	stat, err := f.Stat()
+	if err != nil {
+		return err
+	}
+	header, err := zip.FileInfoHeader(stat)
+	if err != nil {
+		return err
+	}
+	header.Name = name
+	header.Method = zip.Deflate
+	writer, err := archive.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(writer, f)
+	return err
+}
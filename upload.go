@@ -0,0 +1,287 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// IllegalFile is an uploaded file which was rejected
+type IllegalFile struct {
+	File   string `json:"file"`
+	Reason string `json:"reason"`
+}
+
+func (f IllegalFile) String() string {
+	return fmt.Sprintf("%s (%s)", f.File, f.Reason)
+}
+
+// IllegalFilesError is returned if uploaded files have invalid names or do not match AllowedFiles
+type IllegalFilesError struct {
+	Files []IllegalFile
+}
+
+func (e IllegalFilesError) Error() string {
+	names := make([]string, len(e.Files))
+	for i, file := range e.Files {
+		names[i] = file.String()
+	}
+	return "Files are not allowed: " + strings.Join(names, ", ")
+}
+
+// MissingFilesError is returned if files of RequiredFiles were not uploaded
+type MissingFilesError struct {
+	Files []string
+}
+
+func (e MissingFilesError) Error() string {
+	return "Required files are missing: " + strings.Join(e.Files, ", ")
+}
+
+// UploadLimitError is returned if the upload exceeds MaxFiles or MaxUploadBytes
+type UploadLimitError struct {
+	Limit  string `json:"limit"`
+	Max    int64  `json:"max"`
+	Actual int64  `json:"actual"`
+}
+
+func (e UploadLimitError) Error() string {
+	return fmt.Sprintf("Upload exceeds %s: %d > %d", e.Limit, e.Actual, e.Max)
+}
+
+// AllowedFilesError is returned if a pattern of AllowedFiles is not a valid regular expression
+type AllowedFilesError struct {
+	Pattern string
+	Err     error
+}
+
+func (e AllowedFilesError) Error() string {
+	return fmt.Sprintf("Invalid pattern %s in AllowedFiles: %s", e.Pattern, e.Err)
+}
+
+// uploadPath normalizes the name of an uploaded file to a relative path with / as separator.
+// If the name is not allowed, the reason is returned instead.
+func uploadPath(name string) (string, string) {
+	if strings.ContainsRune(name, 0) {
+		return "", "invalid character in file name"
+	}
+	name = strings.ReplaceAll(name, "\\", "/")
+	if strings.HasPrefix(name, "/") || (len(name) > 1 && name[1] == ':') {
+		return "", "absolute path"
+	}
+	cleaned := path.Clean(name)
+	if cleaned == "." || cleaned == "" {
+		return "", "empty file name"
+	}
+	if cleaned == ".." || strings.HasPrefix(cleaned, "../") {
+		return "", "path outside of the upload folder"
+	}
+	return cleaned, ""
+}
+
+// limitRequestBody limits the body of a submission request to -max_request_bytes,
+// so that a large upload is not read into memory and temporary files before its files are validated
+func limitRequestBody(w http.ResponseWriter, r *http.Request) {
+	if *maxRequestBytes > 0 {
+		r.Body = http.MaxBytesReader(w, r.Body, *maxRequestBytes)
+	}
+}
+
+// isRequestTooLarge tells if reading the body failed, because it exceeds -max_request_bytes
+func isRequestTooLarge(err error) bool {
+	return err != nil && strings.Contains(err.Error(), "http: request body too large")
+}
+
+// writeRequestTooLarge writes the error for a body exceeding -max_request_bytes
+func writeRequestTooLarge(w http.ResponseWriter) {
+	writeError(w, http.StatusRequestEntityTooLarge, ApiError{
+		Code:    ErrUploadTooLarge,
+		Message: fmt.Sprintf("Request exceeds %d bytes", *maxRequestBytes),
+		Details: map[string]interface{}{"limit": "max_request_bytes", "max": *maxRequestBytes},
+		Phase:   PhaseUpload,
+	})
+	LogError("upload", "Request exceeds %d bytes", *maxRequestBytes)
+}
+
+// uploadLimits returns the maximum number of files and bytes of a submission of the test
+func uploadLimits(config TestConfig) (maxFiles int, maxBytes int64) {
+	maxFiles, maxBytes = *maxFilesFlag, *maxUploadBytesFlag
+	if config.MaxFiles > 0 {
+		maxFiles = config.MaxFiles
+	}
+	if config.MaxUploadBytes > 0 {
+		maxBytes = config.MaxUploadBytes
+	}
+	return maxFiles, maxBytes
+}
+
+// compileAllowedFiles compiles the regular expressions of AllowedFiles
+func compileAllowedFiles(config TestConfig) ([]*regexp.Regexp, error) {
+	var allowed []*regexp.Regexp
+	for _, pattern := range config.AllowedFiles {
+		r, err := regexp.Compile(pattern)
+		if err != nil {
+			return nil, AllowedFilesError{Pattern: pattern, Err: err}
+		}
+		allowed = append(allowed, r)
+	}
+	return allowed, nil
+}
+
+// validateUploads checks the files of a submission against the limits, RequiredFiles and AllowedFiles (compiled as allowed) of the test.
+// It returns the files with normalized names and decoded content.
+func validateUploads(files []SubmittedFile, config TestConfig, allowed []*regexp.Regexp) ([]SubmittedFile, error) {
+	maxFiles, maxBytes := uploadLimits(config)
+	if maxFiles > 0 && len(files) > maxFiles {
+		return nil, UploadLimitError{Limit: "MaxFiles", Max: int64(maxFiles), Actual: int64(len(files))}
+	}
+
+	var illegal []IllegalFile
+	valid := make([]SubmittedFile, 0, len(files))
+	uploaded := make([]string, 0, len(files)) // the names of the valid files as uploaded
+	names := make(map[string]bool)
+	var size int64
+	for _, file := range files {
+		name, reason := uploadPath(file.Name)
+		if reason == "" && names[name] {
+			reason = "duplicate file"
+		}
+		content, err := file.bytes()
+		if reason == "" && err != nil {
+			reason = err.Error()
+		}
+		if reason != "" {
+			illegal = append(illegal, IllegalFile{File: file.Name, Reason: reason})
+			continue
+		}
+		names[name] = true
+		size += int64(len(content))
+		valid = append(valid, SubmittedFile{Name: name, Content: string(content)})
+		uploaded = append(uploaded, file.Name)
+	}
+	// a file cannot be written into a folder which is uploaded as a file, e.g. a/b and a
+	for i, file := range valid {
+		for dir := path.Dir(file.Name); dir != "."; dir = path.Dir(dir) {
+			if names[dir] {
+				illegal = append(illegal, IllegalFile{File: uploaded[i], Reason: fmt.Sprintf("folder %s is also uploaded as a file", dir)})
+				break
+			}
+		}
+	}
+	if maxBytes > 0 && size > maxBytes {
+		return nil, UploadLimitError{Limit: "MaxUploadBytes", Max: maxBytes, Actual: size}
+	}
+	if len(illegal) > 0 {
+		return nil, IllegalFilesError{Files: illegal}
+	}
+
+	//check if all required files are uploaded
+	var missingFiles []string
+	for _, required := range config.RequiredFiles {
+		if !names[required] {
+			missingFiles = append(missingFiles, required)
+		}
+	}
+	if len(missingFiles) > 0 {
+		return nil, MissingFilesError{Files: missingFiles}
+	}
+
+	//check if all files match a regexp
+	if len(allowed) > 0 {
+		for _, file := range valid {
+			matches := false
+			for _, r := range allowed {
+				if r.MatchString(file.Name) {
+					matches = true
+					break
+				}
+			}
+			if !matches {
+				illegal = append(illegal, IllegalFile{File: file.Name, Reason: "does not match AllowedFiles"})
+			}
+		}
+		if len(illegal) > 0 {
+			return nil, IllegalFilesError{Files: illegal}
+		}
+	}
+	return valid, nil
+}
+
+// uploadApiError returns the status and error sent for an error of validateUploads
+func uploadApiError(err error) (int, ApiError) {
+	switch err := err.(type) {
+	case UploadLimitError:
+		code := ErrTooManyFiles
+		if err.Limit == "MaxUploadBytes" {
+			code = ErrUploadTooLarge
+		}
+		return http.StatusRequestEntityTooLarge, ApiError{Code: code, Message: err.Error(), Details: err, Phase: PhaseUpload}
+	case IllegalFilesError:
+		return http.StatusUnprocessableEntity, ApiError{
+			Code:    ErrIllegalFiles,
+			Message: err.Error(),
+			Details: map[string][]IllegalFile{"illegal_files": err.Files},
+			Phase:   PhaseUpload,
+		}
+	case MissingFilesError:
+		return http.StatusUnprocessableEntity, ApiError{
+			Code:    ErrMissingFiles,
+			Message: err.Error(),
+			Details: map[string][]string{"missing_files": err.Files},
+			Phase:   PhaseUpload,
+		}
+	}
+	return http.StatusInternalServerError, ApiError{Code: ErrInternal, Message: err.Error(), Phase: PhaseUpload}
+}
+
+// legacyUploadResult returns the result sent by the endpoints older than /v2 for missing and illegal files,
+// which answer them with a result listing the files (the illegal files with the reason) instead of an error
+func legacyUploadResult(id string, err error) (TestResult, bool) {
+	switch err := err.(type) {
+	case IllegalFilesError:
+		illegal := make([]string, len(err.Files))
+		for i, file := range err.Files {
+			illegal[i] = file.String()
+		}
+		return TestResult{ID: id, Compiled: false, IllegalFiles: illegal}, true
+	case MissingFilesError:
+		return TestResult{ID: id, Compiled: false, MissingFiles: err.Files}, true
+	}
+	return TestResult{}, false
+}
+
+// writeUpload writes an uploaded file into the upload folder. Symbolic links leading outside of the folder are not followed.
+func writeUpload(uploadFolder string, file SubmittedFile) error {
+	target := filepath.Join(uploadFolder, filepath.FromSlash(file.Name))
+	// files of archives keep their folders
+	if err := os.MkdirAll(filepath.Dir(target), os.ModePerm); err != nil {
+		return err
+	}
+	root, err := filepath.EvalSymlinks(uploadFolder)
+	if err != nil {
+		return err
+	}
+	dir, err := filepath.EvalSymlinks(filepath.Dir(target))
+	if err != nil {
+		return err
+	}
+	if rel, err := filepath.Rel(root, dir); err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Errorf("%s is outside of the upload folder", file.Name)
+	}
+	if stat, err := os.Lstat(target); err == nil && !stat.Mode().IsRegular() {
+		return fmt.Errorf("%s is not a regular file", file.Name)
+	}
+	f, err := os.OpenFile(target, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	_, err = f.WriteString(file.Content)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
@@ -0,0 +1,336 @@
+package main
+
+import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestUploadPath(t *testing.T) {
+	cases := []struct {
+		name   string
+		path   string
+		reason string
+	}{
+		{"main.py", "main.py", ""},
+		{"src/de/Main.java", "src/de/Main.java", ""},
+		{"./src//Main.java", "src/Main.java", ""},
+		{"src/../Main.java", "Main.java", ""},
+		{"src\\Main.java", "src/Main.java", ""},
+		{"..hidden.py", "..hidden.py", ""},
+		{"/etc/passwd", "", "absolute path"},
+		{"\\Windows\\win.ini", "", "absolute path"},
+		{"C:\\Windows\\win.ini", "", "absolute path"},
+		{"c:main.py", "", "absolute path"},
+		{"..", "", "path outside of the upload folder"},
+		{"../main.py", "", "path outside of the upload folder"},
+		{"src/../../main.py", "", "path outside of the upload folder"},
+		{"..\\..\\main.py", "", "path outside of the upload folder"},
+		{"./../main.py", "", "path outside of the upload folder"},
+		{"", "", "empty file name"},
+		{".", "", "empty file name"},
+		{"src/..", "", "empty file name"},
+		{"main\x00.py", "", "invalid character in file name"},
+	}
+	for _, c := range cases {
+		path, reason := uploadPath(c.name)
+		if path != c.path || reason != c.reason {
+			t.Errorf("uploadPath(%q) = %q, %q, want %q, %q", c.name, path, reason, c.path, c.reason)
+		}
+	}
+}
+
+func TestValidateUploads(t *testing.T) {
+	file := func(name string, content string) SubmittedFile {
+		return SubmittedFile{Name: name, Content: content}
+	}
+	cases := []struct {
+		name   string
+		files  []SubmittedFile
+		config TestConfig
+		want   string // normalized names or the error
+	}{
+		{"valid", []SubmittedFile{file("src\\Main.java", "x"), file("./Util.java", "y")}, TestConfig{}, "src/Main.java Util.java"},
+		{"traversal", []SubmittedFile{file("../Main.java", "x"), file("/tmp/Util.java", "y")}, TestConfig{},
+			"Files are not allowed: ../Main.java (path outside of the upload folder), /tmp/Util.java (absolute path)"},
+		{"duplicate", []SubmittedFile{file("Main.java", "x"), file("src/../Main.java", "y")}, TestConfig{},
+			"Files are not allowed: src/../Main.java (duplicate file)"},
+		{"file and folder", []SubmittedFile{file("src", "x"), file("src/Main.java", "y"), file("./src/de/Util.java", "z"), file("srcs/A.java", "")}, TestConfig{},
+			"Files are not allowed: src/Main.java (folder src is also uploaded as a file), ./src/de/Util.java (folder src is also uploaded as a file)"},
+		{"encoding", []SubmittedFile{{Name: "a.bin", Content: "%%%", Encoding: "base64"}}, TestConfig{},
+			"Files are not allowed: a.bin (illegal base64 data at input byte 0)"},
+		{"max files", []SubmittedFile{file("a", ""), file("b", ""), file("c", "")}, TestConfig{MaxFiles: 2},
+			"Upload exceeds MaxFiles: 3 > 2"},
+		{"max bytes", []SubmittedFile{file("a", "1234"), file("b", "56")}, TestConfig{MaxUploadBytes: 5},
+			"Upload exceeds MaxUploadBytes: 6 > 5"},
+		{"missing", []SubmittedFile{file("Util.java", "")}, TestConfig{RequiredFiles: []string{"Main.java", "Util.java"}},
+			"Required files are missing: Main.java"},
+		{"not allowed", []SubmittedFile{file("Main.java", ""), file("src/Evil.sh", "")}, TestConfig{AllowedFiles: []string{`^[^/]+\.java$`}},
+			"Files are not allowed: src/Evil.sh (does not match AllowedFiles)"},
+		// AllowedFiles is matched against the normalized names
+		{"allowed normalized", []SubmittedFile{file("./Main.java", "")}, TestConfig{AllowedFiles: []string{`^Main\.java$`}}, "Main.java"},
+	}
+	for _, c := range cases {
+		allowed, err := compileAllowedFiles(c.config)
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got string
+		files, err := validateUploads(c.files, c.config, allowed)
+		if err != nil {
+			got = err.Error()
+		} else {
+			names := make([]string, len(files))
+			for i, file := range files {
+				names[i] = file.Name
+			}
+			got = strings.Join(names, " ")
+		}
+		if got != c.want {
+			t.Errorf("%s: got %q, want %q", c.name, got, c.want)
+		}
+	}
+
+	if _, err := compileAllowedFiles(TestConfig{AllowedFiles: []string{"("}}); err == nil {
+		t.Errorf("invalid pattern in AllowedFiles accepted")
+	} else if _, ok := err.(AllowedFilesError); !ok {
+		t.Errorf("error %T, want AllowedFilesError", err)
+	}
+}
+
+func TestWriteUploadSymlinks(t *testing.T) {
+	dir := t.TempDir()
+	uploads := filepath.Join(dir, "uploads")
+	outside := filepath.Join(dir, "outside")
+	for _, folder := range []string{filepath.Join(uploads, "src"), outside} {
+		if err := os.MkdirAll(folder, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	secret := filepath.Join(outside, "secret.txt")
+	if err := ioutil.WriteFile(secret, []byte("secret"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	// links in the upload folder, e.g. from the template files of a test
+	links := map[string]string{"out": outside, "secret.txt": secret, "inside": filepath.Join(uploads, "src")}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(uploads, name)); err != nil {
+			t.Skipf("symbolic links are not supported: %s", err)
+		}
+	}
+
+	cases := []struct {
+		name string
+		ok   bool
+	}{
+		{"main.py", true},
+		{"src/Main.java", true},
+		{"new/folder/Main.java", true},
+		{"inside/Util.java", true},
+		{"out/secret.txt", false},
+		{"out/new.txt", false},
+		{"secret.txt", false},
+	}
+	for _, c := range cases {
+		err := writeUpload(uploads, SubmittedFile{Name: c.name, Content: "evil"})
+		if (err == nil) != c.ok {
+			t.Errorf("writeUpload(%s): %v, want success %v", c.name, err, c.ok)
+		}
+	}
+	if content, _ := ioutil.ReadFile(secret); string(content) != "secret" {
+		t.Errorf("file outside of the upload folder overwritten: %q", content)
+	}
+	if _, err := os.Stat(filepath.Join(outside, "new.txt")); !os.IsNotExist(err) {
+		t.Errorf("file created outside of the upload folder")
+	}
+	if content, _ := ioutil.ReadFile(filepath.Join(uploads, "src", "Util.java")); string(content) != "evil" {
+		t.Errorf("file not written through the link inside the upload folder")
+	}
+}
+
+// zipArchive creates a zip archive with the files, names ending in / are folders and names ending in @ symbolic links
+func zipArchive(t testing.TB, files ...string) SubmittedFile {
+	var buf bytes.Buffer
+	w := zip.NewWriter(&buf)
+	for _, name := range files {
+		header := &zip.FileHeader{Name: name, Method: zip.Store}
+		content := "content"
+		if strings.HasSuffix(name, "@") {
+			header.Name = strings.TrimSuffix(name, "@")
+			header.SetMode(os.ModeSymlink | 0777)
+			content = "/etc/passwd"
+		}
+		f, err := w.CreateHeader(header)
+		if err != nil {
+			t.Fatal(err)
+		}
+		f.Write([]byte(content))
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return SubmittedFile{Name: "upload.zip", Content: buf.String()}
+}
+
+// tarGzArchive creates a tar.gz archive with the files, names ending in / are folders and names ending in @ symbolic links
+func tarGzArchive(t testing.TB, files ...string) SubmittedFile {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	w := tar.NewWriter(gz)
+	for _, name := range files {
+		header := &tar.Header{Name: name, Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len("content"))}
+		switch {
+		case strings.HasSuffix(name, "@"):
+			header = &tar.Header{Name: strings.TrimSuffix(name, "@"), Typeflag: tar.TypeSymlink, Linkname: "/etc/passwd", Mode: 0777}
+		case strings.HasSuffix(name, "/"):
+			header = &tar.Header{Name: name, Typeflag: tar.TypeDir, Mode: 0755}
+		}
+		if err := w.WriteHeader(header); err != nil {
+			t.Fatal(err)
+		}
+		if header.Typeflag == tar.TypeReg {
+			w.Write([]byte("content"))
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	gz.Close()
+	return SubmittedFile{Name: "upload.tar.gz", Content: buf.String()}
+}
+
+func TestExtractArchiveZipSlip(t *testing.T) {
+	cases := []struct {
+		name  string
+		files []string
+		want  string // extracted names or the error
+	}{
+		{"valid", []string{"src/", "src/Main.java", "./Util.java"}, "src/Main.java Util.java"},
+		{"parent", []string{"../evil.sh"}, "Invalid archive entry ../evil.sh: path outside of the upload folder"},
+		{"nested parent", []string{"src/../../evil.sh"}, "Invalid archive entry src/../../evil.sh: path outside of the upload folder"},
+		{"backslashes", []string{"..\\evil.sh"}, "Invalid archive entry ..\\evil.sh: path outside of the upload folder"},
+		{"absolute", []string{"/etc/cron.d/evil"}, "Invalid archive entry /etc/cron.d/evil: absolute path"},
+		{"parent folder", []string{"../"}, "Invalid archive entry ../: path outside of the upload folder"},
+		{"symlink", []string{"passwd@"}, "Invalid archive entry passwd: not a regular file (symbolic links are not allowed)"},
+	}
+	for _, c := range cases {
+		for _, archive := range []SubmittedFile{zipArchive(t, c.files...), tarGzArchive(t, c.files...)} {
+			var got string
+			files, err := extractArchive(archive, archiveLimits{})
+			if err != nil {
+				got = err.Error()
+			} else {
+				names := make([]string, len(files))
+				for i, file := range files {
+					names[i] = file.Name
+				}
+				got = strings.Join(names, " ")
+			}
+			if got != c.want {
+				t.Errorf("%s in %s: got %q, want %q", c.name, archive.Name, got, c.want)
+			}
+		}
+	}
+}
+
+// checkAcceptedPath fails the test if an accepted path is not relative or leaves the upload folder
+func checkAcceptedPath(t *testing.T, name string, p string) {
+	uploads := filepath.Join(os.TempDir(), "uploads")
+	target := filepath.Clean(filepath.Join(uploads, filepath.FromSlash(p)))
+	if p == "" || path.IsAbs(p) || filepath.IsAbs(filepath.FromSlash(p)) || strings.Contains(p, "\\") || p != path.Clean(p) {
+		t.Errorf("%q accepted as %q, which is not a clean relative path", name, p)
+	}
+	if !strings.HasPrefix(target, uploads+string(filepath.Separator)) {
+		t.Errorf("%q accepted as %q, which leads to %s outside of %s", name, p, target, uploads)
+	}
+}
+
+func FuzzUploadPath(f *testing.F) {
+	for _, name := range []string{"main.py", "src/de/Main.java", "./src//Main.java", "src/../Main.java", "..\\..\\main.py",
+		"/etc/passwd", "C:\\Windows\\win.ini", "c:main.py", "..hidden.py", "src/..", "main\x00.py", "a/./../../b"} {
+		f.Add(name)
+	}
+	f.Fuzz(func(t *testing.T, name string) {
+		p, reason := uploadPath(name)
+		if reason == "" {
+			checkAcceptedPath(t, name, p)
+		} else if p != "" {
+			t.Errorf("%q rejected (%s), but returned %q", name, reason, p)
+		}
+	})
+}
+
+func FuzzExtractArchive(f *testing.F) {
+	for _, files := range [][]string{{"src/", "src/Main.java", "./Util.java"}, {"../evil.sh"}, {"..\\evil.sh"}, {"/etc/cron.d/evil"}, {"passwd@"}} {
+		f.Add([]byte(zipArchive(f, files...).Content))
+		f.Add([]byte(tarGzArchive(f, files...).Content))
+	}
+	f.Fuzz(func(t *testing.T, data []byte) {
+		files, err := extractArchive(SubmittedFile{Name: "upload", Content: string(data)}, archiveLimits{maxBytes: 1 << 20, maxEntries: 100})
+		if err != nil {
+			if _, ok := err.(ArchiveError); !ok {
+				t.Errorf("error %T, want ArchiveError: %s", err, err)
+			}
+			return
+		}
+		for _, file := range files {
+			checkAcceptedPath(t, file.Name, file.Name)
+		}
+	})
+}
+
+func TestRequestTooLarge(t *testing.T) {
+	previous := *maxRequestBytes
+	*maxRequestBytes = 1024
+	t.Cleanup(func() { *maxRequestBytes = previous })
+
+	multipartBody := func(size int) (string, string) {
+		var buf bytes.Buffer
+		w := multipart.NewWriter(&buf)
+		w.WriteField("test", "course/io")
+		part, _ := w.CreateFormFile("files", "main.py")
+		part.Write(bytes.Repeat([]byte("#"), size))
+		w.Close()
+		return buf.String(), w.FormDataContentType()
+	}
+	small, smallType := multipartBody(100)
+	large, largeType := multipartBody(4096)
+	json := `{"test":"course/io","files":[{"name":"main.py","content":"` + strings.Repeat("#", 4096) + `"}]}`
+
+	cases := []struct {
+		name        string
+		parse       func(w http.ResponseWriter, r *http.Request) (SubmissionRequest, bool)
+		body        string
+		contentType string
+		status      int
+	}{
+		{"v2 multipart", parseSubmissionRequest, small, smallType, http.StatusOK},
+		{"v2 large multipart", parseSubmissionRequest, large, largeType, http.StatusRequestEntityTooLarge},
+		{"v2 large JSON", parseSubmissionRequest, json, "application/json", http.StatusRequestEntityTooLarge},
+		{"form", parseFormSubmission, small, smallType, http.StatusOK},
+		{"large form", parseFormSubmission, large, largeType, http.StatusRequestEntityTooLarge},
+	}
+	for _, c := range cases {
+		w := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", "/v2/submissions", strings.NewReader(c.body))
+		r.Header.Set("Content-Type", c.contentType)
+		_, ok := c.parse(w, r)
+		if ok != (c.status == http.StatusOK) || w.Code != c.status {
+			t.Errorf("%s: accepted %v with status %d, want %d: %s", c.name, ok, w.Code, c.status, w.Body.String())
+			continue
+		}
+		if c.status != http.StatusOK && !strings.Contains(w.Body.String(), string(ErrUploadTooLarge)) {
+			t.Errorf("%s: error %s, want %s", c.name, w.Body.String(), ErrUploadTooLarge)
+		}
+	}
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// hasFileWithSuffix tells if one of the folders contains a file with the suffix, folders which do not exist are skipped
+func hasFileWithSuffix(suffix string, dirs ...string) bool {
+	for _, dir := range dirs {
+		files, err := ioutil.ReadDir(dir)
+		if err != nil {
+			continue
+		}
+		for _, f := range files {
+			if !f.IsDir() && strings.HasSuffix(f.Name(), suffix) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// checkTestFiles returns the problems of the files the configuration of the test in dir refers to.
+// Missing files (test cases, test classes, the CompareTool) and unused case files are only errors with strict,
+// the server reports them as warnings and only rejects tests with files it cannot read.
+func checkTestFiles(dir string, config TestConfig, strict bool) []ConfigProblem {
+	var problems []ConfigProblem
+	severity := SeverityWarning
+	if strict {
+		severity = SeverityError
+	}
+	// the test runners copy the files of the test folder, the compilers the files of resources and template
+	sources := []string{dir, filepath.Join(dir, resourcedir), filepath.Join(dir, templateDir)}
+
+	switch config.TestType {
+	case IOTest:
+		if manifest := ioTestManifestPath(dir); manifest != "" {
+			cases, err := loadIOTestManifest(dir, manifest)
+			if err != nil {
+				problems = append(problems, ConfigProblem{Message: err.Error(), Severity: SeverityError})
+			} else if len(cases) == 0 {
+				problems = append(problems, ConfigProblem{Message: fmt.Sprintf("%s has no test cases", filepath.Base(manifest)), Severity: severity})
+			}
+			break
+		}
+		files, err := ioutil.ReadDir(dir)
+		if err != nil {
+			return append(problems, ConfigProblem{Message: err.Error(), Severity: SeverityError})
+		}
+		names := make(map[string]bool)
+		for _, f := range files {
+			names[f.Name()] = true
+		}
+		cases := 0
+		for _, f := range files {
+			name := f.Name()
+			if f.IsDir() {
+				continue
+			}
+			if strings.HasSuffix(name, ".out.txt") {
+				cases++
+				continue
+			}
+			for _, suffix := range []string{".in.txt", ".param.txt", ".stderr.txt", ".exit.txt"} {
+				if strings.HasSuffix(name, suffix) && !names[strings.TrimSuffix(name, suffix)+".out.txt"] {
+					problems = append(problems, ConfigProblem{
+						Message:  fmt.Sprintf("%s is not used, there is no %s.out.txt", name, strings.TrimSuffix(name, suffix)),
+						Severity: severity,
+					})
+				}
+			}
+		}
+		if cases == 0 {
+			problems = append(problems, ConfigProblem{Field: "TestType", Message: "The IOTest has no test cases (.out.txt files)", Severity: severity})
+		} else if _, err := ioTestCasesFromFiles(dir); err != nil {
+			problems = append(problems, ConfigProblem{Message: err.Error(), Severity: SeverityError})
+		}
+	case JUnitTest:
+		if !hasFileWithSuffix(".java", sources...) {
+			problems = append(problems, ConfigProblem{
+				Field:    "TestType",
+				Message:  "The JUnitTest has no test class, neither in the test folder nor in resources or template",
+				Severity: severity,
+			})
+		}
+	case xUnitTest:
+		if !hasFileWithSuffix(".fs", sources...) {
+			problems = append(problems, ConfigProblem{
+				Field:    "TestType",
+				Message:  "The xUnitTest has no .fs files, neither in the test folder nor in resources or template",
+				Severity: severity,
+			})
+		}
+		if !hasFileWithSuffix(".fsproj", sources...) {
+			problems = append(problems, ConfigProblem{
+				Field:    "TestType",
+				Message:  "The xUnitTest has no .fsproj project file, neither in the test folder nor in resources or template",
+				Severity: severity,
+			})
+		}
+	}
+
+	if config.CompareTool != "" {
+		tool := compareToolPath(config.CompareTool)
+		if stat, err := os.Stat(tool); err != nil {
+			problems = append(problems, ConfigProblem{Field: "CompareTool", Message: fmt.Sprintf("CompareTool %s not found", tool), Severity: severity})
+		} else if !stat.Mode().IsRegular() || stat.Mode()&0111 == 0 {
+			problems = append(problems, ConfigProblem{Field: "CompareTool", Message: fmt.Sprintf("CompareTool %s is not executable", tool), Severity: severity})
+		}
+	}
+	return problems
+}
+
+// ValidationReport is the result of the validate command
+type ValidationReport struct {
+	Tests    []CatalogEntry `json:"tests"`
+	Errors   int            `json:"errors"`
+	Warnings int            `json:"warnings"`
+}
+
+// runValidate checks the configurations of all tests in the testdata folder and returns the exit status:
+// 1 if a test has errors (including unknown fields) or warnings with -strict, 2 if the tests cannot be read.
+func runValidate(args []string) int {
+	flags := flag.NewFlagSet("validate", flag.ExitOnError)
+	jsonOutput := flags.Bool("json", false, "Print the problems as JSON, e.g. for CI pipelines.")
+	strict := flags.Bool("strict", false, "Fail on warnings, too.")
+	flags.Usage = func() {
+		fmt.Fprintf(flags.Output(), "Usage: rte-go [-basedir <path>] [-testdata_folder <path>] validate [-json] [-strict]\n")
+		flags.PrintDefaults()
+	}
+	flags.Parse(args)
+
+	// unlike the server, which ignores unknown fields, the command reports them as errors
+	tests, err := findTests(testdataDir, true)
+	if err != nil {
+		fmt.Fprintf(os.Stderr, "Could not read tests in %s: %s\n", testdataDir, err)
+		return 2
+	}
+
+	report := ValidationReport{Tests: []CatalogEntry{}}
+	for _, test := range tests {
+		report.Tests = append(report.Tests, CatalogEntry{Test: filepath.ToSlash(test.Ref), Valid: test.valid(), Problems: test.Problems})
+		for _, problem := range test.Problems {
+			if problem.Severity == SeverityError {
+				report.Errors++
+			} else {
+				report.Warnings++
+			}
+		}
+	}
+
+	if *jsonOutput {
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		enc.Encode(report)
+	} else {
+		for _, entry := range report.Tests {
+			for _, problem := range entry.Problems {
+				field := ""
+				if problem.Field != "" {
+					field = problem.Field + ": "
+				}
+				fmt.Printf("%s: %s: %s%s\n", entry.Test, problem.Severity, field, problem.Message)
+			}
+		}
+		fmt.Printf("%d tests, %d errors, %d warnings\n", len(report.Tests), report.Errors, report.Warnings)
+	}
+
+	if report.Errors > 0 || (*strict && report.Warnings > 0) {
+		return 1
+	}
+	return 0
+}
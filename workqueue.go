@@ -0,0 +1,137 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Priority of an execution in the work queues, executions with a higher priority are processed first
+type Priority int
+
+const (
+	// PriorityHigh is meant for checks of instructors, e.g. testing the solutions of tests
+	PriorityHigh Priority = iota
+	// PriorityNormal is used for student submissions
+	PriorityNormal
+	// PriorityLow is meant for bulk runs, e.g. re-testing old submissions
+	PriorityLow
+
+	priorityCount = 3
+)
+
+var priorityNames = [priorityCount]string{"high", "normal", "low"}
+
+func (p Priority) String() string {
+	if p < 0 || p >= priorityCount {
+		return strconv.Itoa(int(p))
+	}
+	return priorityNames[p]
+}
+
+// parsePriority parses the name of a priority class, an empty name means normal priority
+func parsePriority(name string) (Priority, error) {
+	if name == "" {
+		return PriorityNormal, nil
+	}
+	for i, n := range priorityNames {
+		if n == name {
+			return Priority(i), nil
+		}
+	}
+	return PriorityNormal, fmt.Errorf("Unknown priority: %s", name)
+}
+
+type queuedExecution struct {
+	execution Execution
+	enqueued  time.Time
+}
+
+// workQueue holds the executions waiting for a stage of the pipeline.
+// Executions are taken by priority and in the order they were added within a priority.
+type workQueue struct {
+	stage    string
+	maxLen   int // maximum number of waiting executions, 0 means unlimited
+	mutex    sync.Mutex
+	nonEmpty *sync.Cond
+	queues   [priorityCount][]queuedExecution
+	length   int
+}
+
+func newWorkQueue(stage string, maxLen int) *workQueue {
+	q := &workQueue{stage: stage, maxLen: maxLen}
+	q.nonEmpty = sync.NewCond(&q.mutex)
+	return q
+}
+
+var compileQueue = newWorkQueue("compile", 0)
+var testQueue = newWorkQueue("test", 0)
+var analysisQueue = newWorkQueue("analysis", 0)
+var metricQueue = newWorkQueue("metric", 0)
+
+// push adds the execution to the queue. It returns false if the queue is full.
+func (q *workQueue) push(execution Execution) bool {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	if q.maxLen > 0 && q.length >= q.maxLen {
+		queueRejectedCounter.WithLabelValues(q.stage).Inc()
+		return false
+	}
+	p := execution.Priority
+	if p < 0 || p >= priorityCount {
+		p = PriorityNormal
+	}
+	q.queues[p] = append(q.queues[p], queuedExecution{execution: execution, enqueued: time.Now()})
+	q.length++
+	queueDepthGauge.WithLabelValues(q.stage, p.String()).Inc()
+	q.nonEmpty.Signal()
+	return true
+}
+
+// pop waits for an execution and removes it from the queue
+func (q *workQueue) pop() Execution {
+	q.mutex.Lock()
+	defer q.mutex.Unlock()
+	for q.length == 0 {
+		q.nonEmpty.Wait()
+	}
+	for p := range q.queues {
+		if len(q.queues[p]) == 0 {
+			continue
+		}
+		next := q.queues[p][0]
+		q.queues[p][0] = queuedExecution{}
+		q.queues[p] = q.queues[p][1:]
+		q.length--
+		queueDepthGauge.WithLabelValues(q.stage, Priority(p).String()).Dec()
+		queueWaitHistogram.WithLabelValues(q.stage).Observe(time.Since(next.enqueued).Seconds())
+		return next.execution
+	}
+	panic("work queue " + q.stage + " is inconsistent")
+}
+
+// startWorkers starts the given number of goroutines executing the service
+func startWorkers(count int, service func()) {
+	for i := 0; i < count; i++ {
+		go service()
+	}
+}
+
+// rejectOverloaded answers a request which could not be queued because the queue is full
+func rejectOverloaded(w http.ResponseWriter, execution Execution) {
+	rateLimits.release(execution.ID)
+	if err := os.RemoveAll(execution.RunDir); err != nil {
+		LogError("upload", "Could not remove run folder %s: %s", execution.RunDir, err)
+	}
+	LogError("upload", "Queue is full, rejected run of test %s", execution.Test)
+	w.Header().Set("Retry-After", strconv.Itoa(*queueRetryAfter))
+	writeError(w, http.StatusServiceUnavailable, ApiError{
+		Code:    ErrQueueFull,
+		Message: "Too many test runs waiting, try again later.",
+		Details: map[string]int{"retry_after": *queueRetryAfter},
+		Phase:   PhaseQueue,
+	})
+}